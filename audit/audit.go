@@ -0,0 +1,324 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/kataras/iris/v12"
+	"github.com/thoas/go-funk"
+	"regexp"
+	"time"
+)
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		Methods: []string{iris.MethodPost, iris.MethodPut, iris.MethodPatch, iris.MethodDelete},
+	}
+}
+
+// WithMethods 需要审计的请求方法, 默认POST/PUT/PATCH/DELETE
+func WithMethods(val ...string) Option {
+	return func(opts *Config) {
+		opts.Methods = val
+	}
+}
+func WithActorContextKeys(val ...string) Option {
+	return func(opts *Config) {
+		opts.ActorContextKeys = append(opts.ActorContextKeys, val...)
+	}
+}
+func WithActorSessionKeys(val ...string) Option {
+	return func(opts *Config) {
+		opts.ActorSessionKeys = append(opts.ActorSessionKeys, val...)
+	}
+}
+
+// WithActor 自定义actor获取, 默认依次使用Identity.Subject/ActorContextKeys/ActorSessionKeys
+func WithActor(val func(*baseContext.Context) string) Option {
+	return func(opts *Config) {
+		opts.Actor = val
+	}
+}
+
+// WithTargetParams 作为目标资源id的路由参数, 默认全部路由参数
+func WithTargetParams(val ...string) Option {
+	return func(opts *Config) {
+		opts.TargetParams = append(opts.TargetParams, val...)
+	}
+}
+
+// WithPath LevelAudit时不论请求方法都审计
+func WithPath(path interface{}, level Level) Option {
+	return func(opts *Config) {
+		opts.Paths = append(opts.Paths, PathConfig{path, level})
+	}
+}
+func WithPaths(paths ...PathConfig) Option {
+	return func(opts *Config) {
+		opts.Paths = append(opts.Paths, paths...)
+	}
+}
+func WithIgnorePaths(paths ...string) Option {
+	return func(opts *Config) {
+		for _, path := range paths {
+			opts.Paths = append(opts.Paths, PathConfig{path, LevelIgnore})
+		}
+	}
+}
+
+func New(sink Sink, opts ...Option) *Audit {
+	if sink == nil {
+		panic("sink 必须设置")
+	}
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &Audit{
+		Sink:   sink,
+		Config: config,
+	}
+}
+
+type Level int
+
+const (
+	// LevelUnset 无匹配规则, 按Methods判断
+	LevelUnset Level = iota
+	LevelIgnore
+	LevelAudit
+)
+
+type PathLevel struct {
+	Path  string
+	Level Level
+}
+
+type PathConfig struct {
+	Name  interface{}
+	Level Level
+}
+
+type Config struct {
+	Methods          []string
+	ActorContextKeys []string
+	ActorSessionKeys []string
+	Actor            func(*baseContext.Context) string
+	TargetParams     []string
+	Paths            []PathConfig
+}
+
+type Record struct {
+	Time          time.Time         `json:"time"`
+	RequestId     string            `json:"request_id,omitempty"`
+	Actor         string            `json:"actor"`
+	Action        string            `json:"action"`
+	Method        string            `json:"method"`
+	Path          string            `json:"path"`
+	Targets       map[string]string `json:"targets,omitempty"`
+	PayloadDigest string            `json:"payload_digest,omitempty"`
+	BeforeDigest  string            `json:"before_digest,omitempty"`
+	AfterDigest   string            `json:"after_digest,omitempty"`
+	Outcome       string            `json:"outcome"`
+	Status        int               `json:"status"`
+	ErrorCode     string            `json:"error_code,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	IP            string            `json:"ip"`
+}
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+type Audit struct {
+	Sink
+	*Config
+	pathLevel []PathLevel
+}
+
+func (a *Audit) CheckPath(currPath string) Level {
+
+	pathLevel := funk.Find(a.pathLevel, func(v PathLevel) bool {
+		return v.Path == currPath
+	})
+	if pathLevel != nil {
+		return pathLevel.(PathLevel).Level
+	}
+
+	level := MatchPath(a.Paths, currPath)
+	a.pathLevel = append(a.pathLevel, PathLevel{
+		Path:  currPath,
+		Level: level,
+	})
+	return level
+}
+
+// MatchPath 返回第一个匹配的规则的Level, 无匹配时为LevelUnset
+func MatchPath(paths []PathConfig, currPath string) Level {
+	for _, path := range paths {
+		switch v := (path.Name).(type) {
+		case string:
+			if v == currPath {
+				return path.Level
+			}
+		case *regexp.Regexp:
+			if result := v.MatchString(currPath); result {
+				return path.Level
+			}
+		}
+	}
+	return LevelUnset
+}
+
+func (a *Audit) Context(ctx *baseContext.Context) {
+	level := a.CheckPath(ctx.Request().URL.Path)
+	if level == LevelIgnore || (level == LevelUnset && !funk.ContainsString(a.Methods, ctx.Method())) {
+		ctx.Next()
+		return
+	}
+
+	startTime := time.Now()
+	//handler读取body后无法再次读取, 需在ctx.Next()之前计算摘要并开启body缓存
+	ctx.RecordRequestBody(true)
+	var payloadDigest string
+	if body, err := ctx.GetBody(); err == nil && len(body) > 0 {
+		payloadDigest = digestBytes(body)
+	}
+	ctx.Next()
+
+	record := &Record{
+		Time:          startTime,
+		RequestId:     ctx.Values().GetString("requestId"),
+		Actor:         a.actor(ctx),
+		Method:        ctx.Method(),
+		Path:          ctx.Path(),
+		Targets:       a.targets(ctx),
+		PayloadDigest: payloadDigest,
+		Outcome:       OutcomeSuccess,
+		Status:        ctx.GetStatusCode(),
+		IP:            ctx.GetIP(),
+	}
+	record.Action = action(ctx)
+	if v := ctx.Values().Get("auditBefore"); v != nil {
+		record.BeforeDigest = digest(v)
+	}
+	if v := ctx.Values().Get("auditAfter"); v != nil {
+		record.AfterDigest = digest(v)
+	} else if rec, ok := ctx.IsRecording(); ok && len(rec.Body()) > 0 {
+		record.AfterDigest = digestBytes(rec.Body())
+	}
+	if err := ctx.GetErr(); err != nil {
+		record.Outcome = OutcomeFailure
+		record.Error = err.Error()
+		if baseError.IsBaseError(err) {
+			record.ErrorCode = err.(*baseError.Error).Code
+		}
+	} else if record.Status >= 400 {
+		record.Outcome = OutcomeFailure
+	}
+
+	if err := a.Sink.Write(record); err != nil {
+		ctx.Application().Logger().Errorf("audit sink: %s", err)
+	}
+}
+
+func (a *Audit) Handler() iris.Handler {
+	return baseContext.Handler(a.Context)
+}
+
+func (a *Audit) actor(ctx *baseContext.Context) string {
+	if a.Actor != nil {
+		return a.Actor(ctx)
+	}
+	if identity := authorize.GetIdentity(ctx); identity != nil && identity.Subject != "" {
+		return identity.Subject
+	}
+	for _, key := range a.ActorContextKeys {
+		if value := ctx.Values().GetString(key); value != "" {
+			return value
+		}
+	}
+	if session := ctx.GetSession(); session != nil {
+		for _, key := range a.ActorSessionKeys {
+			if value := session.GetString(key); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+func (a *Audit) targets(ctx *baseContext.Context) map[string]string {
+	targets := make(map[string]string)
+	if len(a.TargetParams) == 0 {
+		ctx.Params().Visit(func(key string, value string) {
+			targets[key] = value
+		})
+	} else {
+		for _, key := range a.TargetParams {
+			if value := ctx.Params().Get(key); value != "" {
+				targets[key] = value
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	return targets
+}
+
+// SetAction 设置当前请求的action, 优先于路由名
+func SetAction(ctx *baseContext.Context, action string) {
+	ctx.Values().Set("auditAction", action)
+}
+
+// action 依次使用SetAction/自定义的路由名/"METHOD 路由模板", 无路由时为"METHOD 路径"
+// iris默认路由名为method+subdomain+path拼接, 不作为action
+func action(ctx *baseContext.Context) string {
+	if v := ctx.Values().GetString("auditAction"); v != "" {
+		return v
+	}
+	route := ctx.GetCurrentRoute()
+	if route == nil {
+		return ctx.Method() + " " + ctx.Path()
+	}
+	if name := route.Name(); name != "" && name != route.Method()+route.Subdomain()+route.Path() {
+		return name
+	}
+	return route.Method() + " " + route.Path()
+}
+
+// SetBefore 记录变更前的资源, 审计中仅保存摘要
+func SetBefore(ctx *baseContext.Context, v interface{}) {
+	ctx.Values().Set("auditBefore", v)
+}
+
+// SetAfter 记录变更后的资源, 未设置时使用已记录的响应内容
+func SetAfter(ctx *baseContext.Context, v interface{}) {
+	ctx.Values().Set("auditAfter", v)
+}
+
+func digest(v interface{}) string {
+	switch val := v.(type) {
+	case []byte:
+		return digestBytes(val)
+	case string:
+		return digestBytes([]byte(val))
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return digestBytes(b)
+}
+
+func digestBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
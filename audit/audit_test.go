@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"bytes"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/sessions"
+	"io"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newTestApp(t *testing.T, fn func(app *iris.Application), opts ...Option) (*iris.Application, chan *Record) {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	records := make(chan *Record, 10)
+	app := iris.New()
+	app.Use(sessions.New(sessions.Config{Cookie: "sid"}).Handler())
+	app.Use(New(NewChanSink(records), opts...).Handler())
+	fn(app)
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app, records
+}
+
+func serve(app *iris.Application, method string, path string, body string, header map[string]string) {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	app.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// next 返回本次请求的审计记录, 未审计时返回nil
+func next(records chan *Record) *Record {
+	select {
+	case r := <-records:
+		return r
+	default:
+		return nil
+	}
+}
+
+func okHandler(ctx *baseContext.Context) {
+	ctx.Success("ok")
+}
+
+func TestActor(t *testing.T) {
+	// actorHandler 按header设置identity/context/session中的actor
+	actorHandler := baseContext.Handler(func(ctx *baseContext.Context) {
+		if v := ctx.GetHeader("X-Subject"); v != "" {
+			authorize.SetIdentity(ctx, &authorize.Identity{Subject: v})
+		}
+		if v := ctx.GetHeader("X-Client"); v != "" {
+			ctx.Values().Set("clientId", v)
+		}
+		if v := ctx.GetHeader("X-Session"); v != "" {
+			ctx.GetSession().Set("uid", v)
+		}
+		ctx.Success("ok")
+	})
+	tests := []struct {
+		name   string
+		opts   []Option
+		header map[string]string
+		want   string
+	}{
+		{"identity", nil, map[string]string{"X-Subject": "u1", "X-Client": "c1", "X-Session": "s1"}, "u1"},
+		{"client", nil, map[string]string{"X-Client": "c1", "X-Session": "s1"}, "c1"},
+		{"session", nil, map[string]string{"X-Session": "s1"}, "s1"},
+		{"none", nil, nil, ""},
+		//identity没有subject时继续查找
+		{"emptySubject", nil, map[string]string{"X-Subject": "", "X-Client": "c1"}, "c1"},
+		{"custom", []Option{WithActor(func(ctx *baseContext.Context) string { return "custom" })}, map[string]string{"X-Subject": "u1"}, "custom"},
+	}
+	for _, tt := range tests {
+		opts := append([]Option{WithActorContextKeys("clientId"), WithActorSessionKeys("uid")}, tt.opts...)
+		app, records := newTestApp(t, func(app *iris.Application) {
+			app.Post("/", actorHandler)
+		}, opts...)
+		serve(app, "POST", "/", "", tt.header)
+		r := next(records)
+		if r == nil {
+			t.Fatalf("%s: no record", tt.name)
+		}
+		if r.Actor != tt.want {
+			t.Errorf("%s: actor = %q, want %q", tt.name, r.Actor, tt.want)
+		}
+	}
+}
+
+func TestAction(t *testing.T) {
+	app, records := newTestApp(t, func(app *iris.Application) {
+		app.Post("/orders", baseContext.Handler(okHandler)).Name = "order.create"
+		app.Put("/orders/{id}", baseContext.Handler(okHandler))
+		app.Delete("/orders/{id}", baseContext.Handler(func(ctx *baseContext.Context) {
+			SetAction(ctx, "order.cancel")
+			ctx.Success("ok")
+		})).Name = "order.delete"
+	})
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"POST", "/orders", "order.create"},
+		//iris默认路由名不作为action
+		{"PUT", "/orders/1", "PUT /orders/{id}"},
+		//SetAction优先于路由名
+		{"DELETE", "/orders/1", "order.cancel"},
+	}
+	for _, tt := range tests {
+		serve(app, tt.method, tt.path, "", nil)
+		r := next(records)
+		if r == nil {
+			t.Fatalf("%s %s: no record", tt.method, tt.path)
+		}
+		if r.Action != tt.want {
+			t.Errorf("%s %s: action = %q, want %q", tt.method, tt.path, r.Action, tt.want)
+		}
+		if r.Method != tt.method || r.Path != tt.path {
+			t.Errorf("%s %s: record = %s %s", tt.method, tt.path, r.Method, r.Path)
+		}
+	}
+}
+
+func TestPayloadDigest(t *testing.T) {
+	body := `{"name":"a"}`
+	var read string
+	app, records := newTestApp(t, func(app *iris.Application) {
+		//handler直接读取并消费body
+		app.Post("/orders/{id}", baseContext.Handler(func(ctx *baseContext.Context) {
+			b, err := io.ReadAll(ctx.Request().Body)
+			if err != nil {
+				ctx.Error(err)
+				return
+			}
+			read = string(b)
+			SetBefore(ctx, map[string]string{"name": "b"})
+			SetAfter(ctx, []byte(body))
+			ctx.Success("ok")
+		}))
+	})
+	serve(app, "POST", "/orders/1", body, nil)
+	r := next(records)
+	if r == nil {
+		t.Fatal("no record")
+	}
+	if read != body {
+		t.Errorf("handler read %q, want %q", read, body)
+	}
+	if want := digestBytes([]byte(body)); r.PayloadDigest != want {
+		t.Errorf("payload digest = %s, want %s", r.PayloadDigest, want)
+	}
+	if want := digestBytes([]byte(`{"name":"b"}`)); r.BeforeDigest != want {
+		t.Errorf("before digest = %s, want %s", r.BeforeDigest, want)
+	}
+	if want := digestBytes([]byte(body)); r.AfterDigest != want {
+		t.Errorf("after digest = %s, want %s", r.AfterDigest, want)
+	}
+	if r.Targets["id"] != "1" || r.Outcome != OutcomeSuccess {
+		t.Errorf("record = %+v", r)
+	}
+
+	//无body时不记录摘要
+	serve(app, "POST", "/orders/2", "", nil)
+	if r := next(records); r == nil || r.PayloadDigest != "" {
+		t.Errorf("empty body record = %+v", r)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	app, records := newTestApp(t, func(app *iris.Application) {
+		app.Get("/orders", baseContext.Handler(okHandler))
+		app.Get("/export", baseContext.Handler(okHandler))
+		app.Post("/orders", baseContext.Handler(func(ctx *baseContext.Context) {
+			ctx.Error(baseError.NewCode(ctx.ErrorCodes["Validation"], "invalid"))
+		}))
+		app.Post("/health", baseContext.Handler(okHandler))
+	}, WithPath(regexp.MustCompile("^/export"), LevelAudit), WithIgnorePaths("/health"))
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{"GET", "/orders", false},
+		{"GET", "/export", true},
+		{"POST", "/orders", true},
+		{"POST", "/health", false},
+	}
+	for _, tt := range tests {
+		serve(app, tt.method, tt.path, "", nil)
+		if r := next(records); (r != nil) != tt.want {
+			t.Errorf("%s %s: audited = %v, want %v", tt.method, tt.path, r != nil, tt.want)
+		}
+	}
+
+	serve(app, "POST", "/orders", "", nil)
+	r := next(records)
+	if r == nil || r.Outcome != OutcomeFailure || r.ErrorCode != baseContext.ErrorValidation || !strings.HasSuffix(r.Error, "invalid") {
+		t.Errorf("failure record = %+v", r)
+	}
+}
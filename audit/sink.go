@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"github.com/go-estar/logger"
+	"os"
+	"sync"
+)
+
+var ErrorSinkFull = stderrors.New("audit sink full")
+
+type Sink interface {
+	Write(*Record) error
+}
+
+type SinkFunc func(*Record) error
+
+func (f SinkFunc) Write(r *Record) error {
+	return f(r)
+}
+
+// NewLoggerSink 写入独立的logger, 不与requestLogger混用
+func NewLoggerSink(l logger.Logger) Sink {
+	if l == nil {
+		panic("logger 必须设置")
+	}
+	return SinkFunc(func(r *Record) error {
+		fields := []*logger.Field{
+			logger.NewField("time", r.Time),
+			logger.NewField("actor", r.Actor),
+			logger.NewField("action", r.Action),
+			logger.NewField("method", r.Method),
+			logger.NewField("path", r.Path),
+			logger.NewField("outcome", r.Outcome),
+			logger.NewField("status", r.Status),
+			logger.NewField("ip", r.IP),
+		}
+		if r.RequestId != "" {
+			fields = append(fields, logger.NewField("request_id", r.RequestId))
+		}
+		if len(r.Targets) > 0 {
+			fields = append(fields, logger.NewField("targets", r.Targets))
+		}
+		if r.PayloadDigest != "" {
+			fields = append(fields, logger.NewField("payload_digest", r.PayloadDigest))
+		}
+		if r.BeforeDigest != "" {
+			fields = append(fields, logger.NewField("before_digest", r.BeforeDigest))
+		}
+		if r.AfterDigest != "" {
+			fields = append(fields, logger.NewField("after_digest", r.AfterDigest))
+		}
+		if r.Error != "" {
+			fields = append(fields, logger.NewField("error_code", r.ErrorCode), logger.NewField("error", r.Error))
+		}
+		l.Info("audit", fields...)
+		return nil
+	})
+}
+
+// NewFileSink 以JSON Lines追加写入文件
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: f, encoder: json.NewEncoder(f)}, nil
+}
+
+type FileSink struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func (s *FileSink) Write(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(r)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// NewChanSink 投递到channel, 满时不阻塞请求, 返回ErrorSinkFull
+func NewChanSink(ch chan<- *Record) Sink {
+	if ch == nil {
+		panic("channel 必须设置")
+	}
+	return SinkFunc(func(r *Record) error {
+		select {
+		case ch <- r:
+			return nil
+		default:
+			return ErrorSinkFull
+		}
+	})
+}
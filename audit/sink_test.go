@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/go-estar/logger"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testRecord(actor string) *Record {
+	return &Record{
+		Time:          time.Unix(1700000000, 0).UTC(),
+		RequestId:     "r1",
+		Actor:         actor,
+		Action:        "order.create",
+		Method:        "POST",
+		Path:          "/orders",
+		Targets:       map[string]string{"id": "1"},
+		PayloadDigest: "sha256:p",
+		Outcome:       OutcomeFailure,
+		Status:        200,
+		ErrorCode:     "102",
+		Error:         "invalid",
+		IP:            "203.0.113.9",
+	}
+}
+
+func TestChanSink(t *testing.T) {
+	ch := make(chan *Record, 1)
+	sink := NewChanSink(ch)
+	if err := sink.Write(testRecord("u1")); err != nil {
+		t.Fatal(err)
+	}
+	//满时不阻塞
+	if err := sink.Write(testRecord("u2")); err != ErrorSinkFull {
+		t.Errorf("Write() on full channel = %v, want %v", err, ErrorSinkFull)
+	}
+	if r := <-ch; r.Actor != "u1" {
+		t.Errorf("delivered actor = %s", r.Actor)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, actor := range []string{"u1", "u2"} {
+		if err := sink.Write(testRecord(actor)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var actors []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Action != "order.create" || r.Targets["id"] != "1" || r.ErrorCode != "102" {
+			t.Errorf("record = %+v", r)
+		}
+		actors = append(actors, r.Actor)
+	}
+	if len(actors) != 2 || actors[0] != "u1" || actors[1] != "u2" {
+		t.Errorf("actors = %v", actors)
+	}
+}
+
+type captureLogger struct {
+	msg    string
+	fields map[string]interface{}
+}
+
+func (c *captureLogger) Level() string { return "debug" }
+
+func (c *captureLogger) capture(msg string, fields ...*logger.Field) {
+	c.msg = msg
+	c.fields = map[string]interface{}{}
+	for _, field := range fields {
+		c.fields[field.Key] = field.Value
+	}
+}
+
+func (c *captureLogger) Debug(msg string, fields ...*logger.Field) { c.capture(msg, fields...) }
+func (c *captureLogger) Info(msg string, fields ...*logger.Field)  { c.capture(msg, fields...) }
+func (c *captureLogger) Warn(msg string, fields ...*logger.Field)  { c.capture(msg, fields...) }
+func (c *captureLogger) Error(msg string, fields ...*logger.Field) { c.capture(msg, fields...) }
+func (c *captureLogger) Fatal(msg string, fields ...*logger.Field) { c.capture(msg, fields...) }
+
+func TestLoggerSink(t *testing.T) {
+	l := &captureLogger{}
+	if err := NewLoggerSink(l).Write(testRecord("u1")); err != nil {
+		t.Fatal(err)
+	}
+	if l.msg != "audit" {
+		t.Errorf("msg = %s", l.msg)
+	}
+	want := map[string]interface{}{
+		"actor":          "u1",
+		"action":         "order.create",
+		"method":         "POST",
+		"path":           "/orders",
+		"outcome":        OutcomeFailure,
+		"status":         200,
+		"ip":             "203.0.113.9",
+		"request_id":     "r1",
+		"payload_digest": "sha256:p",
+		"error_code":     "102",
+		"error":          "invalid",
+	}
+	for k, v := range want {
+		if l.fields[k] != v {
+			t.Errorf("%s = %v, want %v", k, l.fields[k], v)
+		}
+	}
+	//未设置的摘要不输出
+	for _, k := range []string{"before_digest", "after_digest"} {
+		if _, ok := l.fields[k]; ok {
+			t.Errorf("unexpected field %s", k)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package apiKey
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/authorize/bearerToken"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/security/requestLimiter"
+	"time"
+)
+
+var (
+	ErrorNotFound    = stderrors.New("api key not found")
+	ErrorExpired     = stderrors.New("api key expired")
+	ErrorNotYetValid = stderrors.New("api key not yet valid")
+)
+
+// Key 只保存明文key的hash
+type Key struct {
+	Id         string    `json:"id"`
+	Hash       string    `json:"hash"`
+	Owner      string    `json:"owner"`
+	Name       string    `json:"name,omitempty"`
+	Scopes     []string  `json:"scopes,omitempty"`
+	NotBefore  time.Time `json:"not_before,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	RateLimit  float64   `json:"rate_limit,omitempty"`
+	Burst      int       `json:"burst,omitempty"`
+}
+
+func (k *Key) Valid(now time.Time) error {
+	if !k.NotBefore.IsZero() && now.Before(k.NotBefore) {
+		return ErrorNotYetValid
+	}
+	if !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt) {
+		return ErrorExpired
+	}
+	return nil
+}
+
+type Store interface {
+	Get(ctx context.Context, hash string) (*Key, error)
+	Save(ctx context.Context, key *Key) error
+	Delete(ctx context.Context, hash string) error
+	ListByOwner(ctx context.Context, owner string) ([]*Key, error)
+	Touch(ctx context.Context, hash string, t time.Time) error
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		Prefix:        "ak_",
+		TouchInterval: time.Minute,
+		Clock:         time.Now,
+	}
+}
+
+// WithPepper hash时使用的服务端密钥(HMAC-SHA256), 存储泄露时无法离线比对
+func WithPepper(val []byte) Option {
+	return func(opts *Config) {
+		opts.Pepper = val
+	}
+}
+func WithPrefix(val string) Option {
+	return func(opts *Config) {
+		opts.Prefix = val
+	}
+}
+
+// WithTouchInterval LastUsedAt的最小更新间隔, 避免每个请求都写存储
+func WithTouchInterval(val time.Duration) Option {
+	return func(opts *Config) {
+		opts.TouchInterval = val
+	}
+}
+
+// WithKeyLimiter 按Key.RateLimit限流, 未设置时忽略RateLimit
+func WithKeyLimiter(val *requestLimiter.KeyLimiter) Option {
+	return func(opts *Config) {
+		opts.Limiter = val
+	}
+}
+func WithClock(val func() time.Time) Option {
+	return func(opts *Config) {
+		opts.Clock = val
+	}
+}
+
+// WithCache 与bearerToken.WithCache使用同一个Cache, Revoke/Rotate时删除该key的缓存
+func WithCache(val *bearerToken.Cache) Option {
+	return func(opts *Config) {
+		opts.Cache = val
+	}
+}
+
+type Config struct {
+	Pepper        []byte
+	Prefix        string
+	TouchInterval time.Duration
+	Limiter       *requestLimiter.KeyLimiter
+	Clock         func() time.Time
+	Cache         *bearerToken.Cache
+}
+
+func New(store Store, opts ...Option) *ApiKey {
+	if store == nil {
+		panic("store 必须设置")
+	}
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &ApiKey{
+		Store:  store,
+		Config: config,
+	}
+}
+
+// ApiKey 实现bearerToken.Authorize, 配合bearerToken.NewAPIKeyScheme使用
+// 开启bearerToken.Cache时命中缓存仍按key限流, LastUsedAt只在未命中时更新; 需同时设置WithCache, 否则吊销后缓存过期前仍可使用
+type ApiKey struct {
+	Store Store
+	*Config
+}
+
+func (a *ApiKey) Hash(plaintext string) string {
+	if len(a.Pepper) > 0 {
+		mac := hmac.New(sha256.New, a.Pepper)
+		mac.Write([]byte(plaintext))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue 生成新key, 明文只在此返回一次
+func (a *ApiKey) Issue(ctx context.Context, template Key) (string, *Key, error) {
+	plaintext, err := a.generate()
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	key := template
+	key.Id = id
+	key.Hash = a.Hash(plaintext)
+	key.CreatedAt = a.Clock()
+	key.LastUsedAt = time.Time{}
+	if err := a.Store.Save(ctx, &key); err != nil {
+		return "", nil, err
+	}
+	return plaintext, &key, nil
+}
+
+// Rotate 以旧key为模板生成新key, 旧key在overlap后失效, 期间新旧key同时有效
+func (a *ApiKey) Rotate(ctx context.Context, oldHash string, overlap time.Duration) (string, *Key, error) {
+	old, err := a.Store.Get(ctx, oldHash)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext, key, err := a.Issue(ctx, Key{
+		Owner:     old.Owner,
+		Name:      old.Name,
+		Scopes:    old.Scopes,
+		ExpiresAt: old.ExpiresAt,
+		RateLimit: old.RateLimit,
+		Burst:     old.Burst,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	// 新key至少覆盖重叠期
+	if !key.ExpiresAt.IsZero() && key.ExpiresAt.Before(key.CreatedAt.Add(overlap)) {
+		key.ExpiresAt = key.CreatedAt.Add(overlap)
+		if err := a.Store.Save(ctx, key); err != nil {
+			return "", nil, err
+		}
+	}
+	expiresAt := a.Clock().Add(overlap)
+	if old.ExpiresAt.IsZero() || expiresAt.Before(old.ExpiresAt) {
+		old.ExpiresAt = expiresAt
+		if err := a.Store.Save(ctx, old); err != nil {
+			return "", nil, err
+		}
+		a.evict(old)
+	}
+	return plaintext, key, nil
+}
+
+func (a *ApiKey) Revoke(ctx context.Context, hash string) error {
+	key, err := a.Store.Get(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if a.Limiter != nil {
+		a.Limiter.Remove(key.Id)
+	}
+	if err := a.Store.Delete(ctx, hash); err != nil {
+		return err
+	}
+	a.evict(key)
+	return nil
+}
+
+// evict 缓存key是明文的sha256, 设置Pepper时与Key.Hash不同, 按TokenId删除
+func (a *ApiKey) evict(key *Key) {
+	if a.Cache != nil {
+		a.Cache.EvictTokenId(key.Id)
+	}
+}
+
+// Verify 校验明文key, 返回对应Key
+func (a *ApiKey) Verify(ctx context.Context, plaintext string) (*Key, error) {
+	if plaintext == "" {
+		return nil, ErrorNotFound
+	}
+	hash := a.Hash(plaintext)
+	key, err := a.Store.Get(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// 存储按hash查找, 这里再做一次常量时间比较
+	if !hmac.Equal([]byte(key.Hash), []byte(hash)) {
+		return nil, ErrorNotFound
+	}
+	now := a.Clock()
+	if err := key.Valid(now); err != nil {
+		return nil, err
+	}
+	if a.TouchInterval >= 0 && now.Sub(key.LastUsedAt) >= a.TouchInterval {
+		if err := a.Store.Touch(ctx, hash, now); err == nil {
+			key.LastUsedAt = now
+		}
+	}
+	return key, nil
+}
+
+func (a *ApiKey) Handler(ctx *baseContext.Context, credential string) error {
+	key, err := a.Verify(ctx.RequestCtx(), credential)
+	if err != nil {
+		if stderrors.Is(err, ErrorNotFound) || stderrors.Is(err, ErrorExpired) || stderrors.Is(err, ErrorNotYetValid) {
+			return baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], err)
+		}
+		return err
+	}
+	if err := a.limit(ctx, key); err != nil {
+		return err
+	}
+	authorize.SetIdentity(ctx, &authorize.Identity{
+		Subject:   key.Owner,
+		TokenId:   key.Id,
+		Scheme:    "apikey",
+		Scopes:    key.Scopes,
+		ExpiresAt: key.ExpiresAt,
+		Claims:    key,
+	})
+	return nil
+}
+
+// CacheHit 实现bearerToken.CachedAuthorize, 命中bearerToken.Cache时仍按key限流
+func (a *ApiKey) CacheHit(ctx *baseContext.Context, identity *authorize.Identity) error {
+	key, ok := identity.Claims.(*Key)
+	if !ok {
+		return baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], ErrorNotFound)
+	}
+	return a.limit(ctx, key)
+}
+
+func (a *ApiKey) limit(ctx *baseContext.Context, key *Key) error {
+	if a.Limiter == nil || key.RateLimit <= 0 {
+		return nil
+	}
+	if err := a.Limiter.Limit(key.Id, key.RateLimit, key.Burst); err != nil {
+		ctx.SetRejected(baseContext.RejectedLimiter)
+		return err
+	}
+	return nil
+}
+
+func (a *ApiKey) generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return a.Prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
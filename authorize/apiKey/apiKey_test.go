@@ -0,0 +1,321 @@
+package apiKey
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"github.com/didip/tollbooth/limiter"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/authorize/bearerToken"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/go-estar/iris/security/requestLimiter"
+	"github.com/kataras/iris/v12"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+// touchStore 记录Touch次数
+type touchStore struct {
+	*MemoryStore
+	touches int
+}
+
+func (s *touchStore) Touch(ctx context.Context, hash string, t time.Time) error {
+	s.touches++
+	return s.MemoryStore.Touch(ctx, hash, t)
+}
+
+func clock(now *time.Time) Option {
+	return WithClock(func() time.Time { return *now })
+}
+
+func TestHash(t *testing.T) {
+	plain := New(NewMemoryStore())
+	sum := sha256.Sum256([]byte("ak_test"))
+	if got := plain.Hash("ak_test"); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("Hash() = %s", got)
+	}
+
+	peppered := New(NewMemoryStore(), WithPepper([]byte("pepper")))
+	mac := hmac.New(sha256.New, []byte("pepper"))
+	mac.Write([]byte("ak_test"))
+	if got := peppered.Hash("ak_test"); got != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Hash(pepper) = %s", got)
+	}
+
+	//存储的hash与pepper绑定, 更换pepper后无法验证
+	store := NewMemoryStore()
+	a := New(store, WithPepper([]byte("pepper")))
+	plaintext, key, err := a.Issue(context.Background(), Key{Owner: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plaintext, "ak_") || key.Hash == plaintext || key.Hash != a.Hash(plaintext) {
+		t.Errorf("Issue() = %s %+v", plaintext, key)
+	}
+	if _, err := a.Verify(context.Background(), plaintext); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+	if _, err := New(store, WithPepper([]byte("other"))).Verify(context.Background(), plaintext); !stderrors.Is(err, ErrorNotFound) {
+		t.Errorf("Verify(other pepper) = %v, want %v", err, ErrorNotFound)
+	}
+	if _, err := New(store).Verify(context.Background(), plaintext); !stderrors.Is(err, ErrorNotFound) {
+		t.Errorf("Verify(no pepper) = %v, want %v", err, ErrorNotFound)
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name string
+		key  Key
+		want error
+	}{
+		{"valid", Key{}, nil},
+		{"notBefore", Key{NotBefore: testNow.Add(time.Second)}, ErrorNotYetValid},
+		{"started", Key{NotBefore: testNow}, nil},
+		{"expired", Key{ExpiresAt: testNow}, ErrorExpired},
+		{"beforeExpires", Key{ExpiresAt: testNow.Add(time.Second)}, nil},
+	}
+	for _, tt := range tests {
+		if err := tt.key.Valid(testNow); err != tt.want {
+			t.Errorf("%s: Valid() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	tests := []struct {
+		name          string
+		expiresAt     time.Time
+		wantOldExpire time.Time
+		wantNewExpire time.Time
+	}{
+		{"noExpiry", time.Time{}, testNow.Add(time.Hour), time.Time{}},
+		//旧key在重叠期前过期时保持原过期时间, 新key至少覆盖重叠期
+		{"expiresSoon", testNow.Add(time.Minute), testNow.Add(time.Minute), testNow.Add(time.Hour)},
+		{"expiresLater", testNow.Add(24 * time.Hour), testNow.Add(time.Hour), testNow.Add(24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow
+			a := New(NewMemoryStore(), clock(&now))
+			ctx := context.Background()
+			oldPlain, old, err := a.Issue(ctx, Key{Owner: "u1", Scopes: []string{"read"}, ExpiresAt: tt.expiresAt, RateLimit: 5, Burst: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			newPlain, key, err := a.Rotate(ctx, old.Hash, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Id == old.Id || key.Owner != "u1" || key.Scopes[0] != "read" || key.RateLimit != 5 || key.Burst != 2 {
+				t.Errorf("Rotate() = %+v", key)
+			}
+			if !key.ExpiresAt.Equal(tt.wantNewExpire) {
+				t.Errorf("new ExpiresAt = %v, want %v", key.ExpiresAt, tt.wantNewExpire)
+			}
+			stored, _ := a.Store.Get(ctx, old.Hash)
+			if !stored.ExpiresAt.Equal(tt.wantOldExpire) {
+				t.Errorf("old ExpiresAt = %v, want %v", stored.ExpiresAt, tt.wantOldExpire)
+			}
+
+			//重叠期内新旧key同时有效
+			now = tt.wantOldExpire.Add(-time.Second)
+			for _, plaintext := range []string{oldPlain, newPlain} {
+				if _, err := a.Verify(ctx, plaintext); err != nil {
+					t.Errorf("Verify() during overlap = %v", err)
+				}
+			}
+			now = tt.wantOldExpire
+			if _, err := a.Verify(ctx, oldPlain); err != ErrorExpired {
+				t.Errorf("Verify(old) after overlap = %v, want %v", err, ErrorExpired)
+			}
+			if _, err := a.Verify(ctx, newPlain); err != nil {
+				t.Errorf("Verify(new) after overlap = %v", err)
+			}
+		})
+	}
+
+	a := New(NewMemoryStore())
+	if _, _, err := a.Rotate(context.Background(), "missing", time.Hour); !stderrors.Is(err, ErrorNotFound) {
+		t.Errorf("Rotate(missing) = %v, want %v", err, ErrorNotFound)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		steps    []time.Duration
+		want     int
+	}{
+		{"throttled", time.Minute, []time.Duration{0, 30 * time.Second, 59 * time.Second, time.Minute, 90 * time.Second}, 2},
+		{"everyRequest", 0, []time.Duration{0, 0, time.Second}, 3},
+		{"disabled", -1, []time.Duration{0, time.Hour}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow
+			store := &touchStore{MemoryStore: NewMemoryStore()}
+			a := New(store, clock(&now), WithTouchInterval(tt.interval))
+			plaintext, key, err := a.Issue(context.Background(), Key{Owner: "u1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, step := range tt.steps {
+				now = testNow.Add(step)
+				if _, err := a.Verify(context.Background(), plaintext); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if store.touches != tt.want {
+				t.Errorf("touches = %d, want %d", store.touches, tt.want)
+			}
+			if stored, _ := store.Get(context.Background(), key.Hash); tt.want > 0 && stored.LastUsedAt.IsZero() {
+				t.Error("LastUsedAt not updated")
+			}
+		})
+	}
+}
+
+func newTestApp(t *testing.T, a *ApiKey, cache *bearerToken.Cache) *iris.Application {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	opts := []bearerToken.Option{bearerToken.WithSchemes(bearerToken.NewAPIKeyScheme("X-API-Key"))}
+	if cache != nil {
+		opts = append(opts, bearerToken.WithCache(cache))
+	}
+	app.Get("/", bearerToken.New(a, opts...).Handler(), baseContext.Handler(func(ctx *baseContext.Context) {
+		ctx.WriteString("ok:" + authorize.GetIdentity(ctx).Subject)
+	}))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// serve 通过时返回true
+func serve(app *iris.Application, key string) bool {
+	return strings.HasPrefix(request(app, key), "ok:")
+}
+
+// request 通过时返回"ok:<subject>", 否则返回响应的code
+func request(app *iris.Application, key string) string {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	var resp struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		return w.Body.String()
+	}
+	return resp.Code
+}
+
+func TestKeyLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache *bearerToken.Cache
+	}{
+		{"noCache", nil},
+		//命中缓存时仍按key限流
+		{"cache", bearerToken.NewCache()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := requestLimiter.NewKeyLimiter(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Hour})
+			a := New(NewMemoryStore(), WithKeyLimiter(limiter))
+			limited, _, err := a.Issue(context.Background(), Key{Owner: "u1", RateLimit: 1, Burst: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, _, err := a.Issue(context.Background(), Key{Owner: "u2", RateLimit: 1, Burst: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			unlimited, _, err := a.Issue(context.Background(), Key{Owner: "u3"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			app := newTestApp(t, a, tt.cache)
+
+			for i, want := range []bool{true, true, false} {
+				if got := serve(app, limited); got != want {
+					t.Errorf("request %d: passed = %v, want %v", i, got, want)
+				}
+			}
+			//其他key的配额不受影响
+			if !serve(app, other) {
+				t.Error("other key limited")
+			}
+			for i := 0; i < 5; i++ {
+				if !serve(app, unlimited) {
+					t.Error("unlimited key limited")
+				}
+			}
+			if serve(app, "ak_invalid") {
+				t.Error("invalid key passed")
+			}
+			if tt.cache != nil && tt.cache.Stats().Hits == 0 {
+				t.Error("cache not used")
+			}
+		})
+	}
+}
+
+func TestRevokeCached(t *testing.T) {
+	now := testNow
+	cache := bearerToken.NewCache(bearerToken.WithCacheClock(func() time.Time { return now }))
+	a := New(NewMemoryStore(), clock(&now), WithPepper([]byte("pepper")), WithCache(cache))
+	ctx := context.Background()
+	app := newTestApp(t, a, cache)
+
+	revoked, key, err := a.Issue(ctx, Key{Owner: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if got := request(app, revoked); got != "ok:u1" {
+			t.Fatalf("request %d = %s", i, got)
+		}
+	}
+	if err := a.Revoke(ctx, key.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if got := request(app, revoked); got != baseContext.ErrorUnauthorized {
+		t.Errorf("revoked = %s, want %s", got, baseContext.ErrorUnauthorized)
+	}
+
+	//轮换后旧key的缓存按新的过期时间失效
+	rotated, key, err := a.Issue(ctx, Key{Owner: "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := request(app, rotated); got != "ok:u2" {
+		t.Fatalf("before rotate = %s", got)
+	}
+	if _, _, err := a.Rotate(ctx, key.Hash, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := request(app, rotated); got != "ok:u2" {
+		t.Errorf("during overlap = %s", got)
+	}
+	now = now.Add(time.Minute)
+	if got := request(app, rotated); got != baseContext.ErrorUnauthorized {
+		t.Errorf("after overlap = %s, want %s", got, baseContext.ErrorUnauthorized)
+	}
+	if cache.Stats().Hits == 0 {
+		t.Error("cache not used")
+	}
+}
@@ -0,0 +1,191 @@
+package apiKey
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]*Key)}
+}
+
+// MemoryStore 单实例或测试使用
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]*Key
+}
+
+func (s *MemoryStore) Get(ctx context.Context, hash string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, key *Key) error {
+	copied := *key
+	s.mu.Lock()
+	s.keys[key.Hash] = &copied
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	delete(s.keys, hash)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) ListByOwner(ctx context.Context, owner string) ([]*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]*Key, 0)
+	for _, key := range s.keys {
+		if key.Owner == owner {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+func (s *MemoryStore) Touch(ctx context.Context, hash string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[hash]
+	if !ok {
+		return ErrorNotFound
+	}
+	key.LastUsedAt = t
+	return nil
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if client == nil {
+		panic("client 必须设置")
+	}
+	return &RedisStore{Client: client, Prefix: prefix}
+}
+
+// RedisStore key: prefix+"key:"+hash, 使用时间: prefix+"used:"+hash, 按owner索引: prefix+"owner:"+owner
+type RedisStore struct {
+	Client *redis.Client
+	Prefix string
+}
+
+func (s *RedisStore) keyName(hash string) string {
+	return s.Prefix + "key:" + hash
+}
+
+func (s *RedisStore) usedName(hash string) string {
+	return s.Prefix + "used:" + hash
+}
+
+func (s *RedisStore) ownerName(owner string) string {
+	return s.Prefix + "owner:" + owner
+}
+
+func (s *RedisStore) Get(ctx context.Context, hash string) (*Key, error) {
+	values, err := s.Client.MGet(ctx, s.keyName(hash), s.usedName(hash)).Result()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	key := &Key{}
+	if err := json.Unmarshal([]byte(data), key); err != nil {
+		return nil, err
+	}
+	if used, ok := values[1].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, used); err == nil && t.After(key.LastUsedAt) {
+			key.LastUsedAt = t
+		}
+	}
+	return key, nil
+}
+
+func (s *RedisStore) Save(ctx context.Context, key *Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(0)
+	if !key.ExpiresAt.IsZero() {
+		if ttl = time.Until(key.ExpiresAt); ttl <= 0 {
+			return s.Delete(ctx, key.Hash)
+		}
+	}
+	pipe := s.Client.TxPipeline()
+	pipe.Set(ctx, s.keyName(key.Hash), data, ttl)
+	if ttl > 0 {
+		pipe.Expire(ctx, s.usedName(key.Hash), ttl)
+	} else {
+		pipe.Persist(ctx, s.usedName(key.Hash))
+	}
+	if key.Owner != "" {
+		pipe.SAdd(ctx, s.ownerName(key.Owner), key.Hash)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) Delete(ctx context.Context, hash string) error {
+	key, err := s.Get(ctx, hash)
+	if err != nil && !stderrors.Is(err, ErrorNotFound) {
+		return err
+	}
+	pipe := s.Client.TxPipeline()
+	pipe.Del(ctx, s.keyName(hash), s.usedName(hash))
+	if key != nil && key.Owner != "" {
+		pipe.SRem(ctx, s.ownerName(key.Owner), hash)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ListByOwner 顺带清理已过期的索引
+func (s *RedisStore) ListByOwner(ctx context.Context, owner string) ([]*Key, error) {
+	hashes, err := s.Client.SMembers(ctx, s.ownerName(owner)).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(hashes))
+	for _, hash := range hashes {
+		key, err := s.Get(ctx, hash)
+		if stderrors.Is(err, ErrorNotFound) {
+			s.Client.SRem(ctx, s.ownerName(owner), hash)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Touch 单独写使用时间, 不覆盖key数据
+func (s *RedisStore) Touch(ctx context.Context, hash string, t time.Time) error {
+	ttl, err := s.Client.PTTL(ctx, s.keyName(hash)).Result()
+	if err != nil {
+		return err
+	}
+	if ttl == -2 {
+		return ErrorNotFound
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return s.Client.Set(ctx, s.usedName(hash), t.Format(time.RFC3339Nano), ttl).Err()
+}
@@ -1,17 +1,29 @@
 package bearerToken
 
 import (
+	"context"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
 	"github.com/go-estar/iris/baseContext"
 	"github.com/kataras/iris/v12"
 	"github.com/thoas/go-funk"
 	"regexp"
-	"strings"
 )
 
 type Authorize interface {
 	Handler(*baseContext.Context, string) error
 }
 
+// CachedAuthorize 开启Cache时命中缓存不再调用Handler, 改为调用CacheHit, 用于每个请求都要执行的检查(如按key限流)
+type CachedAuthorize interface {
+	CacheHit(*baseContext.Context, *authorize.Identity) error
+}
+
+// Denylist 验证通过后检查token是否已吊销, 见authorize/denylist
+type Denylist interface {
+	Revoked(ctx context.Context, tokenHash string, identity *authorize.Identity) (bool, error)
+}
+
 type Option func(*Config)
 
 func defaultConfig() *Config {
@@ -31,6 +43,34 @@ func WithTokenPrefix(val string) Option {
 		opts.TokenPrefix = val
 	}
 }
+
+// WithSchemes 按顺序尝试的凭证来源, 使用New传入的Authorize; 未设置时使用TokenProperty/TokenPrefix
+func WithSchemes(schemes ...Scheme) Option {
+	return func(opts *Config) {
+		for _, scheme := range schemes {
+			opts.Schemes = append(opts.Schemes, schemeAuthorize{Scheme: scheme})
+		}
+	}
+}
+
+// WithScheme 凭证来源使用单独的Authorize, 如BasicScheme对应账号密码校验
+func WithScheme(scheme Scheme, authorize Authorize) Option {
+	return func(opts *Config) {
+		opts.Schemes = append(opts.Schemes, schemeAuthorize{Scheme: scheme, Authorize: authorize})
+	}
+}
+
+// WithCache 缓存验证结果, 见NewCache
+func WithCache(val *Cache) Option {
+	return func(opts *Config) {
+		opts.Cache = val
+	}
+}
+func WithDenylist(val Denylist) Option {
+	return func(opts *Config) {
+		opts.Denylist = val
+	}
+}
 func WithPath(path interface{}, level Level) Option {
 	return func(opts *Config) {
 		opts.Paths = append(opts.Paths, PathConfig{path, level})
@@ -64,6 +104,14 @@ func New(authorize Authorize, opts ...Option) *BearerToken {
 	for _, apply := range opts {
 		apply(config)
 	}
+	if len(config.Schemes) == 0 {
+		config.Schemes = append(config.Schemes, schemeAuthorize{Scheme: NewPrefixScheme(config.TokenProperty, config.TokenPrefix)})
+	}
+	for i := range config.Schemes {
+		if config.Schemes[i].Authorize == nil {
+			config.Schemes[i].Authorize = authorize
+		}
+	}
 	return &BearerToken{
 		Authorize: authorize,
 		Config:    config,
@@ -91,6 +139,9 @@ type PathConfig struct {
 type Config struct {
 	TokenProperty string
 	TokenPrefix   string
+	Schemes       []schemeAuthorize
+	Cache         *Cache
+	Denylist      Denylist
 	Paths         []PathConfig
 }
 
@@ -108,41 +159,33 @@ func (s *BearerToken) CheckPath(currPath string) Level {
 		return pathLevel.(PathLevel).Level
 	}
 
-	for _, path := range s.Paths {
+	level := MatchPath(s.Paths, currPath)
+	s.pathLevel = append(s.pathLevel, PathLevel{
+		Path:  currPath,
+		Level: level,
+	})
+	return level
+}
+
+// MatchPath 返回第一个匹配的规则的Level, 无匹配时为LevelVerify; 供mtls等中间件复用
+func MatchPath(paths []PathConfig, currPath string) Level {
+	for _, path := range paths {
 		switch v := (path.Name).(type) {
 		case string:
 			if v == currPath {
-				s.pathLevel = append(s.pathLevel, PathLevel{
-					Path:  currPath,
-					Level: path.Level,
-				})
 				return path.Level
 			}
 		case *regexp.Regexp:
 			if result := v.MatchString(currPath); result {
-				s.pathLevel = append(s.pathLevel, PathLevel{
-					Path:  currPath,
-					Level: path.Level,
-				})
 				return path.Level
 			}
 		case func(string) bool:
 			if result := v(currPath); result {
-				s.pathLevel = append(s.pathLevel, PathLevel{
-					Path:  currPath,
-					Level: path.Level,
-				})
 				return path.Level
 			}
 		}
 	}
-
-	var defaultLevel = LevelVerify
-	s.pathLevel = append(s.pathLevel, PathLevel{
-		Path:  currPath,
-		Level: defaultLevel,
-	})
-	return defaultLevel
+	return LevelVerify
 }
 
 func (s *BearerToken) Context(ctx *baseContext.Context) {
@@ -153,19 +196,102 @@ func (s *BearerToken) Context(ctx *baseContext.Context) {
 		return
 	}
 
-	token := ctx.GetHeader(s.TokenProperty)
-	token = strings.Replace(token, s.TokenPrefix, "", 1)
-	if err := s.Authorize.Handler(ctx, token); err != nil {
+	if err := s.authenticate(ctx); err != nil {
 		if level == LevelInfo {
 			ctx.Next()
 			return
 		}
+		if ctx.GetRejected() == "" {
+			ctx.SetRejected(baseContext.RejectedAuthorize)
+		}
 		ctx.Error(err)
 		return
 	}
 	ctx.Next()
 }
 
+// authenticate 依次尝试各scheme, 第一个验证通过的scheme记录到context和日志
+// 所有scheme都没有凭证时以空token调用第一个Authorize, 由其决定拒绝或返回访客身份
+func (s *BearerToken) authenticate(ctx *baseContext.Context) error {
+	var lastErr error
+	for _, scheme := range s.Schemes {
+		credential, ok := scheme.Credential(ctx)
+		if !ok {
+			continue
+		}
+		if lastErr = s.verify(ctx, scheme, credential); lastErr == nil {
+			ctx.Values().Set("authScheme", scheme.Name())
+			ctx.AddLogField("auth_scheme", scheme.Name())
+			if identity := authorize.GetIdentity(ctx); identity != nil && identity.Scheme == "" {
+				identity.Scheme = scheme.Name()
+			}
+			return nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = s.Schemes[0].Authorize.Handler(ctx, "")
+	}
+	return lastErr
+}
+
+// verify 验证通过后检查吊销名单, token hash记录到context供登出使用
+func (s *BearerToken) verify(ctx *baseContext.Context, scheme schemeAuthorize, credential string) error {
+	hash := HashToken(credential)
+	if err := s.authorizeToken(ctx, scheme, hash, credential); err != nil {
+		return err
+	}
+	ctx.Values().Set("tokenHash", hash)
+	if s.Denylist == nil {
+		return nil
+	}
+	revoked, err := s.Denylist.Revoked(ctx.RequestCtx(), hash, authorize.GetIdentity(ctx))
+	if err != nil {
+		authorize.SetIdentity(ctx, nil)
+		return baseError.NewSystemWrap(err)
+	}
+	if revoked {
+		authorize.SetIdentity(ctx, nil)
+		return baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "token revoked")
+	}
+	return nil
+}
+
+// authorizeToken 开启缓存时先查缓存, 命中则恢复Identity; 缓存key带scheme, 不同scheme的结果互不复用
+func (s *BearerToken) authorizeToken(ctx *baseContext.Context, scheme schemeAuthorize, hash string, credential string) error {
+	if s.Cache == nil {
+		return scheme.Authorize.Handler(ctx, credential)
+	}
+	key := cacheKey(scheme.Name(), hash)
+	if entry, ok := s.Cache.get(key); ok {
+		if entry.err != nil {
+			return cloneError(entry.err)
+		}
+		identity := cloneIdentity(entry.identity)
+		if cached, ok := scheme.Authorize.(CachedAuthorize); ok {
+			if err := cached.CacheHit(ctx, identity); err != nil {
+				return err
+			}
+		}
+		authorize.SetIdentity(ctx, identity)
+		ctx.Values().Set("authCached", true)
+		return nil
+	}
+	err := scheme.Authorize.Handler(ctx, credential)
+	if err != nil {
+		if ctx.GetRejected() == "" && cacheable(err, ctx.ErrorCodes["Unauthorized"]) {
+			s.Cache.setError(key, err)
+		}
+		return err
+	}
+	if identity := authorize.GetIdentity(ctx); identity != nil {
+		if identity.Scheme == "" {
+			identity.Scheme = scheme.Name()
+		}
+		s.Cache.setIdentity(key, identity)
+	}
+	return nil
+}
+
 func (s *BearerToken) Handler() iris.Handler {
 	return baseContext.Handler(s.Context)
 }
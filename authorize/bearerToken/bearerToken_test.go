@@ -0,0 +1,118 @@
+package bearerToken
+
+import (
+	"encoding/json"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"net/http/httptest"
+	"testing"
+)
+
+// recordAuthorize 记录收到的token, token为空时返回访客身份
+type recordAuthorize struct {
+	tokens []string
+}
+
+func (a *recordAuthorize) Handler(ctx *baseContext.Context, token string) error {
+	a.tokens = append(a.tokens, token)
+	if token == "" {
+		authorize.SetIdentity(ctx, &authorize.Identity{Subject: "guest"})
+		return nil
+	}
+	if token != "abc" {
+		return baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "invalid token")
+	}
+	authorize.SetIdentity(ctx, &authorize.Identity{Subject: "user"})
+	return nil
+}
+
+func newTestApp(t *testing.T, s *BearerToken) *iris.Application {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	app.Get("/", s.Handler(), baseContext.Handler(func(ctx *baseContext.Context) {
+		subject := ""
+		if identity := authorize.GetIdentity(ctx); identity != nil {
+			subject = identity.Subject
+		}
+		ctx.WriteString("ok:" + subject)
+	}))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// serve 通过时返回"ok:<subject>", 否则返回响应的code
+func serve(app *iris.Application, header map[string]string) string {
+	req := httptest.NewRequest("GET", "/", nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	var resp struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		return w.Body.String()
+	}
+	return resp.Code
+}
+
+func TestPrefixScheme(t *testing.T) {
+	tests := []struct {
+		authorization string
+		want          string
+		tokens        []string
+	}{
+		{"Bearer abc", "ok:user", []string{"abc"}},
+		{"bearer abc", "ok:user", []string{"abc"}},
+		{"BEARER  abc ", "ok:user", []string{"abc"}},
+		{"Bearer xyz", baseContext.ErrorUnauthorized, []string{"xyz"}},
+		//没有前缀时不提取凭证, 以空token调用Authorize
+		{"Basic xyz", "ok:guest", []string{""}},
+		{"abc", "ok:guest", []string{""}},
+		{"Bearer ", "ok:guest", []string{""}},
+		{"", "ok:guest", []string{""}},
+	}
+	for _, tt := range tests {
+		a := &recordAuthorize{}
+		app := newTestApp(t, New(a))
+		if got := serve(app, map[string]string{"Authorization": tt.authorization}); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.authorization, got, tt.want)
+		}
+		if len(a.tokens) != len(tt.tokens) || a.tokens[0] != tt.tokens[0] {
+			t.Errorf("%q: Authorize tokens = %q, want %q", tt.authorization, a.tokens, tt.tokens)
+		}
+	}
+}
+
+func TestEmptyPrefix(t *testing.T) {
+	a := &recordAuthorize{}
+	app := newTestApp(t, New(a, WithTokenProperty("X-Token"), WithTokenPrefix("")))
+	if got := serve(app, map[string]string{"X-Token": "abc"}); got != "ok:user" {
+		t.Errorf("got %s, want ok:user", got)
+	}
+}
+
+func TestHeaderScheme(t *testing.T) {
+	tests := []struct {
+		authorization string
+		want          string
+	}{
+		{"Bearer abc", "ok:user"},
+		{"bEaReR abc", "ok:user"},
+		{"Bearerabc", "ok:guest"},
+		{"Basic abc", "ok:guest"},
+	}
+	for _, tt := range tests {
+		app := newTestApp(t, New(&recordAuthorize{}, WithSchemes(NewBearerScheme())))
+		if got := serve(app, map[string]string{"Authorization": tt.authorization}); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.authorization, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package bearerToken
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CacheOption func(*CacheConfig)
+
+func defaultCacheConfig() *CacheConfig {
+	return &CacheConfig{
+		TTL:         5 * time.Minute,
+		NegativeTTL: 30 * time.Second,
+		MaxEntries:  10000,
+		Clock:       time.Now,
+	}
+}
+
+// WithCacheTTL 验证通过的缓存时间, 不超过Identity.ExpiresAt
+func WithCacheTTL(val time.Duration) CacheOption {
+	return func(opts *CacheConfig) {
+		opts.TTL = val
+	}
+}
+
+// WithCacheNegativeTTL 验证失败的缓存时间, 0表示不缓存失败结果
+func WithCacheNegativeTTL(val time.Duration) CacheOption {
+	return func(opts *CacheConfig) {
+		opts.NegativeTTL = val
+	}
+}
+func WithCacheMaxEntries(val int) CacheOption {
+	return func(opts *CacheConfig) {
+		opts.MaxEntries = val
+	}
+}
+
+// WithCacheClock 与其他组件(如introspection)计算过期时间使用同一时钟
+func WithCacheClock(val func() time.Time) CacheOption {
+	return func(opts *CacheConfig) {
+		opts.Clock = val
+	}
+}
+
+type CacheConfig struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	MaxEntries  int
+	Clock       func() time.Time
+}
+
+type CacheStats struct {
+	Hits         int64
+	Misses       int64
+	NegativeHits int64
+	Evictions    int64
+	Size         int
+}
+
+type cacheEntry struct {
+	key       string
+	identity  *authorize.Identity
+	value     interface{}
+	err       error
+	expiresAt time.Time
+}
+
+// Cache 缓存Authorize的验证结果, 以scheme和token的sha256为key, 不保存明文token
+// 按LRU淘汰, 写入和淘汰都是O(1)
+// 命中时不再调用Authorize, 依赖Authorize副作用(如按key限流)的scheme需实现CachedAuthorize
+// 命中时Identity为副本, 但Identity.Claims与缓存共享, 需作为只读使用
+func NewCache(opts ...CacheOption) *Cache {
+	config := defaultCacheConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &Cache{
+		CacheConfig: config,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+type Cache struct {
+	*CacheConfig
+	mu           sync.Mutex
+	entries      map[string]*list.Element
+	lru          *list.List
+	hits         int64
+	misses       int64
+	negativeHits int64
+	evictions    int64
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authorize的验证结果与Set写入的值使用不同前缀, 互不覆盖
+const (
+	identityKeyPrefix = "identity:"
+	valueKeyPrefix    = "value:"
+)
+
+func cacheKey(scheme string, hash string) string {
+	return identityKeyPrefix + scheme + ":" + hash
+}
+
+func (c *Cache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	var entry *cacheEntry
+	elem, ok := c.entries[key]
+	if ok {
+		entry = elem.Value.(*cacheEntry)
+		if c.Clock().Before(entry.expiresAt) {
+			c.lru.MoveToFront(elem)
+		} else {
+			c.remove(elem)
+			ok = false
+		}
+	}
+	c.mu.Unlock()
+	if !ok {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	if entry.err != nil {
+		atomic.AddInt64(&c.negativeHits, 1)
+	} else {
+		atomic.AddInt64(&c.hits, 1)
+	}
+	return entry, true
+}
+
+func (c *Cache) setIdentity(key string, identity *authorize.Identity) {
+	now := c.Clock()
+	expiresAt := now.Add(c.TTL)
+	if !identity.ExpiresAt.IsZero() && identity.ExpiresAt.Before(expiresAt) {
+		expiresAt = identity.ExpiresAt
+	}
+	if !now.Before(expiresAt) {
+		return
+	}
+	c.set(&cacheEntry{key: key, identity: cloneIdentity(identity), expiresAt: expiresAt})
+}
+
+// cloneIdentity 缓存及每次命中都使用副本, 请求修改Scopes/Roles不影响缓存
+// Claims不复制, 与缓存共享, 只读
+func cloneIdentity(identity *authorize.Identity) *authorize.Identity {
+	copied := *identity
+	copied.Scopes = append([]string(nil), identity.Scopes...)
+	copied.Roles = append([]string(nil), identity.Roles...)
+	return &copied
+}
+
+func (c *Cache) setError(key string, err error) {
+	if c.NegativeTTL <= 0 {
+		return
+	}
+	c.set(&cacheEntry{key: key, err: cloneError(err), expiresAt: c.Clock().Add(c.NegativeTTL)})
+}
+
+// cloneError 缓存及每次命中都使用副本, 避免请求修改共享的error(如SetMsg/追加Chain)
+func cloneError(err error) error {
+	var e *baseError.Error
+	if !stderrors.As(err, &e) {
+		return err
+	}
+	copied := e.Clone()
+	copied.Chain = append([]string(nil), e.Chain...)
+	return copied
+}
+
+// Get 读取Set写入的值, 供其他验证方式(如introspection)复用缓存
+func (c *Cache) Get(key string) (interface{}, bool) {
+	entry, ok := c.get(valueKeyPrefix + key)
+	if !ok {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set 缓存任意值, ttl<=0时不缓存
+func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.set(&cacheEntry{key: valueKeyPrefix + key, value: value, expiresAt: c.Clock().Add(ttl)})
+}
+
+// set 已满时淘汰最久未使用的一项
+func (c *Cache) set(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	if c.MaxEntries > 0 && c.lru.Len() >= c.MaxEntries {
+		c.remove(c.lru.Back())
+		atomic.AddInt64(&c.evictions, 1)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+}
+
+// remove 需持有锁
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// Evict 吊销token时调用
+func (c *Cache) Evict(token string) {
+	c.EvictHash(HashToken(token))
+}
+
+// EvictHash 删除所有scheme下该token的缓存, 以及Set以该hash为key写入的值
+func (c *Cache) EvictHash(hash string) {
+	c.Delete(hash)
+	c.mu.Lock()
+	for key, elem := range c.entries {
+		if strings.HasSuffix(key, ":"+hash) {
+			c.remove(elem)
+			atomic.AddInt64(&c.evictions, 1)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Delete 删除Set写入的值
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	if elem, ok := c.entries[valueKeyPrefix+key]; ok {
+		c.remove(elem)
+		atomic.AddInt64(&c.evictions, 1)
+	}
+	c.mu.Unlock()
+}
+
+// EvictIdentity 删除满足条件的缓存, 用于按subject或jti吊销
+func (c *Cache) EvictIdentity(match func(*authorize.Identity) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for _, elem := range c.entries {
+		if entry := elem.Value.(*cacheEntry); entry.identity != nil && match(entry.identity) {
+			c.remove(elem)
+			count++
+		}
+	}
+	atomic.AddInt64(&c.evictions, int64(count))
+	return count
+}
+
+func (c *Cache) EvictSubject(subject string) int {
+	return c.EvictIdentity(func(identity *authorize.Identity) bool {
+		return identity.Subject == subject
+	})
+}
+
+func (c *Cache) EvictTokenId(tokenId string) int {
+	return c.EvictIdentity(func(identity *authorize.Identity) bool {
+		return identity.TokenId == tokenId
+	})
+}
+
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.mu.Unlock()
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	size := len(c.entries)
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:         atomic.LoadInt64(&c.hits),
+		Misses:       atomic.LoadInt64(&c.misses),
+		NegativeHits: atomic.LoadInt64(&c.negativeHits),
+		Evictions:    atomic.LoadInt64(&c.evictions),
+		Size:         size,
+	}
+}
+
+// cacheable 只缓存认证失败, 系统错误(如存储不可用)不缓存
+func cacheable(err error, code string) bool {
+	var e *baseError.Error
+	if !stderrors.As(err, &e) {
+		return false
+	}
+	return !e.System && e.Code == code
+}
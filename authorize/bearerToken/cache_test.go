@@ -0,0 +1,288 @@
+package bearerToken
+
+import (
+	stderrors "errors"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func newTestCache(now *time.Time, opts ...CacheOption) *Cache {
+	return NewCache(append([]CacheOption{WithCacheClock(func() time.Time { return *now })}, opts...)...)
+}
+
+func TestCacheIdentity(t *testing.T) {
+	tests := []struct {
+		name      string
+		identity  *authorize.Identity
+		elapsed   time.Duration
+		wantFound bool
+	}{
+		{"hit", &authorize.Identity{Subject: "u1"}, time.Minute, true},
+		{"ttl", &authorize.Identity{Subject: "u1"}, 5 * time.Minute, false},
+		//TTL不超过ExpiresAt
+		{"beforeExpires", &authorize.Identity{Subject: "u1", ExpiresAt: testNow.Add(30 * time.Second)}, 29 * time.Second, true},
+		{"expires", &authorize.Identity{Subject: "u1", ExpiresAt: testNow.Add(30 * time.Second)}, 30 * time.Second, false},
+		{"expired", &authorize.Identity{Subject: "u1", ExpiresAt: testNow}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow
+			c := newTestCache(&now, WithCacheTTL(5*time.Minute))
+			key := cacheKey("bearer", HashToken("abc"))
+			c.setIdentity(key, tt.identity)
+			//缓存的是副本
+			tt.identity.Subject = "changed"
+			now = now.Add(tt.elapsed)
+			entry, ok := c.get(key)
+			if ok != tt.wantFound {
+				t.Fatalf("found = %v, want %v", ok, tt.wantFound)
+			}
+			if ok && entry.identity.Subject != "u1" {
+				t.Errorf("Subject = %s, want u1", entry.identity.Subject)
+			}
+		})
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	tests := []struct {
+		name        string
+		negativeTTL time.Duration
+		elapsed     time.Duration
+		wantFound   bool
+	}{
+		{"hit", 30 * time.Second, 29 * time.Second, true},
+		{"expired", 30 * time.Second, 30 * time.Second, false},
+		{"disabled", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow
+			c := newTestCache(&now, WithCacheNegativeTTL(tt.negativeTTL))
+			key := cacheKey("bearer", HashToken("abc"))
+			c.setError(key, baseError.NewCode(baseContext.ErrorUnauthorized, "invalid token"))
+			now = now.Add(tt.elapsed)
+			if _, ok := c.get(key); ok != tt.wantFound {
+				t.Errorf("found = %v, want %v", ok, tt.wantFound)
+			}
+			if tt.wantFound && c.Stats().NegativeHits != 1 {
+				t.Errorf("NegativeHits = %d, want 1", c.Stats().NegativeHits)
+			}
+		})
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unauthorized", baseError.NewCode(baseContext.ErrorUnauthorized, "invalid token"), true},
+		{"otherCode", baseError.NewCode(baseContext.ErrorForbidden, "forbidden"), false},
+		{"system", baseError.NewSystem("store unavailable"), false},
+		{"plain", stderrors.New("invalid token"), false},
+	}
+	for _, tt := range tests {
+		if got := cacheable(tt.err, baseContext.ErrorUnauthorized); got != tt.want {
+			t.Errorf("%s: cacheable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCloneError(t *testing.T) {
+	now := testNow
+	c := newTestCache(&now)
+	key := cacheKey("bearer", HashToken("abc"))
+	original := baseError.NewCode(baseContext.ErrorUnauthorized, "invalid token")
+	c.setError(key, original)
+	original.Msg = "changed"
+
+	entry, _ := c.get(key)
+	hit := cloneError(entry.err).(*baseError.Error)
+	hit.Msg = "request"
+	hit.Chain = append(hit.Chain, "request")
+
+	entry, _ = c.get(key)
+	cached := entry.err.(*baseError.Error)
+	if cached.Msg != "invalid token" || len(cached.Chain) != len(original.Chain) {
+		t.Errorf("cached error modified: %q %v", cached.Msg, cached.Chain)
+	}
+	if cached.Code != baseContext.ErrorUnauthorized {
+		t.Errorf("Code = %s", cached.Code)
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	now := testNow
+	c := newTestCache(&now, WithCacheMaxEntries(2))
+	a, b, d := cacheKey("bearer", "a"), cacheKey("bearer", "b"), cacheKey("bearer", "d")
+	c.setIdentity(a, &authorize.Identity{Subject: "a"})
+	c.setIdentity(b, &authorize.Identity{Subject: "b"})
+	//a最近使用, 写入d时淘汰b
+	c.get(a)
+	c.setIdentity(d, &authorize.Identity{Subject: "d"})
+	for key, want := range map[string]bool{a: true, b: false, d: true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("%s found = %v, want %v", key, ok, want)
+		}
+	}
+	//覆盖已有key不淘汰
+	c.setIdentity(a, &authorize.Identity{Subject: "a2"})
+	stats := c.Stats()
+	if stats.Size != 2 || stats.Evictions != 1 {
+		t.Errorf("Stats = %+v, want Size 2 Evictions 1", stats)
+	}
+	if entry, _ := c.get(a); entry.identity.Subject != "a2" {
+		t.Errorf("Subject = %s, want a2", entry.identity.Subject)
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	hashA, hashB := HashToken("a"), HashToken("b")
+	tests := []struct {
+		name  string
+		evict func(c *Cache) int
+		want  map[string]bool
+	}{
+		{"token", func(c *Cache) int { c.Evict("a"); return -1 }, map[string]bool{
+			cacheKey("bearer", hashA): false, cacheKey("basic", hashA): false, cacheKey("bearer", hashB): true,
+		}},
+		{"subject", func(c *Cache) int { return c.EvictSubject("u1") }, map[string]bool{
+			cacheKey("bearer", hashA): false, cacheKey("basic", hashA): false, cacheKey("bearer", hashB): true,
+		}},
+		{"tokenId", func(c *Cache) int { return c.EvictTokenId("j2") }, map[string]bool{
+			cacheKey("bearer", hashA): true, cacheKey("basic", hashA): true, cacheKey("bearer", hashB): false,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow
+			c := newTestCache(&now)
+			c.setIdentity(cacheKey("bearer", hashA), &authorize.Identity{Subject: "u1", TokenId: "j1"})
+			c.setIdentity(cacheKey("basic", hashA), &authorize.Identity{Subject: "u1", TokenId: "j1"})
+			c.setIdentity(cacheKey("bearer", hashB), &authorize.Identity{Subject: "u2", TokenId: "j2"})
+			c.setError(cacheKey("bearer", HashToken("c")), baseError.NewCode(baseContext.ErrorUnauthorized, "invalid token"))
+			count := tt.evict(c)
+			removed := 0
+			for key, want := range tt.want {
+				if _, ok := c.get(key); ok != want {
+					t.Errorf("%s found = %v, want %v", key, ok, want)
+				}
+				if !want {
+					removed++
+				}
+			}
+			if count >= 0 && count != removed {
+				t.Errorf("count = %d, want %d", count, removed)
+			}
+			//失败结果没有Identity, 不受EvictSubject/EvictTokenId影响
+			if _, ok := c.get(cacheKey("bearer", HashToken("c"))); !ok {
+				t.Error("negative entry evicted")
+			}
+		})
+	}
+}
+
+func TestCacheValue(t *testing.T) {
+	now := testNow
+	c := newTestCache(&now)
+	hash := HashToken("abc")
+	c.Set(hash, "value", time.Minute)
+	c.Set("ignored", "value", 0)
+	if v, ok := c.Get(hash); !ok || v != "value" {
+		t.Errorf("Get = %v %v", v, ok)
+	}
+	if _, ok := c.Get("ignored"); ok {
+		t.Error("ttl<=0 should not be cached")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.Get(hash); ok {
+		t.Error("value should expire")
+	}
+	c.Set(hash, "value", time.Minute)
+	c.Evict("abc")
+	if _, ok := c.Get(hash); ok {
+		t.Error("Evict should remove value")
+	}
+}
+
+// TestCacheKeyspace Set写入的值与验证结果互不覆盖
+func TestCacheKeyspace(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"hash", HashToken("abc")},
+		{"schemeKey", "bearer:" + HashToken("abc")},
+		{"cacheKey", cacheKey("bearer", HashToken("abc"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow
+			c := newTestCache(&now)
+			a := &recordAuthorize{}
+			app := newTestApp(t, New(a, WithCache(c)))
+			c.Set(tt.key, "value", time.Minute)
+			for i := 0; i < 2; i++ {
+				if got := serve(app, map[string]string{"Authorization": "Bearer abc"}); got != "ok:user" {
+					t.Errorf("got %s, want ok:user", got)
+				}
+			}
+			if len(a.tokens) != 1 {
+				t.Errorf("Authorize calls = %d, want 1", len(a.tokens))
+			}
+			if v, ok := c.Get(tt.key); !ok || v != "value" {
+				t.Errorf("Get = %v %v", v, ok)
+			}
+		})
+	}
+}
+
+// scopeAuthorize 返回带余量的Scopes, append时会写入共享的底层数组
+type scopeAuthorize struct{}
+
+func (a *scopeAuthorize) Handler(ctx *baseContext.Context, token string) error {
+	scopes := make([]string, 1, 4)
+	scopes[0] = "read"
+	authorize.SetIdentity(ctx, &authorize.Identity{Subject: "u1", Scopes: scopes, Roles: []string{"user"}})
+	return nil
+}
+
+func TestCacheIdentityCopy(t *testing.T) {
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	cache := NewCache()
+	app := iris.New()
+	app.Get("/", New(&scopeAuthorize{}, WithCache(cache)).Handler(), baseContext.Handler(func(ctx *baseContext.Context) {
+		identity := authorize.GetIdentity(ctx)
+		ctx.WriteString(strings.Join(identity.Scopes, ",") + "|" + strings.Join(identity.Roles, ","))
+		//handler修改Identity不影响之后的请求
+		identity.Scopes = append(identity.Scopes, "write")
+		identity.Scopes[0] = "admin"
+		identity.Roles[0] = "admin"
+	}))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer abc")
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		if got := w.Body.String(); got != "read|user" {
+			t.Errorf("request %d = %s, want read|user", i, got)
+		}
+	}
+	if cache.Stats().Hits != 2 {
+		t.Errorf("hits = %d, want 2", cache.Stats().Hits)
+	}
+}
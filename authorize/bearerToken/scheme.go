@@ -0,0 +1,164 @@
+package bearerToken
+
+import (
+	"encoding/base64"
+	"github.com/go-estar/iris/baseContext"
+	"strings"
+)
+
+// Scheme 从请求中提取凭证, 按配置顺序尝试
+type Scheme interface {
+	Name() string
+	Credential(ctx *baseContext.Context) (string, bool)
+}
+
+// HeaderScheme 按RFC 7235解析"<scheme> <credential>"格式的header, scheme不区分大小写; Scheme为空时取整个header值
+type HeaderScheme struct {
+	Header string
+	Scheme string
+}
+
+func NewHeaderScheme(header string, scheme string) *HeaderScheme {
+	return &HeaderScheme{Header: header, Scheme: strings.TrimSpace(scheme)}
+}
+
+func NewBearerScheme() *HeaderScheme {
+	return NewHeaderScheme("Authorization", "Bearer")
+}
+
+func (s *HeaderScheme) Name() string {
+	if s.Scheme == "" {
+		return "header:" + s.Header
+	}
+	return strings.ToLower(s.Scheme)
+}
+
+func (s *HeaderScheme) Credential(ctx *baseContext.Context) (string, bool) {
+	return parseScheme(ctx.GetHeader(s.Header), s.Scheme)
+}
+
+func parseScheme(value string, scheme string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", false
+	}
+	if scheme == "" {
+		return value, true
+	}
+	index := strings.IndexAny(value, " \t")
+	if index == -1 || !strings.EqualFold(value[:index], scheme) {
+		return "", false
+	}
+	credential := strings.TrimSpace(value[index+1:])
+	return credential, credential != ""
+}
+
+// PrefixScheme 兼容WithTokenPrefix: header值去掉字面前缀(不区分大小写, 不要求空白分隔)后作为凭证, 没有前缀时不提取; Prefix为空时取整个header值
+type PrefixScheme struct {
+	Header string
+	Prefix string
+}
+
+func NewPrefixScheme(header string, prefix string) *PrefixScheme {
+	return &PrefixScheme{Header: header, Prefix: prefix}
+}
+
+func (s *PrefixScheme) Name() string {
+	if scheme := strings.TrimSpace(s.Prefix); scheme != "" {
+		return strings.ToLower(scheme)
+	}
+	return "header:" + s.Header
+}
+
+func (s *PrefixScheme) Credential(ctx *baseContext.Context) (string, bool) {
+	value := ctx.GetHeader(s.Header)
+	if len(value) < len(s.Prefix) || !strings.EqualFold(value[:len(s.Prefix)], s.Prefix) {
+		return "", false
+	}
+	credential := strings.TrimSpace(value[len(s.Prefix):])
+	return credential, credential != ""
+}
+
+type CookieScheme struct {
+	Cookie string
+}
+
+func NewCookieScheme(cookie string) *CookieScheme {
+	return &CookieScheme{Cookie: cookie}
+}
+
+func (s *CookieScheme) Name() string {
+	return "cookie"
+}
+
+func (s *CookieScheme) Credential(ctx *baseContext.Context) (string, bool) {
+	value := ctx.GetCookie(s.Cookie)
+	return value, value != ""
+}
+
+type QueryScheme struct {
+	Param string
+}
+
+func NewQueryScheme(param string) *QueryScheme {
+	return &QueryScheme{Param: param}
+}
+
+func (s *QueryScheme) Name() string {
+	return "query"
+}
+
+func (s *QueryScheme) Credential(ctx *baseContext.Context) (string, bool) {
+	value := ctx.URLParam(s.Param)
+	return value, value != ""
+}
+
+type APIKeyScheme struct {
+	Header string
+}
+
+func NewAPIKeyScheme(header string) *APIKeyScheme {
+	return &APIKeyScheme{Header: header}
+}
+
+func (s *APIKeyScheme) Name() string {
+	return "apikey"
+}
+
+func (s *APIKeyScheme) Credential(ctx *baseContext.Context) (string, bool) {
+	return parseScheme(ctx.GetHeader(s.Header), "")
+}
+
+// BasicScheme HTTP Basic, 凭证为解码后的"username:password"
+type BasicScheme struct{}
+
+func NewBasicScheme() *BasicScheme {
+	return &BasicScheme{}
+}
+
+func (s *BasicScheme) Name() string {
+	return "basic"
+}
+
+func (s *BasicScheme) Credential(ctx *baseContext.Context) (string, bool) {
+	encoded, ok := parseScheme(ctx.GetHeader("Authorization"), "Basic")
+	if !ok {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !strings.Contains(string(decoded), ":") {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// SplitBasic 拆分BasicScheme的凭证
+func SplitBasic(credential string) (username string, password string) {
+	username, password, _ = strings.Cut(credential, ":")
+	return
+}
+
+type schemeAuthorize struct {
+	Scheme
+	Authorize
+}
@@ -0,0 +1,145 @@
+package denylist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"time"
+)
+
+var (
+	ErrorNotAuthenticated = stderrors.New("not authenticated")
+)
+
+// Store 吊销记录, 过期后自动删除
+type Store interface {
+	Add(ctx context.Context, key string, ttl time.Duration) error
+	Contains(ctx context.Context, key string) (bool, error)
+	SetSubject(ctx context.Context, subject string, before time.Time, ttl time.Duration) error
+	// SubjectBefore 未吊销时返回零值
+	SubjectBefore(ctx context.Context, subject string) (time.Time, error)
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		MaxTTL: 24 * time.Hour,
+		Clock:  time.Now,
+	}
+}
+
+// WithMaxTTL token最长有效期, 用于无过期时间的token和按subject吊销
+func WithMaxTTL(val time.Duration) Option {
+	return func(opts *Config) {
+		opts.MaxTTL = val
+	}
+}
+func WithClock(val func() time.Time) Option {
+	return func(opts *Config) {
+		opts.Clock = val
+	}
+}
+
+type Config struct {
+	MaxTTL time.Duration
+	Clock  func() time.Time
+}
+
+func New(store Store, opts ...Option) *Denylist {
+	if store == nil {
+		panic("store 必须设置")
+	}
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	if memory, ok := store.(*MemoryStore); ok {
+		memory.Clock = config.Clock
+	}
+	return &Denylist{
+		Store:  store,
+		Config: config,
+	}
+}
+
+// Denylist 实现bearerToken.Denylist, 有jti时按jti吊销, 否则按token hash
+type Denylist struct {
+	Store Store
+	*Config
+}
+
+func (d *Denylist) ttl(expiresAt time.Time) time.Duration {
+	if expiresAt.IsZero() {
+		return d.MaxTTL
+	}
+	return expiresAt.Sub(d.Clock())
+}
+
+func (d *Denylist) add(ctx context.Context, key string, expiresAt time.Time) error {
+	ttl := d.ttl(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return d.Store.Add(ctx, key, ttl)
+}
+
+// RevokeToken expiresAt为零值时保留MaxTTL
+func (d *Denylist) RevokeToken(ctx context.Context, token string, expiresAt time.Time) error {
+	sum := sha256.Sum256([]byte(token))
+	return d.RevokeTokenHash(ctx, hex.EncodeToString(sum[:]), expiresAt)
+}
+
+func (d *Denylist) RevokeTokenHash(ctx context.Context, hash string, expiresAt time.Time) error {
+	return d.add(ctx, "hash:"+hash, expiresAt)
+}
+
+func (d *Denylist) RevokeTokenId(ctx context.Context, tokenId string, expiresAt time.Time) error {
+	return d.add(ctx, "jti:"+tokenId, expiresAt)
+}
+
+// RevokeSubject 吊销subject在before之前签发的全部token, 无签发时间的token也视为吊销
+func (d *Denylist) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	return d.Store.SetSubject(ctx, subject, before, d.MaxTTL)
+}
+
+// Logout 吊销当前请求使用的token, 需在bearerToken之后调用
+func (d *Denylist) Logout(ctx *baseContext.Context) error {
+	identity := authorize.GetIdentity(ctx)
+	if identity == nil {
+		return ErrorNotAuthenticated
+	}
+	if identity.TokenId != "" {
+		return d.RevokeTokenId(ctx.RequestCtx(), identity.TokenId, identity.ExpiresAt)
+	}
+	hash := ctx.Values().GetString("tokenHash")
+	if hash == "" {
+		return ErrorNotAuthenticated
+	}
+	return d.RevokeTokenHash(ctx.RequestCtx(), hash, identity.ExpiresAt)
+}
+
+func (d *Denylist) Revoked(ctx context.Context, tokenHash string, identity *authorize.Identity) (bool, error) {
+	if revoked, err := d.Store.Contains(ctx, "hash:"+tokenHash); err != nil || revoked {
+		return revoked, err
+	}
+	if identity == nil {
+		return false, nil
+	}
+	if identity.TokenId != "" {
+		if revoked, err := d.Store.Contains(ctx, "jti:"+identity.TokenId); err != nil || revoked {
+			return revoked, err
+		}
+	}
+	if identity.Subject == "" {
+		return false, nil
+	}
+	before, err := d.Store.SubjectBefore(ctx, identity.Subject)
+	if err != nil || before.IsZero() {
+		return false, err
+	}
+	return identity.IssuedAt.IsZero() || identity.IssuedAt.Before(before), nil
+}
@@ -0,0 +1,162 @@
+package denylist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-estar/iris/authorize"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func newTestDenylist(now *time.Time) *Denylist {
+	return New(NewMemoryStore(), WithMaxTTL(time.Hour), WithClock(func() time.Time { return *now }))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRevokeToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		elapsed   time.Duration
+		want      bool
+	}{
+		{"revoked", testNow.Add(time.Minute), 59 * time.Second, true},
+		//记录保留到token过期
+		{"expired", testNow.Add(time.Minute), time.Minute, false},
+		//已过期的token不写入
+		{"alreadyExpired", testNow, 0, false},
+		//无过期时间时保留MaxTTL
+		{"maxTTL", time.Time{}, 59 * time.Minute, true},
+		{"maxTTLExpired", time.Time{}, time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow
+			d := newTestDenylist(&now)
+			ctx := context.Background()
+			if err := d.RevokeToken(ctx, "abc", tt.expiresAt); err != nil {
+				t.Fatal(err)
+			}
+			now = now.Add(tt.elapsed)
+			revoked, err := d.Revoked(ctx, hashToken("abc"), &authorize.Identity{Subject: "u1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked != tt.want {
+				t.Errorf("Revoked() = %v, want %v", revoked, tt.want)
+			}
+			if revoked, _ := d.Revoked(ctx, hashToken("other"), nil); revoked {
+				t.Error("other token revoked")
+			}
+		})
+	}
+}
+
+func TestRevokeTokenId(t *testing.T) {
+	now := testNow
+	d := newTestDenylist(&now)
+	ctx := context.Background()
+	if err := d.RevokeTokenId(ctx, "j1", testNow.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		identity *authorize.Identity
+		want     bool
+	}{
+		{"jti", &authorize.Identity{Subject: "u1", TokenId: "j1"}, true},
+		{"otherJti", &authorize.Identity{Subject: "u1", TokenId: "j2"}, false},
+		{"noJti", &authorize.Identity{Subject: "u1"}, false},
+		{"noIdentity", nil, false},
+	}
+	for _, tt := range tests {
+		revoked, err := d.Revoked(ctx, hashToken("abc"), tt.identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != tt.want {
+			t.Errorf("%s: Revoked() = %v, want %v", tt.name, revoked, tt.want)
+		}
+	}
+	now = testNow.Add(time.Minute)
+	if revoked, _ := d.Revoked(ctx, hashToken("abc"), &authorize.Identity{TokenId: "j1"}); revoked {
+		t.Error("jti should expire with the token")
+	}
+}
+
+func TestRevokeSubject(t *testing.T) {
+	now := testNow
+	d := newTestDenylist(&now)
+	ctx := context.Background()
+	before := testNow.Add(-time.Minute)
+	if err := d.RevokeSubject(ctx, "u1", before); err != nil {
+		t.Fatal(err)
+	}
+	//更早的时间不覆盖
+	if err := d.RevokeSubject(ctx, "u1", before.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		identity *authorize.Identity
+		want     bool
+	}{
+		{"issuedBefore", &authorize.Identity{Subject: "u1", IssuedAt: before.Add(-time.Second)}, true},
+		{"issuedAt", &authorize.Identity{Subject: "u1", IssuedAt: before}, false},
+		{"issuedAfter", &authorize.Identity{Subject: "u1", IssuedAt: before.Add(time.Second)}, false},
+		//无签发时间视为吊销
+		{"noIssuedAt", &authorize.Identity{Subject: "u1"}, true},
+		{"otherSubject", &authorize.Identity{Subject: "u2"}, false},
+		{"noSubject", &authorize.Identity{}, false},
+	}
+	for _, tt := range tests {
+		revoked, err := d.Revoked(ctx, hashToken("abc"), tt.identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != tt.want {
+			t.Errorf("%s: Revoked() = %v, want %v", tt.name, revoked, tt.want)
+		}
+	}
+
+	//按subject吊销保留MaxTTL, 使用Denylist的时钟
+	now = testNow.Add(59 * time.Minute)
+	if revoked, _ := d.Revoked(ctx, hashToken("abc"), &authorize.Identity{Subject: "u1"}); !revoked {
+		t.Error("subject should be revoked before MaxTTL")
+	}
+	now = testNow.Add(time.Hour)
+	if revoked, _ := d.Revoked(ctx, hashToken("abc"), &authorize.Identity{Subject: "u1"}); revoked {
+		t.Error("subject should expire after MaxTTL")
+	}
+}
+
+func TestMemoryStoreClock(t *testing.T) {
+	now := testNow
+	store := NewMemoryStore()
+	New(store, WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+	if err := store.Add(ctx, "a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.Contains(ctx, "a"); !ok {
+		t.Error("Contains() = false, want true")
+	}
+	now = now.Add(time.Minute)
+	if ok, _ := store.Contains(ctx, "a"); ok {
+		t.Error("Contains() after ttl = true, want false")
+	}
+	//写入时清理过期记录
+	if err := store.Add(ctx, "b", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.keys["a"]; ok {
+		t.Error("expired key not cleaned up")
+	}
+}
@@ -0,0 +1,131 @@
+package denylist
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys:     make(map[string]time.Time),
+		subjects: make(map[string]memorySubject),
+		Clock:    time.Now,
+	}
+}
+
+type memorySubject struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+// MemoryStore 单实例使用, 写入时清理过期记录; 传给New时Clock与Denylist使用同一时钟
+type MemoryStore struct {
+	mu       sync.RWMutex
+	keys     map[string]time.Time
+	subjects map[string]memorySubject
+	Clock    func() time.Time
+}
+
+func (s *MemoryStore) Add(ctx context.Context, key string, ttl time.Duration) error {
+	now := s.Clock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanup(now)
+	s.keys[key] = now.Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) Contains(ctx context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expiresAt, ok := s.keys[key]
+	return ok && s.Clock().Before(expiresAt), nil
+}
+
+func (s *MemoryStore) SetSubject(ctx context.Context, subject string, before time.Time, ttl time.Duration) error {
+	now := s.Clock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanup(now)
+	if curr, ok := s.subjects[subject]; ok && curr.before.After(before) {
+		before = curr.before
+	}
+	s.subjects[subject] = memorySubject{before: before, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) SubjectBefore(ctx context.Context, subject string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	curr, ok := s.subjects[subject]
+	if !ok || !s.Clock().Before(curr.expiresAt) {
+		return time.Time{}, nil
+	}
+	return curr.before, nil
+}
+
+func (s *MemoryStore) cleanup(now time.Time) {
+	for key, expiresAt := range s.keys {
+		if !now.Before(expiresAt) {
+			delete(s.keys, key)
+		}
+	}
+	for subject, curr := range s.subjects {
+		if !now.Before(curr.expiresAt) {
+			delete(s.subjects, subject)
+		}
+	}
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if client == nil {
+		panic("client 必须设置")
+	}
+	return &RedisStore{Client: client, Prefix: prefix}
+}
+
+// RedisStore token: prefix+"revoked:"+key, subject: prefix+"subject:"+subject, 值为unix毫秒
+type RedisStore struct {
+	Client *redis.Client
+	Prefix string
+}
+
+// setMax 只在新时间更晚时覆盖
+var setMax = redis.NewScript(`
+local curr = tonumber(redis.call("GET", KEYS[1]) or "0")
+local val = tonumber(ARGV[1])
+if val > curr then curr = val end
+redis.call("SET", KEYS[1], curr, "PX", ARGV[2])
+return curr
+`)
+
+func (s *RedisStore) Add(ctx context.Context, key string, ttl time.Duration) error {
+	return s.Client.Set(ctx, s.Prefix+"revoked:"+key, 1, ttl).Err()
+}
+
+func (s *RedisStore) Contains(ctx context.Context, key string) (bool, error) {
+	n, err := s.Client.Exists(ctx, s.Prefix+"revoked:"+key).Result()
+	return n > 0, err
+}
+
+func (s *RedisStore) SetSubject(ctx context.Context, subject string, before time.Time, ttl time.Duration) error {
+	return setMax.Run(ctx, s.Client, []string{s.Prefix + "subject:" + subject}, before.UnixMilli(), ttl.Milliseconds()).Err()
+}
+
+func (s *RedisStore) SubjectBefore(ctx context.Context, subject string) (time.Time, error) {
+	val, err := s.Client.Get(ctx, s.Prefix+"subject:"+subject).Result()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
@@ -0,0 +1,52 @@
+package authorize
+
+import (
+	"github.com/go-estar/iris/baseContext"
+	"github.com/thoas/go-funk"
+	"time"
+)
+
+// Identity 由Authorize写入context的认证结果, 供权限/审计/日志使用
+type Identity struct {
+	Subject   string
+	TokenId   string
+	Scheme    string
+	Scopes    []string
+	Roles     []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Claims    interface{}
+}
+
+func (i *Identity) HasScope(scope string) bool {
+	return funk.ContainsString(i.Scopes, scope)
+}
+
+func (i *Identity) HasRole(role string) bool {
+	return funk.ContainsString(i.Roles, role)
+}
+
+func (i *Identity) HasAnyRole(roles ...string) bool {
+	for _, role := range roles {
+		if i.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func SetIdentity(ctx *baseContext.Context, identity *Identity) {
+	ctx.Values().Set("identity", identity)
+	if identity != nil && identity.Subject != "" {
+		ctx.AddLogField("subject", identity.Subject)
+	}
+}
+
+func GetIdentity(ctx *baseContext.Context) *Identity {
+	if v := ctx.Values().Get("identity"); v != nil {
+		if identity, ok := v.(*Identity); ok {
+			return identity
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/authorize/bearerToken"
+	"github.com/go-estar/iris/baseContext"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorInactive = stderrors.New("token inactive")
+	ErrorExpired  = stderrors.New("token expired")
+)
+
+// maxResponseSize introspection响应的最大字节数
+const maxResponseSize = 1 << 20
+
+type AuthMethod int
+
+const (
+	// AuthMethodBasic client_secret_basic
+	AuthMethodBasic AuthMethod = iota
+	// AuthMethodPost client_secret_post
+	AuthMethodPost
+)
+
+// Response RFC 7662 2.2, 其余字段保存在Extra
+type Response struct {
+	Active    bool                   `json:"active"`
+	Scope     string                 `json:"scope,omitempty"`
+	ClientId  string                 `json:"client_id,omitempty"`
+	Username  string                 `json:"username,omitempty"`
+	TokenType string                 `json:"token_type,omitempty"`
+	Exp       int64                  `json:"exp,omitempty"`
+	Iat       int64                  `json:"iat,omitempty"`
+	Nbf       int64                  `json:"nbf,omitempty"`
+	Sub       string                 `json:"sub,omitempty"`
+	Aud       interface{}            `json:"aud,omitempty"`
+	Iss       string                 `json:"iss,omitempty"`
+	Jti       string                 `json:"jti,omitempty"`
+	Extra     map[string]interface{} `json:"-"`
+}
+
+func (r *Response) UnmarshalJSON(data []byte) error {
+	type response Response
+	if err := json.Unmarshal(data, (*response)(r)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &r.Extra)
+}
+
+func (r *Response) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+func (r *Response) Identity() *authorize.Identity {
+	identity := &authorize.Identity{
+		Subject: r.Sub,
+		TokenId: r.Jti,
+		Scopes:  r.Scopes(),
+		Claims:  r,
+	}
+	if identity.Subject == "" {
+		identity.Subject = r.Username
+	}
+	if r.Iat > 0 {
+		identity.IssuedAt = time.Unix(r.Iat, 0)
+	}
+	if r.Exp > 0 {
+		identity.ExpiresAt = time.Unix(r.Exp, 0)
+	}
+	if roles, ok := r.Extra["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if v, ok := role.(string); ok {
+				identity.Roles = append(identity.Roles, v)
+			}
+		}
+	}
+	return identity
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		TokenHint:   "access_token",
+		CacheTTL:    time.Minute,
+		NegativeTTL: 10 * time.Second,
+		MaxEntries:  10000,
+		Clock:       time.Now,
+	}
+}
+
+func WithClient(val *http.Client) Option {
+	return func(opts *Config) {
+		opts.Client = val
+	}
+}
+func WithAuthMethod(val AuthMethod) Option {
+	return func(opts *Config) {
+		opts.AuthMethod = val
+	}
+}
+func WithTokenHint(val string) Option {
+	return func(opts *Config) {
+		opts.TokenHint = val
+	}
+}
+
+// WithCacheTTL active结果的缓存时间, 不超过exp; 0表示不缓存
+func WithCacheTTL(val time.Duration) Option {
+	return func(opts *Config) {
+		opts.CacheTTL = val
+	}
+}
+
+// WithNegativeTTL inactive结果的缓存时间; 0表示不缓存
+func WithNegativeTTL(val time.Duration) Option {
+	return func(opts *Config) {
+		opts.NegativeTTL = val
+	}
+}
+
+// WithCacheMaxEntries 缓存的最大条数, 超出时按LRU淘汰
+func WithCacheMaxEntries(val int) Option {
+	return func(opts *Config) {
+		opts.MaxEntries = val
+	}
+}
+func WithClock(val func() time.Time) Option {
+	return func(opts *Config) {
+		opts.Clock = val
+	}
+}
+
+type Config struct {
+	Client      *http.Client
+	AuthMethod  AuthMethod
+	TokenHint   string
+	CacheTTL    time.Duration
+	NegativeTTL time.Duration
+	MaxEntries  int
+	Clock       func() time.Time
+}
+
+func New(endpoint string, clientId string, clientSecret string, opts ...Option) *Introspection {
+	if endpoint == "" {
+		panic("endpoint 必须设置")
+	}
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &Introspection{
+		Endpoint:     endpoint,
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Config:       config,
+		Cache:        bearerToken.NewCache(bearerToken.WithCacheMaxEntries(config.MaxEntries), bearerToken.WithCacheClock(config.Clock)),
+	}
+}
+
+// Introspection 实现bearerToken.Authorize, 用于不透明token
+type Introspection struct {
+	Endpoint     string
+	ClientId     string
+	ClientSecret string
+	*Config
+	Cache *bearerToken.Cache
+}
+
+// Introspect 请求introspection endpoint, 优先使用缓存
+func (i *Introspection) Introspect(ctx context.Context, token string) (*Response, error) {
+	key := bearerToken.HashToken(token)
+	if v, ok := i.Cache.Get(key); ok {
+		return v.(*Response), nil
+	}
+
+	response, err := i.request(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	i.store(key, response, i.Clock())
+	return response, nil
+}
+
+func (i *Introspection) request(ctx context.Context, token string) (*Response, error) {
+	form := url.Values{"token": {token}}
+	if i.TokenHint != "" {
+		form.Set("token_type_hint", i.TokenHint)
+	}
+	if i.AuthMethod == AuthMethodPost {
+		form.Set("client_id", i.ClientId)
+		form.Set("client_secret", i.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.AuthMethod == AuthMethodBasic {
+		req.SetBasicAuth(url.QueryEscape(i.ClientId), url.QueryEscape(i.ClientSecret))
+	}
+	resp, err := i.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection %s: status %d", i.Endpoint, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("introspection %s: response exceeds %d bytes", i.Endpoint, maxResponseSize)
+	}
+	response := &Response{}
+	if err := json.Unmarshal(data, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (i *Introspection) store(key string, response *Response, now time.Time) {
+	ttl := i.NegativeTTL
+	if response.Active {
+		ttl = i.CacheTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	if response.Exp > 0 {
+		if untilExp := time.Unix(response.Exp, 0).Sub(now); untilExp < ttl {
+			ttl = untilExp
+		}
+	}
+	i.Cache.Set(key, response, ttl)
+}
+
+// Evict 吊销token时调用
+func (i *Introspection) Evict(token string) {
+	i.Cache.EvictHash(bearerToken.HashToken(token))
+}
+
+func (i *Introspection) Handler(ctx *baseContext.Context, token string) error {
+	if token == "" {
+		return baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "missing token")
+	}
+	response, err := i.Introspect(ctx.RequestCtx(), token)
+	if err != nil {
+		return baseError.NewSystemWrap(err)
+	}
+	if !response.Active {
+		return baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], ErrorInactive)
+	}
+	// 服务端已判断, 这里防止缓存期间过期
+	now := i.Clock()
+	if response.Exp > 0 && !now.Before(time.Unix(response.Exp, 0)) {
+		return baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], ErrorExpired)
+	}
+	identity := response.Identity()
+	identity.Scheme = "introspection"
+	authorize.SetIdentity(ctx, identity)
+	return nil
+}
+
+// GetResponse 返回当前请求的introspection结果
+func GetResponse(ctx *baseContext.Context) *Response {
+	if identity := authorize.GetIdentity(ctx); identity != nil {
+		if response, ok := identity.Claims.(*Response); ok {
+			return response
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/authorize/bearerToken"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+// server 本地introspection endpoint, 记录请求次数, respond返回状态码和响应
+type server struct {
+	*httptest.Server
+	requests int32
+	forms    chan map[string]string
+}
+
+func newServer(t *testing.T, respond func(token string) (int, string)) *server {
+	t.Helper()
+	s := &server{forms: make(chan map[string]string, 100)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		form := map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		if user, pass, ok := r.BasicAuth(); ok {
+			form["basic"] = user + ":" + pass
+		}
+		s.forms <- form
+		status, body := respond(r.PostForm.Get("token"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func active(token string) (int, string) {
+	if token != "valid" {
+		return http.StatusOK, `{"active":false}`
+	}
+	return http.StatusOK, `{"active":true,"sub":"u1","scope":"read write","jti":"j1","exp":1700000030,"roles":["admin"]}`
+}
+
+func clock(now *time.Time) func() time.Time {
+	return func() time.Time { return *now }
+}
+
+func TestClientAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		method AuthMethod
+		want   map[string]string
+	}{
+		{"basic", AuthMethodBasic, map[string]string{"basic": "client:s%3Acret", "token": "valid", "token_type_hint": "access_token"}},
+		{"post", AuthMethodPost, map[string]string{"client_id": "client", "client_secret": "s:cret", "token": "valid", "token_type_hint": "access_token"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, active)
+			now := testNow
+			i := New(s.URL, "client", "s:cret", WithAuthMethod(tt.method), WithClock(clock(&now)))
+			response, err := i.Introspect(context.Background(), "valid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !response.Active || response.Sub != "u1" {
+				t.Errorf("response = %+v", response)
+			}
+			form := <-s.forms
+			if len(form) != len(tt.want) {
+				t.Errorf("form = %v, want %v", form, tt.want)
+			}
+			for k, v := range tt.want {
+				if form[k] != v {
+					t.Errorf("form[%s] = %q, want %q", k, form[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := newServer(t, active)
+	now := testNow
+	i := New(s.URL, "client", "secret", WithClock(clock(&now)))
+
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	app.Get("/", baseContext.Handler(func(ctx *baseContext.Context) {
+		if err := i.Handler(ctx, ctx.URLParam("token")); err != nil {
+			ctx.Error(err)
+			return
+		}
+		identity := authorize.GetIdentity(ctx)
+		ctx.WriteString(identity.Subject + ":" + strings.Join(identity.Scopes, ",") + ":" + strings.Join(identity.Roles, ","))
+	}))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(token string) string {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/?token="+token, nil))
+		var resp struct {
+			Code string `json:"code"`
+		}
+		if json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+			return w.Body.String()
+		}
+		return resp.Code
+	}
+
+	if got := serve("valid"); got != "u1:read,write:admin" {
+		t.Errorf("valid = %s", got)
+	}
+	if got := serve("revoked"); got != baseContext.ErrorUnauthorized {
+		t.Errorf("inactive = %s, want %s", got, baseContext.ErrorUnauthorized)
+	}
+	if got := serve(""); got != baseContext.ErrorUnauthorized {
+		t.Errorf("missing = %s, want %s", got, baseContext.ErrorUnauthorized)
+	}
+	//缓存期间过期的token也被拒绝
+	now = testNow.Add(31 * time.Second)
+	i.Cache.Set(bearerToken.HashToken("valid"), &Response{Active: true, Sub: "u1", Exp: 1700000030}, time.Minute)
+	if got := serve("valid"); got != baseContext.ErrorUnauthorized {
+		t.Errorf("expired = %s, want %s", got, baseContext.ErrorUnauthorized)
+	}
+}
+
+func TestCache(t *testing.T) {
+	s := newServer(t, active)
+	now := testNow
+	i := New(s.URL, "client", "secret", WithClock(clock(&now)), WithCacheTTL(time.Minute), WithNegativeTTL(10*time.Second))
+	introspect := func(token string) *Response {
+		t.Helper()
+		response, err := i.Introspect(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	introspect("valid")
+	introspect("valid")
+	if got := atomic.LoadInt32(&s.requests); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+	//TTL为1分钟, 但exp在30秒后, 缓存不超过exp
+	now = testNow.Add(30 * time.Second)
+	introspect("valid")
+	if got := atomic.LoadInt32(&s.requests); got != 2 {
+		t.Errorf("requests after exp = %d, want 2", got)
+	}
+
+	//inactive按NegativeTTL缓存
+	now = testNow
+	if introspect("revoked").Active {
+		t.Error("revoked should be inactive")
+	}
+	introspect("revoked")
+	if got := atomic.LoadInt32(&s.requests); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+	now = testNow.Add(10 * time.Second)
+	introspect("revoked")
+	if got := atomic.LoadInt32(&s.requests); got != 4 {
+		t.Errorf("requests after negative ttl = %d, want 4", got)
+	}
+
+	i.Evict("revoked")
+	introspect("revoked")
+	if got := atomic.LoadInt32(&s.requests); got != 5 {
+		t.Errorf("requests after evict = %d, want 5", got)
+	}
+}
+
+func TestResponseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"status", http.StatusUnauthorized, `{"error":"invalid_client"}`},
+		{"serverError", http.StatusInternalServerError, ``},
+		{"invalidJSON", http.StatusOK, `{"active":`},
+		{"tooLarge", http.StatusOK, `{"active":true,"sub":"` + strings.Repeat("a", maxResponseSize) + `"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, func(string) (int, string) { return tt.status, tt.body })
+			i := New(s.URL, "client", "secret")
+			if response, err := i.Introspect(context.Background(), "valid"); err == nil {
+				t.Errorf("Introspect() = %+v, want error", response)
+			}
+			//失败不缓存
+			_, _ = i.Introspect(context.Background(), "valid")
+			if got := atomic.LoadInt32(&s.requests); got != 2 {
+				t.Errorf("requests = %d, want 2", got)
+			}
+		})
+	}
+
+	//恰好1MB的响应可以解析
+	body := `{"active":true,"sub":"` + strings.Repeat("a", maxResponseSize-len(`{"active":true,"sub":""}`)) + `"}`
+	s := newServer(t, func(string) (int, string) { return http.StatusOK, body })
+	if _, err := New(s.URL, "client", "secret").Introspect(context.Background(), "valid"); err != nil {
+		t.Errorf("Introspect(1MB) = %v", err)
+	}
+}
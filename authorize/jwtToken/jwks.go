@@ -0,0 +1,377 @@
+package jwtToken
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorAlgorithmMismatch = stderrors.New("algorithm mismatch")
+	ErrorNoUsableKey       = stderrors.New("no usable key in jwks")
+	ErrorRemoteSymmetric   = stderrors.New("symmetric key not allowed from remote jwks")
+)
+
+// minRSAKeySize RSA公钥模数的最小位数
+const minRSAKeySize = 2048
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type webKey struct {
+	key interface{}
+	alg string
+}
+
+// ParseJWKS 解析本地JWKS, 支持RSA/EC/OKP(Ed25519)/oct, 忽略use非sig及不支持/无法解析的key, 没有可用key时返回错误
+func ParseJWKS(data []byte) (Keys, error) {
+	keys, err := parseJWKS(data, true)
+	if err != nil {
+		return nil, err
+	}
+	result := make(Keys, len(keys))
+	for kid, k := range keys {
+		result[kid] = k.key
+	}
+	return result, nil
+}
+
+// NewFileKeys 从JWKS文件加载key, 用于测试和离线环境
+func NewFileKeys(path string) (Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// parseJWKS symmetric为false时跳过oct key, 远程JWKS中的对称key可被读取者用来签发token
+func parseJWKS(data []byte, symmetric bool) (map[string]*webKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*webKey, len(set.Keys))
+	//跳过不支持的key, 避免IdP新增其他类型的key时整个JWKS不可用
+	var skipped error
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if jwk.Kty == "oct" && !symmetric {
+			skipped = fmt.Errorf("jwk %q: %w", jwk.Kid, ErrorRemoteSymmetric)
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			skipped = fmt.Errorf("jwk %q: %w", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = &webKey{key: key, alg: jwk.Alg}
+	}
+	if len(keys) == 0 {
+		if skipped != nil {
+			return nil, fmt.Errorf("%w: %s", ErrorNoUsableKey, skipped)
+		}
+		return nil, ErrorNoUsableKey
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < minRSAKeySize {
+			return nil, fmt.Errorf("rsa key size %d less than %d", n.BitLen(), minRSAKeySize)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, stderrors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, stderrors.New("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	default:
+		return nil, fmt.Errorf("unsupported kty %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+type JWKSOption func(*JWKSConfig)
+
+func defaultJWKSConfig() *JWKSConfig {
+	return &JWKSConfig{
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		TTL:                time.Hour,
+		RefreshInterval:    15 * time.Minute,
+		MinRefetchInterval: time.Minute,
+	}
+}
+
+func WithJWKSClient(val *http.Client) JWKSOption {
+	return func(opts *JWKSConfig) {
+		opts.Client = val
+	}
+}
+
+// WithJWKSTTL 缓存有效期, 过期后继续使用旧key并在后台刷新
+func WithJWKSTTL(val time.Duration) JWKSOption {
+	return func(opts *JWKSConfig) {
+		opts.TTL = val
+	}
+}
+
+// WithJWKSRefreshInterval 后台刷新间隔, 0不启用
+func WithJWKSRefreshInterval(val time.Duration) JWKSOption {
+	return func(opts *JWKSConfig) {
+		opts.RefreshInterval = val
+	}
+}
+
+// WithJWKSMinRefetchInterval 遇到未知kid时两次请求的最小间隔, 防止被伪造kid打爆
+func WithJWKSMinRefetchInterval(val time.Duration) JWKSOption {
+	return func(opts *JWKSConfig) {
+		opts.MinRefetchInterval = val
+	}
+}
+
+// WithJWKSErrorHandler 后台刷新(定时及过期后)失败回调
+func WithJWKSErrorHandler(val func(error)) JWKSOption {
+	return func(opts *JWKSConfig) {
+		opts.ErrorHandler = val
+	}
+}
+
+type JWKSConfig struct {
+	Client             *http.Client
+	TTL                time.Duration
+	RefreshInterval    time.Duration
+	MinRefetchInterval time.Duration
+	ErrorHandler       func(error)
+}
+
+// NewJWKS 从url获取key set并缓存, 首次获取失败返回error; 远程JWKS只使用非对称key, 忽略oct
+func NewJWKS(url string, opts ...JWKSOption) (*JWKS, error) {
+	if url == "" {
+		panic("url 必须设置")
+	}
+	config := defaultJWKSConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	j := &JWKS{
+		URL:        url,
+		JWKSConfig: config,
+		stop:       make(chan struct{}),
+	}
+	if err := j.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	if config.RefreshInterval > 0 {
+		go j.refreshLoop()
+	}
+	return j, nil
+}
+
+type JWKS struct {
+	URL string
+	*JWKSConfig
+	mu        sync.RWMutex
+	keys      map[string]*webKey
+	fetchedAt time.Time
+	fetchMu   sync.Mutex
+	lastFetch time.Time
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+func (j *JWKS) Key(kid string, alg string) (interface{}, error) {
+	key, fresh := j.lookup(kid)
+	if key != nil && !fresh {
+		//过期的key继续使用, 后台刷新, 不阻塞请求
+		go j.refreshStale()
+	}
+	if key == nil {
+		if err := j.refetch(); err != nil {
+			return nil, err
+		}
+		if key, _ = j.lookup(kid); key == nil {
+			return nil, ErrorKeyNotFound
+		}
+	}
+	if key.alg != "" && alg != "" && key.alg != alg {
+		return nil, ErrorAlgorithmMismatch
+	}
+	return key.key, nil
+}
+
+func (j *JWKS) lookup(kid string) (*webKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	fresh := j.TTL <= 0 || time.Since(j.fetchedAt) < j.TTL
+	if key, ok := j.keys[kid]; ok {
+		return key, fresh
+	}
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, fresh
+		}
+	}
+	return nil, fresh
+}
+
+// refetch 按MinRefetchInterval限流的刷新
+func (j *JWKS) refetch() error {
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+	if time.Since(j.lastFetch) < j.MinRefetchInterval {
+		return nil
+	}
+	return j.fetch(context.Background())
+}
+
+// refreshStale 已有刷新在进行时直接返回, 避免每个请求都启动刷新
+func (j *JWKS) refreshStale() {
+	if !j.fetchMu.TryLock() {
+		return
+	}
+	defer j.fetchMu.Unlock()
+	if time.Since(j.lastFetch) < j.MinRefetchInterval {
+		return
+	}
+	if err := j.fetch(context.Background()); err != nil && j.ErrorHandler != nil {
+		j.ErrorHandler(err)
+	}
+}
+
+// Refresh 立即刷新key set
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+	return j.fetch(ctx)
+}
+
+func (j *JWKS) fetch(ctx context.Context) error {
+	j.lastFetch = time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := j.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks %s: status %d", j.URL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data, false)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+	return nil
+}
+
+func (j *JWKS) refreshLoop() {
+	ticker := time.NewTicker(j.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := j.Refresh(context.Background()); err != nil && j.ErrorHandler != nil {
+				j.ErrorHandler(err)
+			}
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// Close 停止后台刷新
+func (j *JWKS) Close() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+	})
+}
@@ -0,0 +1,222 @@
+package jwtToken
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func rsaJWK(kid string, alg string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{Kty: "RSA", Kid: kid, Alg: alg, N: encodeBigInt(key.N), E: encodeBigInt(big.NewInt(int64(key.E)))}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) jsonWebKey {
+	return jsonWebKey{Kty: "EC", Kid: kid, Crv: "P-256", X: encodeBigInt(key.X), Y: encodeBigInt(key.Y)}
+}
+
+func okpJWK(kid string, key ed25519.PublicKey) jsonWebKey {
+	return jsonWebKey{Kty: "OKP", Kid: kid, Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(key)}
+}
+
+func octJWK(kid string, key []byte) jsonWebKey {
+	return jsonWebKey{Kty: "oct", Kid: kid, K: base64.RawURLEncoding.EncodeToString(key)}
+}
+
+func marshalJWKS(t *testing.T, keys ...jsonWebKey) []byte {
+	t.Helper()
+	data, err := json.Marshal(jsonWebKeySet{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	k := newTestKeys(t)
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offCurve := ecJWK("bad", &k.ecdsa.PublicKey)
+	offCurve.Y = encodeBigInt(big.NewInt(1))
+	enc := rsaJWK("enc", "", &k.rsa.PublicKey)
+	enc.Use = "enc"
+
+	tests := []struct {
+		name     string
+		keys     []jsonWebKey
+		wantKids []string
+		wantErr  error
+	}{
+		{"all", []jsonWebKey{rsaJWK("rs", "RS256", &k.rsa.PublicKey), ecJWK("es", &k.ecdsa.PublicKey), okpJWK("ed", k.ed25519.Public().(ed25519.PublicKey)), octJWK("hs", k.hmac)}, []string{"rs", "es", "ed", "hs"}, nil},
+		//RSA小于2048位时跳过
+		{"smallRSA", []jsonWebKey{rsaJWK("small", "RS256", &small.PublicKey), rsaJWK("rs", "RS256", &k.rsa.PublicKey)}, []string{"rs"}, nil},
+		{"onlySmallRSA", []jsonWebKey{rsaJWK("small", "RS256", &small.PublicKey)}, nil, ErrorNoUsableKey},
+		{"offCurve", []jsonWebKey{offCurve}, nil, ErrorNoUsableKey},
+		{"encryptionKey", []jsonWebKey{enc, ecJWK("es", &k.ecdsa.PublicKey)}, []string{"es"}, nil},
+		{"unsupported", []jsonWebKey{{Kty: "XYZ", Kid: "x"}, ecJWK("es", &k.ecdsa.PublicKey)}, []string{"es"}, nil},
+		{"empty", nil, nil, ErrorNoUsableKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseJWKS(marshalJWKS(t, tt.keys...))
+			if !stderrors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseJWKS() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(keys) != len(tt.wantKids) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKids)
+			}
+			for _, kid := range tt.wantKids {
+				if _, ok := keys[kid]; !ok {
+					t.Errorf("missing kid %s", kid)
+				}
+			}
+		})
+	}
+}
+
+// jwksServer 可替换key set, 记录请求次数
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	data     []byte
+	requests int32
+}
+
+func newJWKSServer(t *testing.T, data []byte) *jwksServer {
+	t.Helper()
+	s := &jwksServer{data: data}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, _ = w.Write(s.data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(data []byte) {
+	s.mu.Lock()
+	s.data = data
+	s.mu.Unlock()
+}
+
+func TestJWKS(t *testing.T) {
+	k := newTestKeys(t)
+	s := newJWKSServer(t, marshalJWKS(t, rsaJWK("rs", "RS256", &k.rsa.PublicKey), octJWK("hs", k.hmac)))
+	jwks, err := NewJWKS(s.URL, WithJWKSRefreshInterval(0), WithJWKSMinRefetchInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jwks.Close()
+	now := testNow
+	j := New(jwks, clock(&now), WithAlgorithms("RS256", "RS384", "HS256"))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"valid", sign(t, jwt.SigningMethodRS256, "rs", k.rsa, testClaims()), nil},
+		//jwk声明了alg时token必须使用该alg
+		{"algMismatch", sign(t, jwt.SigningMethodRS384, "rs", k.rsa, testClaims()), ErrorAlgorithmMismatch},
+		//远程JWKS中的oct key被忽略, 不能用于HMAC验签
+		{"remoteOct", sign(t, jwt.SigningMethodHS256, "hs", k.hmac, testClaims()), ErrorKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := j.Parse(tt.token)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !stderrors.Is(err, tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKSRefetch(t *testing.T) {
+	k := newTestKeys(t)
+	s := newJWKSServer(t, marshalJWKS(t, rsaJWK("rs", "RS256", &k.rsa.PublicKey)))
+	jwks, err := NewJWKS(s.URL, WithJWKSRefreshInterval(0), WithJWKSMinRefetchInterval(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jwks.Close()
+	requests := func() int32 {
+		return atomic.LoadInt32(&s.requests)
+	}
+
+	//间隔内的未知kid不请求
+	for i := 0; i < 5; i++ {
+		if _, err := jwks.Key("unknown", "RS256"); err != ErrorKeyNotFound {
+			t.Errorf("Key(unknown) = %v, want %v", err, ErrorKeyNotFound)
+		}
+	}
+	if got := requests(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+
+	//key轮换后, 间隔外的未知kid触发刷新
+	ecKey := &k.ecdsa.PublicKey
+	s.set(marshalJWKS(t, rsaJWK("rs", "RS256", &k.rsa.PublicKey), ecJWK("es", ecKey)))
+	if _, err := jwks.Key("es", "ES256"); err != ErrorKeyNotFound {
+		t.Errorf("Key(es) within interval = %v, want %v", err, ErrorKeyNotFound)
+	}
+	time.Sleep(150 * time.Millisecond)
+	key, err := jwks.Key("es", "ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.(*ecdsa.PublicKey).Equal(ecKey) {
+		t.Error("Key(es) returned wrong key")
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = jwks.Key("unknown", "RS256")
+	}
+	if got := requests(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+	//已知kid不请求
+	if _, err := jwks.Key("rs", "RS256"); err != nil {
+		t.Error(err)
+	}
+	if got := requests(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestNewJWKSError(t *testing.T) {
+	k := newTestKeys(t)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"onlyOct", marshalJWKS(t, octJWK("hs", k.hmac))},
+		{"invalidJSON", []byte(`{"keys":`)},
+	}
+	for _, tt := range tests {
+		s := newJWKSServer(t, tt.data)
+		if _, err := NewJWKS(s.URL, WithJWKSRefreshInterval(0)); err == nil {
+			t.Errorf("%s: NewJWKS() error = nil", tt.name)
+		}
+	}
+	if _, err := NewJWKS("http://127.0.0.1:1/jwks", WithJWKSRefreshInterval(0)); err == nil {
+		t.Error("NewJWKS(unreachable) error = nil")
+	}
+}
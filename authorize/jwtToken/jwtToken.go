@@ -0,0 +1,272 @@
+package jwtToken
+
+import (
+	"crypto"
+	stderrors "errors"
+	"fmt"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/golang-jwt/jwt/v5"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorKeyNotFound = stderrors.New("key not found")
+)
+
+// KeySource 按kid/alg返回验签的key, 实现key轮换
+type KeySource interface {
+	Key(kid string, alg string) (interface{}, error)
+}
+
+// Keys kid到key的静态映射; token无kid时使用""对应的key, 只有一个key时直接使用
+type Keys map[string]interface{}
+
+func (k Keys) Key(kid string, alg string) (interface{}, error) {
+	if key, ok := k[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(k) == 1 {
+		for _, key := range k {
+			return key, nil
+		}
+	}
+	return nil, ErrorKeyNotFound
+}
+
+// IdentityClaims 自定义claims实现后由其决定Identity
+type IdentityClaims interface {
+	Identity() *authorize.Identity
+}
+
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope,omitempty"`
+	Scp   []string `json:"scp,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+func (c *Claims) Identity() *authorize.Identity {
+	identity := &authorize.Identity{
+		Subject: c.Subject,
+		TokenId: c.ID,
+		Roles:   c.Roles,
+		Claims:  c,
+	}
+	if c.Scope != "" {
+		identity.Scopes = strings.Fields(c.Scope)
+	}
+	identity.Scopes = append(identity.Scopes, c.Scp...)
+	if c.IssuedAt != nil {
+		identity.IssuedAt = c.IssuedAt.Time
+	}
+	if c.ExpiresAt != nil {
+		identity.ExpiresAt = c.ExpiresAt.Time
+	}
+	return identity
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		Algorithms: []string{"HS256", "RS256", "ES256", "EdDSA"},
+		Claims: func() jwt.Claims {
+			return &Claims{}
+		},
+	}
+}
+
+func WithAlgorithms(val ...string) Option {
+	return func(opts *Config) {
+		opts.Algorithms = val
+	}
+}
+func WithIssuer(val string) Option {
+	return func(opts *Config) {
+		opts.Issuer = val
+	}
+}
+func WithAudience(val string) Option {
+	return func(opts *Config) {
+		opts.Audience = val
+	}
+}
+
+// WithLeeway exp/nbf/iat允许的时钟偏差
+func WithLeeway(val time.Duration) Option {
+	return func(opts *Config) {
+		opts.Leeway = val
+	}
+}
+
+// WithoutExpirationRequired 允许token不带exp
+func WithoutExpirationRequired() Option {
+	return func(opts *Config) {
+		opts.ExpirationOptional = true
+	}
+}
+
+// WithClaims 自定义claims类型, 需返回指针, 通过GetClaims读取
+func WithClaims(val func() jwt.Claims) Option {
+	return func(opts *Config) {
+		opts.Claims = val
+	}
+}
+func WithClock(val func() time.Time) Option {
+	return func(opts *Config) {
+		opts.Clock = val
+	}
+}
+
+func New(keys KeySource, opts ...Option) *JwtToken {
+	if keys == nil {
+		panic("keys 必须设置")
+	}
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	if len(config.Algorithms) == 0 {
+		panic("algorithms 必须设置")
+	}
+
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods(config.Algorithms),
+		jwt.WithLeeway(config.Leeway),
+		jwt.WithIssuedAt(),
+	}
+	if !config.ExpirationOptional {
+		parserOptions = append(parserOptions, jwt.WithExpirationRequired())
+	}
+	if config.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(config.Audience))
+	}
+	if config.Clock != nil {
+		parserOptions = append(parserOptions, jwt.WithTimeFunc(config.Clock))
+	}
+
+	return &JwtToken{
+		Keys:   keys,
+		Config: config,
+		parser: jwt.NewParser(parserOptions...),
+	}
+}
+
+type Config struct {
+	Algorithms         []string
+	Issuer             string
+	Audience           string
+	Leeway             time.Duration
+	ExpirationOptional bool
+	Claims             func() jwt.Claims
+	Clock              func() time.Time
+}
+
+type JwtToken struct {
+	Keys KeySource
+	*Config
+	parser *jwt.Parser
+}
+
+// Parse 验证token并返回claims
+func (j *JwtToken) Parse(token string) (jwt.Claims, error) {
+	claims := j.Claims()
+	if _, err := j.parser.ParseWithClaims(token, claims, j.keyFunc); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Handler 实现bearerToken.Authorize, 验证通过后将Identity写入context, IdentityClaims未设置Scheme时为"jwt"
+func (j *JwtToken) Handler(ctx *baseContext.Context, token string) error {
+	if token == "" {
+		return baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "missing token")
+	}
+	claims, err := j.Parse(token)
+	if err != nil {
+		return baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], err)
+	}
+	identity := NewIdentity(claims)
+	if identity.Scheme == "" {
+		identity.Scheme = "jwt"
+	}
+	authorize.SetIdentity(ctx, identity)
+	return nil
+}
+
+func (j *JwtToken) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := j.Keys.Key(kid, token.Method.Alg())
+	if err != nil {
+		return nil, fmt.Errorf("kid %q: %w", kid, err)
+	}
+	//私钥转为公钥, HMAC key为[]byte不处理
+	if _, ok := key.([]byte); !ok {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer.Public(), nil
+		}
+	}
+	return key, nil
+}
+
+// NewIdentity claims转换为Identity, claims实现IdentityClaims时使用其结果
+func NewIdentity(claims jwt.Claims) *authorize.Identity {
+	if c, ok := claims.(IdentityClaims); ok {
+		return c.Identity()
+	}
+	identity := &authorize.Identity{Claims: claims, TokenId: tokenId(claims)}
+	identity.Subject, _ = claims.GetSubject()
+	if iat, _ := claims.GetIssuedAt(); iat != nil {
+		identity.IssuedAt = iat.Time
+	}
+	if exp, _ := claims.GetExpirationTime(); exp != nil {
+		identity.ExpiresAt = exp.Time
+	}
+	return identity
+}
+
+// tokenId 读取jti, 用于按jti吊销; 支持jwt.MapClaims/*jwt.RegisteredClaims/GetRegisteredClaims()以及嵌入jwt.RegisteredClaims的struct
+func tokenId(claims jwt.Claims) string {
+	switch c := claims.(type) {
+	case jwt.MapClaims:
+		id, _ := c["jti"].(string)
+		return id
+	case *jwt.RegisteredClaims:
+		return c.ID
+	case interface{ GetRegisteredClaims() *jwt.RegisteredClaims }:
+		if r := c.GetRegisteredClaims(); r != nil {
+			return r.ID
+		}
+		return ""
+	}
+	v := reflect.Indirect(reflect.ValueOf(claims))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	switch r := v.FieldByName("RegisteredClaims"); {
+	case !r.IsValid():
+	case r.Type() == reflect.TypeOf(jwt.RegisteredClaims{}):
+		return r.Interface().(jwt.RegisteredClaims).ID
+	case r.Type() == reflect.TypeOf(&jwt.RegisteredClaims{}) && !r.IsNil():
+		return r.Interface().(*jwt.RegisteredClaims).ID
+	}
+	return ""
+}
+
+// GetClaims 读取Handler写入context的claims
+func GetClaims[T jwt.Claims](ctx *baseContext.Context) (T, bool) {
+	var zero T
+	identity := authorize.GetIdentity(ctx)
+	if identity == nil {
+		return zero, false
+	}
+	claims, ok := identity.Claims.(T)
+	return claims, ok
+}
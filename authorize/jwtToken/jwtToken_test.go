@@ -0,0 +1,329 @@
+package jwtToken
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kataras/iris/v12"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+type testKeys struct {
+	hmac    []byte
+	rsa     *rsa.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKeys{hmac: []byte("0123456789abcdef0123456789abcdef"), rsa: rsaKey, ecdsa: ecKey, ed25519: edKey}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testClaims() *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u1",
+			ID:        "j1",
+			Issuer:    "https://issuer.example",
+			Audience:  jwt.ClaimStrings{"api"},
+			IssuedAt:  jwt.NewNumericDate(testNow.Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(testNow.Add(time.Minute)),
+		},
+		Scope: "read write",
+		Roles: []string{"admin"},
+	}
+}
+
+func clock(now *time.Time) Option {
+	return WithClock(func() time.Time { return *now })
+}
+
+func TestAlgorithms(t *testing.T) {
+	k := newTestKeys(t)
+	keys := Keys{"hs": k.hmac, "rs": k.rsa, "es": k.ecdsa, "ed": k.ed25519}
+	now := testNow
+	j := New(keys, clock(&now))
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"HS256", sign(t, jwt.SigningMethodHS256, "hs", k.hmac, testClaims()), false},
+		{"RS256", sign(t, jwt.SigningMethodRS256, "rs", k.rsa, testClaims()), false},
+		{"ES256", sign(t, jwt.SigningMethodES256, "es", k.ecdsa, testClaims()), false},
+		{"EdDSA", sign(t, jwt.SigningMethodEdDSA, "ed", k.ed25519, testClaims()), false},
+		//不在Algorithms中的算法
+		{"RS384", sign(t, jwt.SigningMethodRS384, "rs", k.rsa, testClaims()), true},
+		{"none", sign(t, jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, testClaims()), true},
+		//算法与key类型不匹配: 用RSA公钥作为HMAC密钥签名
+		{"confusion", sign(t, jwt.SigningMethodHS256, "rs", pemPublicKey(t, &k.rsa.PublicKey), testClaims()), true},
+		{"wrongKey", sign(t, jwt.SigningMethodES256, "rs", k.ecdsa, testClaims()), true},
+		{"unknownKid", sign(t, jwt.SigningMethodHS256, "other", k.hmac, testClaims()), true},
+		{"tampered", sign(t, jwt.SigningMethodHS256, "hs", k.hmac, testClaims()) + "x", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := j.Parse(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.(*Claims).Subject != "u1" {
+				t.Errorf("Subject = %s", claims.(*Claims).Subject)
+			}
+		})
+	}
+
+	restricted := New(keys, clock(&now), WithAlgorithms("RS256"))
+	if _, err := restricted.Parse(sign(t, jwt.SigningMethodHS256, "hs", k.hmac, testClaims())); err == nil {
+		t.Error("HS256 accepted with WithAlgorithms(RS256)")
+	}
+}
+
+func pemPublicKey(t *testing.T, key *rsa.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestValidation(t *testing.T) {
+	k := newTestKeys(t)
+	keys := Keys{"": k.hmac}
+	claims := func(fn func(c *Claims)) string {
+		c := testClaims()
+		fn(c)
+		return sign(t, jwt.SigningMethodHS256, "", k.hmac, c)
+	}
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		opts    []Option
+		token   string
+		wantErr bool
+	}{
+		{"valid", 0, nil, claims(func(c *Claims) {}), false},
+		{"expired", time.Minute, nil, claims(func(c *Claims) {}), true},
+		{"leeway", time.Minute, []Option{WithLeeway(5 * time.Second)}, claims(func(c *Claims) {}), false},
+		{"leewayExceeded", time.Minute + 5*time.Second, []Option{WithLeeway(5 * time.Second)}, claims(func(c *Claims) {}), true},
+		{"notBefore", 0, nil, claims(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(testNow.Add(time.Second)) }), true},
+		{"issuedInFuture", 0, nil, claims(func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(testNow.Add(time.Second)) }), true},
+		{"missingExp", 0, nil, claims(func(c *Claims) { c.ExpiresAt = nil }), true},
+		{"expOptional", 0, []Option{WithoutExpirationRequired()}, claims(func(c *Claims) { c.ExpiresAt = nil }), false},
+		{"issuer", 0, []Option{WithIssuer("https://issuer.example")}, claims(func(c *Claims) {}), false},
+		{"wrongIssuer", 0, []Option{WithIssuer("https://other.example")}, claims(func(c *Claims) {}), true},
+		{"audience", 0, []Option{WithAudience("api")}, claims(func(c *Claims) {}), false},
+		{"wrongAudience", 0, []Option{WithAudience("admin")}, claims(func(c *Claims) {}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow.Add(tt.elapsed)
+			j := New(keys, append([]Option{clock(&now)}, tt.opts...)...)
+			if _, err := j.Parse(tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    Keys
+		kid     string
+		want    interface{}
+		wantErr error
+	}{
+		{"kid", Keys{"a": "ka", "b": "kb"}, "b", "kb", nil},
+		{"unknownKid", Keys{"a": "ka"}, "b", nil, ErrorKeyNotFound},
+		//无kid时只有一个key直接使用
+		{"single", Keys{"a": "ka"}, "", "ka", nil},
+		{"ambiguous", Keys{"a": "ka", "b": "kb"}, "", nil, ErrorKeyNotFound},
+		{"default", Keys{"": "k", "b": "kb"}, "", "k", nil},
+	}
+	for _, tt := range tests {
+		key, err := tt.keys.Key(tt.kid, "HS256")
+		if err != tt.wantErr || key != tt.want {
+			t.Errorf("%s: Key() = %v %v, want %v %v", tt.name, key, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	k := newTestKeys(t)
+	now := testNow
+	j := New(Keys{"rs": k.rsa}, clock(&now))
+
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	app.Get("/", baseContext.Handler(func(ctx *baseContext.Context) {
+		token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if err := j.Handler(ctx, token); err != nil {
+			ctx.Error(err)
+			return
+		}
+		identity := authorize.GetIdentity(ctx)
+		claims, ok := GetClaims[*Claims](ctx)
+		if !ok {
+			ctx.WriteString("no claims")
+			return
+		}
+		ctx.WriteString(strings.Join([]string{identity.Subject, identity.TokenId, identity.Scheme, strings.Join(identity.Scopes, ","), strings.Join(identity.Roles, ","), claims.Issuer}, "|"))
+	}))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(token string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		var resp struct {
+			Code string `json:"code"`
+		}
+		if json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+			return w.Body.String()
+		}
+		return resp.Code
+	}
+
+	if got := serve(sign(t, jwt.SigningMethodRS256, "rs", k.rsa, testClaims())); got != "u1|j1|jwt|read,write|admin|https://issuer.example" {
+		t.Errorf("valid = %s", got)
+	}
+	if got := serve(""); got != baseContext.ErrorUnauthorized {
+		t.Errorf("missing = %s, want %s", got, baseContext.ErrorUnauthorized)
+	}
+	if got := serve(sign(t, jwt.SigningMethodHS256, "rs", k.hmac, testClaims())); got != baseContext.ErrorUnauthorized {
+		t.Errorf("alg mismatch = %s, want %s", got, baseContext.ErrorUnauthorized)
+	}
+}
+
+// partnerClaims 自定义Identity, 使用自己的scheme
+type partnerClaims struct {
+	jwt.RegisteredClaims
+}
+
+func (c *partnerClaims) Identity() *authorize.Identity {
+	return &authorize.Identity{Subject: c.Subject, Scheme: "partner", Claims: c}
+}
+
+func TestHandlerScheme(t *testing.T) {
+	k := newTestKeys(t)
+	now := testNow
+	tests := []struct {
+		name   string
+		claims func() jwt.Claims
+		want   string
+	}{
+		{"default", func() jwt.Claims { return &Claims{} }, "jwt"},
+		//IdentityClaims设置的scheme不覆盖
+		{"identityClaims", func() jwt.Claims { return &partnerClaims{} }, "partner"},
+	}
+	for _, tt := range tests {
+		j := New(Keys{"hs": k.hmac}, clock(&now), WithClaims(tt.claims))
+		baseContext.New("test", nil, baseContext.WithResponse(response.New))
+		app := iris.New()
+		app.Get("/", baseContext.Handler(func(ctx *baseContext.Context) {
+			if err := j.Handler(ctx, ctx.GetHeader("X-Token")); err != nil {
+				ctx.Error(err)
+				return
+			}
+			ctx.WriteString(authorize.GetIdentity(ctx).Scheme)
+		}))
+		if err := app.Build(); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Token", sign(t, jwt.SigningMethodHS256, "hs", k.hmac, testClaims()))
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("%s: scheme = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+type embeddedClaims struct {
+	jwt.RegisteredClaims
+	Tenant string `json:"tenant"`
+}
+
+type pointerClaims struct {
+	*jwt.RegisteredClaims
+}
+
+type getterClaims struct {
+	jwt.MapClaims
+}
+
+func (c getterClaims) GetRegisteredClaims() *jwt.RegisteredClaims {
+	return &jwt.RegisteredClaims{ID: "j5"}
+}
+
+func TestNewIdentityTokenId(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.Claims
+		want   string
+	}{
+		{"claims", testClaims(), "j1"},
+		{"registered", &jwt.RegisteredClaims{Subject: "u1", ID: "j2"}, "j2"},
+		{"map", jwt.MapClaims{"sub": "u1", "jti": "j3"}, "j3"},
+		{"mapWithoutJti", jwt.MapClaims{"sub": "u1"}, ""},
+		//未实现IdentityClaims的自定义claims
+		{"embedded", &embeddedClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", ID: "j4"}}, "j4"},
+		{"embeddedValue", embeddedClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", ID: "j4"}}, "j4"},
+		{"embeddedPointer", &pointerClaims{RegisteredClaims: &jwt.RegisteredClaims{Subject: "u1", ID: "j6"}}, "j6"},
+		{"getter", getterClaims{jwt.MapClaims{"sub": "u1"}}, "j5"},
+	}
+	for _, tt := range tests {
+		identity := NewIdentity(tt.claims)
+		if identity.TokenId != tt.want {
+			t.Errorf("%s: TokenId = %q, want %q", tt.name, identity.TokenId, tt.want)
+		}
+		if identity.Subject != "u1" {
+			t.Errorf("%s: Subject = %q", tt.name, identity.Subject)
+		}
+	}
+}
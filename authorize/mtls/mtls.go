@@ -0,0 +1,290 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	stderrors "errors"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/authorize/bearerToken"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/kataras/iris/v12"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorNoCertificate  = stderrors.New("client certificate required")
+	ErrorInvalidHeader  = stderrors.New("invalid client certificate header")
+	ErrorUntrustedProxy = stderrors.New("client certificate header from untrusted proxy")
+)
+
+// Mapper 证书转换为Identity, 返回错误时拒绝
+type Mapper func(cert *x509.Certificate) (*authorize.Identity, error)
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		Mapper: DefaultMapper,
+		Clock:  time.Now,
+	}
+}
+
+func WithIntermediates(val *x509.CertPool) Option {
+	return func(opts *Config) {
+		opts.Intermediates = val
+	}
+}
+
+// WithProxyHeader TLS在代理终止时读取代理转发的证书, 只信任trustedProxies(IP或CIDR)发来的header
+// header值支持URL编码的PEM(如nginx $ssl_client_escaped_cert)、PEM和base64 DER
+func WithProxyHeader(header string, trustedProxies ...string) Option {
+	return func(opts *Config) {
+		opts.ProxyHeader = header
+		for _, proxy := range trustedProxies {
+			if !strings.Contains(proxy, "/") {
+				if strings.Contains(proxy, ":") {
+					proxy += "/128"
+				} else {
+					proxy += "/32"
+				}
+			}
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				panic("trustedProxy " + proxy + " 格式错误")
+			}
+			opts.TrustedProxies = append(opts.TrustedProxies, network)
+		}
+	}
+}
+func WithMapper(val Mapper) Option {
+	return func(opts *Config) {
+		opts.Mapper = val
+	}
+}
+func WithClock(val func() time.Time) Option {
+	return func(opts *Config) {
+		opts.Clock = val
+	}
+}
+
+// WithPaths 与bearerToken相同的路径规则, 可直接传入bearerToken的Paths
+func WithPaths(paths ...bearerToken.PathConfig) Option {
+	return func(opts *Config) {
+		opts.Paths = append(opts.Paths, paths...)
+	}
+}
+func WithPath(path interface{}, level bearerToken.Level) Option {
+	return func(opts *Config) {
+		opts.Paths = append(opts.Paths, bearerToken.PathConfig{Name: path, Level: level})
+	}
+}
+func WithIgnorePaths(paths ...interface{}) Option {
+	return func(opts *Config) {
+		for _, path := range paths {
+			opts.Paths = append(opts.Paths, bearerToken.PathConfig{Name: path, Level: bearerToken.LevelIgnore})
+		}
+	}
+}
+func WithInfoPaths(paths ...interface{}) Option {
+	return func(opts *Config) {
+		for _, path := range paths {
+			opts.Paths = append(opts.Paths, bearerToken.PathConfig{Name: path, Level: bearerToken.LevelInfo})
+		}
+	}
+}
+
+type Config struct {
+	Intermediates  *x509.CertPool
+	ProxyHeader    string
+	TrustedProxies []*net.IPNet
+	Mapper         Mapper
+	Clock          func() time.Time
+	Paths          []bearerToken.PathConfig
+}
+
+func New(roots *x509.CertPool, opts ...Option) *Mtls {
+	if roots == nil {
+		panic("roots 必须设置")
+	}
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &Mtls{
+		Roots:  roots,
+		Config: config,
+	}
+}
+
+type Mtls struct {
+	Roots *x509.CertPool
+	*Config
+}
+
+// DefaultMapper Subject依次取CN、URI SAN(如SPIFFE ID)、DNS SAN, OU作为Roles
+func DefaultMapper(cert *x509.Certificate) (*authorize.Identity, error) {
+	identity := &authorize.Identity{
+		Subject:   cert.Subject.CommonName,
+		TokenId:   cert.SerialNumber.String(),
+		Roles:     cert.Subject.OrganizationalUnit,
+		IssuedAt:  cert.NotBefore,
+		ExpiresAt: cert.NotAfter,
+		Claims:    cert,
+	}
+	if identity.Subject == "" && len(cert.URIs) > 0 {
+		identity.Subject = cert.URIs[0].String()
+	}
+	if identity.Subject == "" && len(cert.DNSNames) > 0 {
+		identity.Subject = cert.DNSNames[0]
+	}
+	return identity, nil
+}
+
+// Certificates 返回客户端证书链, 第一个为客户端证书
+func (m *Mtls) Certificates(ctx *baseContext.Context) ([]*x509.Certificate, error) {
+	if state := ctx.Request().TLS; state != nil && len(state.PeerCertificates) > 0 {
+		return state.PeerCertificates, nil
+	}
+	if m.ProxyHeader == "" {
+		return nil, ErrorNoCertificate
+	}
+	value := ctx.GetHeader(m.ProxyHeader)
+	if value == "" {
+		return nil, ErrorNoCertificate
+	}
+	if !m.trusted(ctx.Request().RemoteAddr) {
+		return nil, ErrorUntrustedProxy
+	}
+	return parseHeader(value)
+}
+
+func (m *Mtls) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range m.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHeader(value string) ([]*x509.Certificate, error) {
+	if strings.Contains(value, "%") {
+		//PathUnescape保留'+', 它是base64字符而不是空格
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, ErrorInvalidHeader
+		}
+		value = unescaped
+	}
+	if strings.Contains(value, "-----BEGIN") {
+		var certs []*x509.Certificate
+		rest := []byte(value)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) == 0 {
+			return nil, ErrorInvalidHeader
+		}
+		return certs, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrorInvalidHeader
+	}
+	return x509.ParseCertificates(der)
+}
+
+// Verify 校验证书链和clientAuth用途, 返回Identity
+func (m *Mtls) Verify(certs []*x509.Certificate) (*authorize.Identity, error) {
+	if len(certs) == 0 {
+		return nil, ErrorNoCertificate
+	}
+	intermediates := m.Intermediates
+	if len(certs) > 1 {
+		if intermediates == nil {
+			intermediates = x509.NewCertPool()
+		} else {
+			intermediates = intermediates.Clone()
+		}
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         m.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   m.Clock(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, err
+	}
+	identity, err := m.Mapper(certs[0])
+	if err != nil {
+		return nil, err
+	}
+	identity.Scheme = "mtls"
+	return identity, nil
+}
+
+func (m *Mtls) authenticate(ctx *baseContext.Context) error {
+	certs, err := m.Certificates(ctx)
+	if err != nil {
+		return baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], err)
+	}
+	identity, err := m.Verify(certs)
+	if err != nil {
+		return baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], err)
+	}
+	authorize.SetIdentity(ctx, identity)
+	ctx.Values().Set("authScheme", "mtls")
+	ctx.AddLogField("auth_scheme", "mtls")
+	return nil
+}
+
+func (m *Mtls) Context(ctx *baseContext.Context) {
+	level := bearerToken.MatchPath(m.Paths, ctx.Request().URL.Path)
+	if level == bearerToken.LevelIgnore {
+		ctx.Next()
+		return
+	}
+
+	if err := m.authenticate(ctx); err != nil {
+		if level == bearerToken.LevelInfo {
+			ctx.Next()
+			return
+		}
+		ctx.SetRejected(baseContext.RejectedAuthorize)
+		ctx.Error(err)
+		return
+	}
+	ctx.Next()
+}
+
+func (m *Mtls) Handler() iris.Handler {
+	return baseContext.Handler(m.Context)
+}
@@ -0,0 +1,270 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/authorize/bearerToken"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = testNow.Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = testNow.Add(time.Hour)
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func newCA(t *testing.T, name string, serial int64, parent *testCert) *testCert {
+	return newCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, parent)
+}
+
+func newClient(t *testing.T, parent *testCert, fn func(c *x509.Certificate)) *testCert {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(100),
+		Subject:      pkix.Name{CommonName: "client", OrganizationalUnit: []string{"ops"}},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if fn != nil {
+		fn(template)
+	}
+	return newCert(t, template, parent)
+}
+
+func pemEncode(certs ...*testCert) string {
+	var b strings.Builder
+	for _, c := range certs {
+		b.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}))
+	}
+	return b.String()
+}
+
+func pool(certs ...*testCert) *x509.CertPool {
+	p := x509.NewCertPool()
+	for _, c := range certs {
+		p.AddCert(c.cert)
+	}
+	return p
+}
+
+func newTestApp(t *testing.T, m *Mtls) *iris.Application {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	handler := baseContext.Handler(func(ctx *baseContext.Context) {
+		subject := ""
+		if identity := authorize.GetIdentity(ctx); identity != nil {
+			subject = identity.Subject + ":" + identity.Scheme + ":" + strings.Join(identity.Roles, ",")
+		}
+		ctx.WriteString("ok:" + subject)
+	})
+	app.Get("/", m.Handler(), handler)
+	app.Get("/info", m.Handler(), handler)
+	app.Get("/public", m.Handler(), handler)
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+type request struct {
+	path       string
+	remoteAddr string
+	header     string
+	tls        []*testCert
+}
+
+// serve 通过时返回"ok:<subject>:<scheme>:<roles>", 否则返回响应的code
+func serve(app *iris.Application, r request) string {
+	path := r.path
+	if path == "" {
+		path = "/"
+	}
+	req := httptest.NewRequest("GET", path, nil)
+	if r.remoteAddr != "" {
+		req.RemoteAddr = r.remoteAddr
+	}
+	if r.header != "" {
+		req.Header.Set("X-Client-Cert", r.header)
+	}
+	if len(r.tls) > 0 {
+		state := &tls.ConnectionState{}
+		for _, c := range r.tls {
+			state.PeerCertificates = append(state.PeerCertificates, c.cert)
+		}
+		req.TLS = state
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	var resp struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		return w.Body.String()
+	}
+	return resp.Code
+}
+
+func TestMtls(t *testing.T) {
+	root := newCA(t, "root", 1, nil)
+	intermediate := newCA(t, "intermediate", 2, root)
+	client := newClient(t, root, nil)
+	chained := newClient(t, intermediate, func(c *x509.Certificate) {
+		c.Subject = pkix.Name{}
+		c.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/svc"}}
+	})
+	serverOnly := newClient(t, root, func(c *x509.Certificate) {
+		c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	})
+	expired := newClient(t, root, func(c *x509.Certificate) {
+		c.NotAfter = testNow.Add(-time.Minute)
+	})
+	untrusted := newClient(t, newCA(t, "other", 3, nil), nil)
+
+	m := New(pool(root),
+		WithProxyHeader("X-Client-Cert", "10.0.0.0/8", "192.168.1.1", "::1"),
+		WithClock(func() time.Time { return testNow }),
+		WithInfoPaths("/info"),
+		WithIgnorePaths("/public"),
+	)
+	app := newTestApp(t, m)
+	der := base64.StdEncoding.EncodeToString(client.cert.Raw)
+
+	tests := []struct {
+		name string
+		req  request
+		want string
+	}{
+		{"tls", request{tls: []*testCert{client}}, "ok:client:mtls:ops"},
+		{"tlsChain", request{tls: []*testCert{chained, intermediate}}, "ok:spiffe://example.org/svc:mtls:"},
+		{"tlsMissingIntermediate", request{tls: []*testCert{chained}}, baseContext.ErrorUnauthorized},
+		{"serverAuthOnly", request{tls: []*testCert{serverOnly}}, baseContext.ErrorUnauthorized},
+		{"expired", request{tls: []*testCert{expired}}, baseContext.ErrorUnauthorized},
+		{"untrustedCA", request{tls: []*testCert{untrusted}}, baseContext.ErrorUnauthorized},
+		{"noCertificate", request{}, baseContext.ErrorUnauthorized},
+
+		//代理转发的证书格式
+		{"pathEscapedPEM", request{remoteAddr: "10.1.2.3:1234", header: url.PathEscape(pemEncode(client))}, "ok:client:mtls:ops"},
+		{"escapedChain", request{remoteAddr: "10.1.2.3:1234", header: url.PathEscape(pemEncode(chained, intermediate))}, "ok:spiffe://example.org/svc:mtls:"},
+		{"base64DER", request{remoteAddr: "10.1.2.3:1234", header: der}, "ok:client:mtls:ops"},
+		{"invalidHeader", request{remoteAddr: "10.1.2.3:1234", header: "not a certificate"}, baseContext.ErrorUnauthorized},
+		{"invalidEscape", request{remoteAddr: "10.1.2.3:1234", header: "%zz"}, baseContext.ErrorUnauthorized},
+
+		//只信任trustedProxies发来的header
+		{"trustedIP", request{remoteAddr: "192.168.1.1:1234", header: der}, "ok:client:mtls:ops"},
+		{"trustedIPv6", request{remoteAddr: "[::1]:1234", header: der}, "ok:client:mtls:ops"},
+		{"untrustedIP", request{remoteAddr: "192.168.1.2:1234", header: der}, baseContext.ErrorUnauthorized},
+		{"untrustedCIDR", request{remoteAddr: "11.0.0.1:1234", header: der}, baseContext.ErrorUnauthorized},
+		{"invalidRemoteAddr", request{remoteAddr: "unknown", header: der}, baseContext.ErrorUnauthorized},
+		//TLS连接上的证书优先于header
+		{"tlsOverHeader", request{remoteAddr: "11.0.0.1:1234", header: der, tls: []*testCert{chained, intermediate}}, "ok:spiffe://example.org/svc:mtls:"},
+
+		{"info", request{path: "/info"}, "ok:"},
+		{"infoWithCert", request{path: "/info", tls: []*testCert{client}}, "ok:client:mtls:ops"},
+		{"ignore", request{path: "/public", tls: []*testCert{client}}, "ok:"},
+	}
+	for _, tt := range tests {
+		if got := serve(app, tt.req); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	root := newCA(t, "root", 1, nil)
+	client := newClient(t, root, nil)
+	pemValue := pemEncode(client)
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"pem", pemValue, false},
+		//nginx $ssl_client_escaped_cert不转义'+', PathUnescape保留'+'
+		{"nginxEscaped", strings.NewReplacer("\n", "%0A", " ", "%20", "=", "%3D").Replace(pemValue), false},
+		{"base64", base64.StdEncoding.EncodeToString(client.cert.Raw), false},
+		{"base64URL", base64.URLEncoding.EncodeToString(client.cert.Raw), true},
+		{"noCertificateBlock", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("x")})), true},
+		{"garbage", "abc", true},
+	}
+	for _, tt := range tests {
+		certs, err := parseHeader(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseHeader() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (len(certs) != 1 || !certs[0].Equal(client.cert)) {
+			t.Errorf("%s: parseHeader() = %v", tt.name, certs)
+		}
+	}
+}
+
+func TestProxyHeaderPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	New(x509.NewCertPool(), WithProxyHeader("X-Client-Cert", "not-an-ip"))
+}
+
+func TestPaths(t *testing.T) {
+	root := newCA(t, "root", 1, nil)
+	m := New(pool(root), WithPaths(bearerToken.PathConfig{Name: "/info", Level: bearerToken.LevelInfo}))
+	app := newTestApp(t, m)
+	if got := serve(app, request{path: "/info"}); got != "ok:" {
+		t.Errorf("info = %s", got)
+	}
+	if got := serve(app, request{}); got != baseContext.ErrorUnauthorized {
+		t.Errorf("verify = %s, want %s", got, baseContext.ErrorUnauthorized)
+	}
+}
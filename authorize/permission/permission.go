@@ -0,0 +1,171 @@
+package permission
+
+import (
+	"fmt"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/core/router"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// PropertyKey party属性中Requirement的key, 见SetPartyRequirement
+const PropertyKey = "permission"
+
+// Requirement Scopes需全部满足, Roles满足其一即可
+type Requirement struct {
+	Scopes []string
+	Roles  []string
+}
+
+func (r *Requirement) IsEmpty() bool {
+	return r == nil || (len(r.Scopes) == 0 && len(r.Roles) == 0)
+}
+
+// Check 返回缺少的scope/role, 满足时返回nil
+func (r *Requirement) Check(identity *authorize.Identity) []string {
+	var missing []string
+	for _, scope := range r.Scopes {
+		if !identity.HasScope(scope) {
+			missing = append(missing, "scope:"+scope)
+		}
+	}
+	if len(r.Roles) > 0 && !identity.HasAnyRole(r.Roles...) {
+		missing = append(missing, "role:"+strings.Join(r.Roles, "|"))
+	}
+	return missing
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{}
+}
+
+func WithPath(path interface{}, requirement Requirement) Option {
+	return func(opts *Config) {
+		opts.Paths = append(opts.Paths, PathConfig{path, requirement})
+	}
+}
+func WithPaths(paths ...PathConfig) Option {
+	return func(opts *Config) {
+		opts.Paths = append(opts.Paths, paths...)
+	}
+}
+
+func New(opts ...Option) *Permission {
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &Permission{
+		Config: config,
+	}
+}
+
+type PathConfig struct {
+	Name        interface{}
+	Requirement Requirement
+}
+
+type Config struct {
+	Paths []PathConfig
+}
+
+type Permission struct {
+	*Config
+}
+
+// Requirements 返回当前请求的要求: 匹配的路径配置和路由所在party的属性, 每个来源单独校验, 需全部满足
+func (p *Permission) Requirements(ctx *baseContext.Context) []*Requirement {
+	var requirements []*Requirement
+	currPath := ctx.Request().URL.Path
+	for i, path := range p.Paths {
+		var matched bool
+		switch v := (path.Name).(type) {
+		case string:
+			matched = v == currPath
+		case *regexp.Regexp:
+			matched = v.MatchString(currPath)
+		case func(string) bool:
+			matched = v(currPath)
+		}
+		if matched {
+			requirements = append(requirements, &p.Paths[i].Requirement)
+			break
+		}
+	}
+	if route := ctx.GetCurrentRoute(); route != nil {
+		if v, ok := route.Property(PropertyKey); ok {
+			if rs, ok := v.([]Requirement); ok {
+				for i := range rs {
+					requirements = append(requirements, &rs[i])
+				}
+			}
+		}
+	}
+	return requirements
+}
+
+func (p *Permission) Context(ctx *baseContext.Context) {
+	Verify(ctx, p.Requirements(ctx)...)
+}
+
+func (p *Permission) Handler() iris.Handler {
+	return baseContext.Handler(p.Context)
+}
+
+// Verify 所有requirement都满足时调用ctx.Next(), 未认证返回401, 权限不足返回403
+func Verify(ctx *baseContext.Context, requirements ...*Requirement) {
+	var missing []string
+	var identity *authorize.Identity
+	for _, requirement := range requirements {
+		if requirement.IsEmpty() {
+			continue
+		}
+		if identity == nil {
+			if identity = authorize.GetIdentity(ctx); identity == nil {
+				ctx.SetRejected(baseContext.RejectedAuthorize)
+				ctx.StatusCode(http.StatusUnauthorized)
+				ctx.Error(baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "unauthorized"))
+				return
+			}
+		}
+		missing = append(missing, requirement.Check(identity)...)
+	}
+	if len(missing) > 0 {
+		ctx.SetRejected(baseContext.RejectedAuthorize)
+		ctx.StatusCode(http.StatusForbidden)
+		ctx.Error(baseError.NewCode(ctx.ErrorCodes["Forbidden"], fmt.Sprintf("forbidden, missing %s", strings.Join(missing, ","))))
+		return
+	}
+	ctx.Next()
+}
+
+// Require 路由级handler, 如app.Post("/orders", permission.Require(permission.Requirement{Scopes: []string{"orders:write"}}), handler)
+func Require(requirement Requirement) iris.Handler {
+	return baseContext.Handler(func(ctx *baseContext.Context) {
+		Verify(ctx, &requirement)
+	})
+}
+
+func RequireScopes(scopes ...string) iris.Handler {
+	return Require(Requirement{Scopes: scopes})
+}
+
+func RequireRoles(roles ...string) iris.Handler {
+	return Require(Requirement{Roles: roles})
+}
+
+// SetPartyRequirement 设置party下所有路由的要求, 需在创建子party之前调用
+// 子party继承上级的要求并追加, 每一级单独校验, 需全部满足
+func SetPartyRequirement(party router.Party, requirement Requirement) {
+	var requirements []Requirement
+	if v, ok := party.Properties()[PropertyKey].([]Requirement); ok {
+		requirements = append(requirements, v...)
+	}
+	party.Properties()[PropertyKey] = append(requirements, requirement)
+}
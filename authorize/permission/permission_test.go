@@ -0,0 +1,169 @@
+package permission
+
+import (
+	"encoding/json"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// identityHandler 按header设置Identity, 无X-Subject时不设置
+func identityHandler(ctx *baseContext.Context) {
+	if subject := ctx.GetHeader("X-Subject"); subject != "" {
+		identity := &authorize.Identity{Subject: subject}
+		if scopes := ctx.GetHeader("X-Scopes"); scopes != "" {
+			identity.Scopes = strings.Split(scopes, ",")
+		}
+		if roles := ctx.GetHeader("X-Roles"); roles != "" {
+			identity.Roles = strings.Split(roles, ",")
+		}
+		authorize.SetIdentity(ctx, identity)
+	}
+	ctx.Next()
+}
+
+func okHandler(ctx *baseContext.Context) {
+	ctx.WriteString("ok")
+}
+
+func newTestApp(t *testing.T, fn func(app *iris.Application)) *iris.Application {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	app.UseRouter(baseContext.Handler(identityHandler))
+	fn(app)
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+type request struct {
+	method string
+	path   string
+	scopes string
+	roles  string
+	guest  bool
+}
+
+// serve 返回http状态码和响应的code, 通过时code为"ok"
+func serve(app *iris.Application, r request) (int, string) {
+	method := r.method
+	if method == "" {
+		method = "GET"
+	}
+	req := httptest.NewRequest(method, r.path, nil)
+	if !r.guest {
+		req.Header.Set("X-Subject", "u1")
+		req.Header.Set("X-Scopes", r.scopes)
+		req.Header.Set("X-Roles", r.roles)
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	var resp struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		return w.Code, w.Body.String()
+	}
+	return w.Code, resp.Code
+}
+
+type testCase struct {
+	name       string
+	req        request
+	wantStatus int
+	wantCode   string
+}
+
+func run(t *testing.T, app *iris.Application, tests []testCase) {
+	t.Helper()
+	for _, tt := range tests {
+		status, code := serve(app, tt.req)
+		if status != tt.wantStatus || code != tt.wantCode {
+			t.Errorf("%s: got %d %s, want %d %s", tt.name, status, code, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/scopes", RequireScopes("orders:read", "orders:write"), baseContext.Handler(okHandler))
+		app.Get("/roles", RequireRoles("admin", "ops"), baseContext.Handler(okHandler))
+		app.Get("/both", Require(Requirement{Scopes: []string{"orders:read"}, Roles: []string{"admin"}}), baseContext.Handler(okHandler))
+		app.Get("/empty", Require(Requirement{}), baseContext.Handler(okHandler))
+	})
+	run(t, app, []testCase{
+		{"noIdentity", request{path: "/scopes", guest: true}, http.StatusUnauthorized, baseContext.ErrorUnauthorized},
+		//scope需全部满足
+		{"allScopes", request{path: "/scopes", scopes: "orders:read,orders:write"}, http.StatusOK, "ok"},
+		{"missingScope", request{path: "/scopes", scopes: "orders:read"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		{"noScopes", request{path: "/scopes"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		//role满足其一即可
+		{"anyRole", request{path: "/roles", roles: "ops"}, http.StatusOK, "ok"},
+		{"otherRole", request{path: "/roles", roles: "user"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		{"noRoleIdentity", request{path: "/roles", guest: true}, http.StatusUnauthorized, baseContext.ErrorUnauthorized},
+		{"both", request{path: "/both", scopes: "orders:read", roles: "admin"}, http.StatusOK, "ok"},
+		{"bothMissingRole", request{path: "/both", scopes: "orders:read"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		{"bothMissingScope", request{path: "/both", roles: "admin"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		//无要求时不需要认证
+		{"empty", request{path: "/empty", guest: true}, http.StatusOK, "ok"},
+	})
+}
+
+func TestPartyRequirement(t *testing.T) {
+	p := New()
+	app := newTestApp(t, func(app *iris.Application) {
+		admin := app.Party("/admin", p.Handler())
+		SetPartyRequirement(admin, Requirement{Roles: []string{"admin"}})
+		admin.Get("/info", baseContext.Handler(okHandler))
+
+		orders := admin.Party("/orders")
+		SetPartyRequirement(orders, Requirement{Scopes: []string{"orders:read"}})
+		orders.Get("/", baseContext.Handler(okHandler))
+		orders.Post("/", RequireScopes("orders:write"), baseContext.Handler(okHandler))
+		orders.Get("/{id}", RequireRoles("auditor"), baseContext.Handler(okHandler))
+	})
+	run(t, app, []testCase{
+		{"noIdentity", request{path: "/admin/info", guest: true}, http.StatusUnauthorized, baseContext.ErrorUnauthorized},
+		{"party", request{path: "/admin/info", roles: "admin"}, http.StatusOK, "ok"},
+		{"partyMissingRole", request{path: "/admin/info", roles: "user"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		//子party继承上级的要求
+		{"nested", request{path: "/admin/orders", roles: "admin", scopes: "orders:read"}, http.StatusOK, "ok"},
+		{"nestedMissingParent", request{path: "/admin/orders", roles: "user", scopes: "orders:read"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		{"nestedMissingOwn", request{path: "/admin/orders", roles: "admin"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		//每一级单独校验, 路由级的role不能替代party的role
+		{"route", request{path: "/admin/orders/1", roles: "admin,auditor", scopes: "orders:read"}, http.StatusOK, "ok"},
+		{"routeMissing", request{path: "/admin/orders/1", roles: "admin", scopes: "orders:read"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		{"routeOnly", request{path: "/admin/orders/1", roles: "auditor", scopes: "orders:read"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		//路由级Require与party的要求叠加
+		{"routeRequire", request{method: "POST", path: "/admin/orders", roles: "admin", scopes: "orders:read,orders:write"}, http.StatusOK, "ok"},
+		{"routeRequireMissing", request{method: "POST", path: "/admin/orders", roles: "admin", scopes: "orders:read"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		{"routeRequireMissingParty", request{method: "POST", path: "/admin/orders", roles: "admin", scopes: "orders:write"}, http.StatusForbidden, baseContext.ErrorForbidden},
+	})
+}
+
+func TestPaths(t *testing.T) {
+	p := New(
+		WithPath("/reports", Requirement{Scopes: []string{"reports:read"}}),
+		WithPath(func(path string) bool { return strings.HasPrefix(path, "/reports") }, Requirement{Roles: []string{"admin"}}),
+	)
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(p.Handler())
+		app.Get("/reports", baseContext.Handler(okHandler))
+		app.Get("/reports/daily", baseContext.Handler(okHandler))
+		app.Get("/public", baseContext.Handler(okHandler))
+	})
+	run(t, app, []testCase{
+		//只使用第一个匹配的路径配置
+		{"first", request{path: "/reports", scopes: "reports:read"}, http.StatusOK, "ok"},
+		{"firstMissing", request{path: "/reports", roles: "admin"}, http.StatusForbidden, baseContext.ErrorForbidden},
+		{"prefix", request{path: "/reports/daily", roles: "admin"}, http.StatusOK, "ok"},
+		{"unmatched", request{path: "/public", guest: true}, http.StatusOK, "ok"},
+	})
+}
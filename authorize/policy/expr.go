@@ -0,0 +1,640 @@
+package policy
+
+import (
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 表达式语法:
+//
+//	subject.tenant == params.tenant && (subject.roles contains "admin" || request.method in ["GET", "HEAD"])
+//	request.header["x-tenant-id"] == subject.tenant
+//
+// 运算符: || && ! == != < <= > >= in contains, 字面量: "str" 'str' 123 1.5 true false null [list]
+// 变量以subject/params/request开头, 用.访问下级字段, 含-等字符的key用["key"]访问, 需位于最后
+// 缺失的变量参与的比较(包括!=/in/contains)结果未知, 判断缺失使用 == null / != null
+// 未知经 && || ! 传递(false && 未知 为false, true || 未知 为true), 最终作为allow规则时不匹配, 作为deny规则时匹配
+
+var ErrorSyntax = stderrors.New("policy expression syntax error")
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokenLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokenRBracket, "]", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("%w: unterminated string at %d", ErrorSyntax, i)
+			}
+			tokens = append(tokens, token{tokenString, sb.String(), i})
+			i = j + 1
+		case c >= '0' && c <= '9' || (c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			j := i + 1
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, src[i:j], i})
+			i = j
+		case isIdentStart(src[i:]):
+			j := i
+			for j < len(src) {
+				r, size := utf8.DecodeRuneInString(src[j:])
+				if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, token{tokenIdent, src[i:j], i})
+			i = j
+		default:
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					tokens = append(tokens, token{tokenOp, two, i})
+					i += 2
+					continue
+				}
+			}
+			switch c {
+			case '!', '<', '>':
+				tokens = append(tokens, token{tokenOp, string(c), i})
+				i++
+			default:
+				return nil, fmt.Errorf("%w: unexpected %q at %d", ErrorSyntax, c, i)
+			}
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(src)}), nil
+}
+
+// isIdentStart 按rune判断标识符起始, 支持非ASCII字母
+func isIdentStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+type node interface {
+	eval(env map[string]interface{}) interface{}
+}
+
+// unknown 缺失变量参与比较的结果
+type unknownValue struct{}
+
+var unknown interface{} = unknownValue{}
+
+type tri int
+
+const (
+	triFalse tri = iota
+	triTrue
+	triUnknown
+)
+
+// test 按条件求值, 缺失的变量和未知的比较结果均为triUnknown
+func test(n node, env map[string]interface{}) tri {
+	v := n.eval(env)
+	if v == unknown {
+		return triUnknown
+	}
+	if _, ok := n.(*pathNode); ok && v == nil {
+		return triUnknown
+	}
+	if truthy(v) {
+		return triTrue
+	}
+	return triFalse
+}
+
+func (t tri) value() interface{} {
+	if t == triUnknown {
+		return unknown
+	}
+	return t == triTrue
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(map[string]interface{}) interface{} {
+	return n.value
+}
+
+// isNull 字面量null, 仅显式与null比较时判断值是否缺失
+func isNull(n node) bool {
+	l, ok := n.(*literalNode)
+	return ok && l.value == nil
+}
+
+type pathNode struct {
+	path []string
+}
+
+func (n *pathNode) eval(env map[string]interface{}) interface{} {
+	var current interface{} = env
+	for _, key := range n.path {
+		current = lookup(current, key)
+		if current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(env map[string]interface{}) interface{} {
+	list := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		list[i] = item.eval(env)
+	}
+	return list
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(env map[string]interface{}) interface{} {
+	switch test(n.operand, env) {
+	case triTrue:
+		return false
+	case triFalse:
+		return true
+	}
+	return unknown
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(env map[string]interface{}) interface{} {
+	switch n.op {
+	case "&&":
+		left := test(n.left, env)
+		if left == triFalse {
+			return false
+		}
+		right := test(n.right, env)
+		if right == triFalse {
+			return false
+		}
+		if left == triUnknown || right == triUnknown {
+			return unknown
+		}
+		return true
+	case "||":
+		left := test(n.left, env)
+		if left == triTrue {
+			return true
+		}
+		right := test(n.right, env)
+		if right == triTrue {
+			return true
+		}
+		if left == triUnknown || right == triUnknown {
+			return unknown
+		}
+		return false
+	}
+	left, right := n.left.eval(env), n.right.eval(env)
+	if left == unknown || right == unknown {
+		return unknown
+	}
+	switch n.op {
+	case "==":
+		if isNull(n.left) || isNull(n.right) {
+			return left == nil && right == nil
+		}
+	case "!=":
+		if isNull(n.left) || isNull(n.right) {
+			return left != nil || right != nil
+		}
+	}
+	//缺失时结果未知, 避免deny规则 subject.tenant != "allowed" 放行没有tenant的subject
+	if left == nil || right == nil {
+		return unknown
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	case "in":
+		return contains(right, left)
+	case "contains":
+		return contains(left, right)
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	}
+	return false
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, value string) error {
+	t := p.next()
+	if t.kind != kind {
+		return fmt.Errorf("%w: expected %q at %d", ErrorSyntax, value, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOp && p.peek().value == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOp && p.peek().value == "&&" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if t := p.peek(); t.kind == tokenOp && t.value == "!" {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	var op string
+	switch {
+	case t.kind == tokenOp && t.value != "&&" && t.value != "||" && t.value != "!":
+		op = t.value
+	case t.kind == tokenIdent && (t.value == "in" || t.value == "contains"):
+		op = t.value
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseValue() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return &literalNode{t.value}, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid number %q at %d", ErrorSyntax, t.value, t.pos)
+		}
+		return &literalNode{f}, nil
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return &literalNode{true}, nil
+		case "false":
+			return &literalNode{false}, nil
+		case "null", "nil":
+			return &literalNode{nil}, nil
+		}
+		path := strings.Split(t.value, ".")
+		switch path[0] {
+		case "subject", "params", "request":
+		default:
+			return nil, fmt.Errorf("%w: unknown variable %q at %d", ErrorSyntax, t.value, t.pos)
+		}
+		//含-等字符的key使用["x-tenant-id"]访问
+		for p.peek().kind == tokenLBracket && p.tokens[p.pos+1].kind == tokenString {
+			p.next()
+			path = append(path, p.next().value)
+			if err := p.expect(tokenRBracket, "]"); err != nil {
+				return nil, err
+			}
+		}
+		return &pathNode{path: path}, nil
+	case tokenLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case tokenLBracket:
+		list := &listNode{}
+		if p.peek().kind == tokenRBracket {
+			p.next()
+			return list, nil
+		}
+		for {
+			item, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+			if p.peek().kind == tokenComma {
+				p.next()
+				continue
+			}
+			if err := p.expect(tokenRBracket, "]"); err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unexpected %q at %d", ErrorSyntax, t.value, t.pos)
+}
+
+// Expr 编译后的表达式, 实现Condition
+type Expr struct {
+	src  string
+	root node
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Match 结果未知时不匹配
+func (e *Expr) Match(r *Request) bool {
+	return test(e.root, r.env()) == triTrue
+}
+
+// MatchDeny 作为deny规则求值, 结果未知时匹配
+func (e *Expr) MatchDeny(r *Request) bool {
+	return test(e.root, r.env()) != triFalse
+}
+
+func Compile(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("%w: unexpected %q at %d", ErrorSyntax, t.value, t.pos)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+func MustCompile(src string) *Expr {
+	e, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func lookup(v interface{}, key string) interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m[key]
+	case map[string]string:
+		if val, ok := m[key]; ok {
+			return val
+		}
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		val := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if val.IsValid() {
+			return val.Interface()
+		}
+	}
+	return nil
+}
+
+func truthy(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case string:
+		return val != ""
+	case float64:
+		return val != 0
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() > 0
+	}
+	return true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case uint:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case uint32:
+		return float64(val), true
+	case interface{ Float64() (float64, error) }:
+		f, err := val.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	//缺失的值与任何值都不相等, 避免两边字段都缺失时匹配
+	if a == nil || b == nil {
+		return false
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+		if sb, ok := b.(string); ok {
+			fb, err := strconv.ParseFloat(sb, 64)
+			return err == nil && fa == fb
+		}
+	}
+	if sa, ok := a.(string); ok {
+		if _, ok := toFloat(b); ok {
+			return equal(b, a)
+		}
+		if sb, ok := b.(string); ok {
+			return sa == sb
+		}
+	}
+	if ba, ok := a.(bool); ok {
+		bb, ok := b.(bool)
+		return ok && ba == bb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(op string, a, b interface{}) bool {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		switch op {
+		case "<":
+			return fa < fb
+		case "<=":
+			return fa <= fb
+		case ">":
+			return fa > fb
+		case ">=":
+			return fa >= fb
+		}
+	}
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	if okA && okB {
+		switch op {
+		case "<":
+			return sa < sb
+		case "<=":
+			return sa <= sb
+		case ">":
+			return sa > sb
+		case ">=":
+			return sa >= sb
+		}
+	}
+	return false
+}
+
+// contains 集合包含元素, 或字符串包含子串; 缺失的值及空字符串子串不匹配
+func contains(collection, item interface{}) bool {
+	if collection == nil || item == nil {
+		return false
+	}
+	if s, ok := collection.(string); ok {
+		sub, ok := item.(string)
+		return ok && sub != "" && strings.Contains(s, sub)
+	}
+	rv := reflect.ValueOf(collection)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if equal(rv.Index(i).Interface(), item) {
+			return true
+		}
+	}
+	return false
+}
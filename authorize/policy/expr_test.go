@@ -0,0 +1,154 @@
+package policy
+
+import (
+	stderrors "errors"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		src    string
+		values []string
+	}{
+		{`subject.tenant == params.tenant`, []string{"subject.tenant", "==", "params.tenant", ""}},
+		{`a-1`, []string{"a", "-1", ""}},
+		{`subject.名称 == "值"`, []string{"subject.名称", "==", "值", ""}},
+		{`!(x<=1)`, []string{"!", "(", "x", "<=", "1", ")", ""}},
+		{`'a\'b'`, []string{"a'b", ""}},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenize(tt.src)
+		if err != nil {
+			t.Errorf("tokenize(%q) error = %v", tt.src, err)
+			continue
+		}
+		if len(tokens) != len(tt.values) {
+			t.Errorf("tokenize(%q) = %v, want %v", tt.src, tokens, tt.values)
+			continue
+		}
+		for i, tok := range tokens {
+			if tok.value != tt.values[i] {
+				t.Errorf("tokenize(%q)[%d] = %q, want %q", tt.src, i, tok.value, tt.values[i])
+			}
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, src := range []string{
+		`subject.a ==`,
+		`"unterminated`,
+		`(subject.a`,
+		`unknown.a == 1`,
+		`subject.a == 1 1`,
+		`subject.a # 1`,
+		`subject.a in [1, 2`,
+		`request.header["x-tenant-id" == "t1"`,
+		`request.header[1] == "t1"`,
+	} {
+		if _, err := Compile(src); !stderrors.Is(err, ErrorSyntax) {
+			t.Errorf("Compile(%q) error = %v, want %v", src, err, ErrorSyntax)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	r := &Request{
+		Subject: map[string]interface{}{
+			"tenant": "t1",
+			"level":  float64(3),
+			"roles":  []string{"admin", "user"},
+			"名称":     "张三",
+		},
+		Params: map[string]string{"tenant": "t1", "level": "3"},
+		Attributes: map[string]interface{}{
+			"method": "GET",
+			"header": map[string]string{"x-tenant-id": "t1"},
+		},
+	}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`subject.tenant == params.tenant`, true},
+		{`subject.tenant != params.tenant`, false},
+		{`subject.level == params.level`, true},
+		{`subject.level >= 3 && subject.level < 4`, true},
+		{`subject.roles contains "admin"`, true},
+		{`subject.roles contains "guest"`, false},
+		{`request.method in ["GET", "HEAD"]`, true},
+		{`!(request.method == "POST")`, true},
+		{`subject.tenant == "t2" || subject.roles contains "user"`, true},
+		{`subject.名称 == "张三"`, true},
+		{`request.header["x-tenant-id"] == subject.tenant`, true},
+		{`request.header['x-tenant-id'] in ["t1", "t2"]`, true},
+		{`subject["名称"] == "张三"`, true},
+		{`request.header["x-request-id"] == null`, true},
+		{`request.header["x-request-id"] != "r1"`, false},
+		// 缺失的变量参与的比较结果未知, Match为false
+		{`subject.missing == params.missing`, false},
+		{`subject.missing != params.missing`, false},
+		{`subject.missing != "blocked"`, false},
+		{`subject.tenant != "blocked"`, true},
+		{`subject.missing contains "a"`, false},
+		{`subject.roles contains subject.missing`, false},
+		{`subject.missing in ["a"]`, false},
+		{`subject.tenant contains ""`, false},
+		{`subject.tenant contains params.missing`, false},
+		{`subject.tenant contains "t"`, true},
+		{`subject.missing == ""`, false},
+		{`subject.missing in [null]`, false},
+		{`subject.missing == null`, true},
+		{`subject.tenant == null`, false},
+		{`subject.tenant != null`, true},
+		{`!(subject.missing == "a")`, false},
+		{`subject.missing`, false},
+		{`!subject.missing`, false},
+		{`subject.missing == "a" || subject.tenant == "t1"`, true},
+		{`subject.missing != null && subject.missing != "a"`, false},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q) error = %v", tt.src, err)
+			continue
+		}
+		if got := e.Match(r); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestMatchDeny(t *testing.T) {
+	r := &Request{
+		Subject: map[string]interface{}{"tenant": "t1", "roles": []string{"user"}},
+		Params:  map[string]string{"tenant": "t1"},
+	}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`subject.tenant != "t1"`, false},
+		{`subject.tenant != "t2"`, true},
+		// 缺失的变量参与的比较结果未知, 作为deny规则时匹配
+		{`subject.missing != "t1"`, true},
+		{`subject.missing == "t1"`, true},
+		{`!(subject.missing in ["t1"])`, true},
+		{`subject.roles contains subject.missing`, true},
+		{`subject.missing < 3`, true},
+		{`subject.missing`, true},
+		{`subject.tenant != params.missing`, true},
+		// 显式判断缺失时可以确定结果
+		{`subject.missing != null && subject.missing != "t1"`, false},
+		{`subject.missing == null`, true},
+		{`subject.tenant == null`, false},
+		{`subject.tenant == "t2" && subject.missing == "a"`, false},
+		{`subject.tenant == "t1" || subject.missing == "a"`, true},
+	}
+	for _, tt := range tests {
+		e := MustCompile(tt.src)
+		if got := e.MatchDeny(r); got != tt.want {
+			t.Errorf("MatchDeny(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package policy
+
+import (
+	"encoding/json"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/logger"
+	"github.com/kataras/iris/v12"
+	"github.com/thoas/go-funk"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type Effect int
+
+const (
+	EffectAllow Effect = iota
+	EffectDeny
+)
+
+func (e Effect) String() string {
+	if e == EffectDeny {
+		return "deny"
+	}
+	return "allow"
+}
+
+// Condition 规则条件, Go函数用ConditionFunc, 表达式用Compile
+type Condition interface {
+	Match(*Request) bool
+}
+
+// DenyCondition deny规则优先使用MatchDeny, 条件无法判定(如变量缺失)时应返回true
+type DenyCondition interface {
+	MatchDeny(*Request) bool
+}
+
+type ConditionFunc func(*Request) bool
+
+func (f ConditionFunc) Match(r *Request) bool {
+	return f(r)
+}
+
+// Rule Paths/Methods为空表示全部; 匹配到的规则中有deny则拒绝, 有allow则允许, 否则拒绝
+type Rule struct {
+	Name      string
+	Effect    Effect
+	Paths     []interface{}
+	Methods   []string
+	Condition Condition
+}
+
+func (r *Rule) applies(method string, currPath string) bool {
+	if len(r.Methods) > 0 && !funk.ContainsString(r.Methods, method) {
+		return false
+	}
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, path := range r.Paths {
+		switch v := path.(type) {
+		case string:
+			if v == currPath {
+				return true
+			}
+		case *regexp.Regexp:
+			if v.MatchString(currPath) {
+				return true
+			}
+		case func(string) bool:
+			if v(currPath) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match deny规则fail closed, 见DenyCondition
+func (r *Rule) match(req *Request) bool {
+	if c, ok := r.Condition.(DenyCondition); ok && r.Effect == EffectDeny {
+		return c.MatchDeny(req)
+	}
+	return r.Condition.Match(req)
+}
+
+func Allow(name string, condition Condition) Rule {
+	return Rule{Name: name, Effect: EffectAllow, Condition: condition}
+}
+
+func Deny(name string, condition Condition) Rule {
+	return Rule{Name: name, Effect: EffectDeny, Condition: condition}
+}
+
+// Request 规则求值的输入, 表达式中通过subject/params/request访问
+type Request struct {
+	Ctx        *baseContext.Context
+	Identity   *authorize.Identity
+	Subject    map[string]interface{}
+	Params     map[string]string
+	Attributes map[string]interface{}
+	vars       map[string]interface{}
+}
+
+func (r *Request) env() map[string]interface{} {
+	if r.vars == nil {
+		r.vars = map[string]interface{}{
+			"subject": r.Subject,
+			"params":  r.Params,
+			"request": r.Attributes,
+		}
+	}
+	return r.vars
+}
+
+func NewRequest(ctx *baseContext.Context) *Request {
+	r := &Request{
+		Ctx:      ctx,
+		Identity: authorize.GetIdentity(ctx),
+		Subject:  make(map[string]interface{}),
+		Params:   make(map[string]string),
+	}
+	if r.Identity != nil {
+		if r.Identity.Claims != nil {
+			if b, err := json.Marshal(r.Identity.Claims); err == nil {
+				_ = json.Unmarshal(b, &r.Subject)
+			}
+		}
+		r.Subject["sub"] = r.Identity.Subject
+		r.Subject["scopes"] = r.Identity.Scopes
+		r.Subject["roles"] = r.Identity.Roles
+		r.Subject["scheme"] = r.Identity.Scheme
+	}
+	ctx.Params().Visit(func(key string, value string) {
+		r.Params[key] = value
+	})
+	header := make(map[string]string, len(ctx.Request().Header))
+	for key := range ctx.Request().Header {
+		header[strings.ToLower(key)] = ctx.Request().Header.Get(key)
+	}
+	query := make(map[string]string)
+	for key, values := range ctx.Request().URL.Query() {
+		if len(values) > 0 {
+			query[key] = values[0]
+		}
+	}
+	r.Attributes = map[string]interface{}{
+		"method": ctx.Method(),
+		"path":   ctx.Path(),
+		"host":   ctx.Host(),
+		"ip":     ctx.GetIP(),
+		"header": header,
+		"query":  query,
+	}
+	return r
+}
+
+type Decision struct {
+	Allowed bool
+	Rule    string
+	DryRun  bool
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{}
+}
+
+func WithRules(rules ...Rule) Option {
+	return func(opts *Config) {
+		opts.Rules = append(opts.Rules, rules...)
+	}
+}
+
+// WithExpr 以表达式添加规则, 表达式错误时panic
+func WithExpr(name string, effect Effect, expr string, paths ...interface{}) Option {
+	return func(opts *Config) {
+		opts.Rules = append(opts.Rules, Rule{Name: name, Effect: effect, Paths: paths, Condition: MustCompile(expr)})
+	}
+}
+
+// WithLogger 记录每次决策
+func WithLogger(val logger.Logger) Option {
+	return func(opts *Config) {
+		opts.Logger = val
+	}
+}
+
+// WithDryRun 只记录决策不拦截, 用于上线前观察
+func WithDryRun(val bool) Option {
+	return func(opts *Config) {
+		opts.DryRun = val
+	}
+}
+func WithIgnorePaths(paths ...interface{}) Option {
+	return func(opts *Config) {
+		opts.IgnorePaths = append(opts.IgnorePaths, paths...)
+	}
+}
+
+type Config struct {
+	Rules       []Rule
+	Logger      logger.Logger
+	DryRun      bool
+	IgnorePaths []interface{}
+}
+
+func New(opts ...Option) *Policy {
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	for _, rule := range config.Rules {
+		if rule.Condition == nil {
+			panic("rule " + rule.Name + " condition 必须设置")
+		}
+	}
+	return &Policy{
+		Config: config,
+		ignore: &Rule{Paths: config.IgnorePaths},
+	}
+}
+
+type Policy struct {
+	*Config
+	ignore *Rule
+}
+
+// Evaluate 默认拒绝: 无匹配的allow规则或命中任一deny规则时拒绝
+func (p *Policy) Evaluate(r *Request) *Decision {
+	decision := &Decision{DryRun: p.DryRun}
+	method, currPath := r.Ctx.Method(), r.Ctx.Path()
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if !rule.applies(method, currPath) || !rule.match(r) {
+			continue
+		}
+		if rule.Effect == EffectDeny {
+			decision.Allowed = false
+			decision.Rule = rule.Name
+			return decision
+		}
+		if !decision.Allowed {
+			decision.Allowed = true
+			decision.Rule = rule.Name
+		}
+	}
+	return decision
+}
+
+func (p *Policy) Context(ctx *baseContext.Context) {
+	if len(p.IgnorePaths) > 0 && p.ignore.applies(ctx.Method(), ctx.Path()) {
+		ctx.Next()
+		return
+	}
+
+	r := NewRequest(ctx)
+	decision := p.Evaluate(r)
+	p.log(r, decision)
+	if decision.Allowed || p.DryRun {
+		ctx.Next()
+		return
+	}
+
+	ctx.SetRejected(baseContext.RejectedAuthorize)
+	ctx.StatusCode(http.StatusForbidden)
+	ctx.Error(baseError.NewCode(ctx.ErrorCodes["Forbidden"], "forbidden by policy"))
+}
+
+func (p *Policy) Handler() iris.Handler {
+	return baseContext.Handler(p.Context)
+}
+
+func (p *Policy) log(r *Request, decision *Decision) {
+	rule := decision.Rule
+	if rule == "" {
+		rule = "default-deny"
+	}
+	if p.Logger == nil {
+		r.Ctx.AddLogField("policy", rule)
+		return
+	}
+	effect := EffectDeny
+	if decision.Allowed {
+		effect = EffectAllow
+	}
+	fields := []*logger.Field{
+		logger.NewField("decision", effect.String()),
+		logger.NewField("rule", rule),
+		logger.NewField("method", r.Ctx.Method()),
+		logger.NewField("path", r.Ctx.Path()),
+		logger.NewField("dry_run", decision.DryRun),
+	}
+	if r.Identity != nil {
+		fields = append(fields, logger.NewField("subject", r.Identity.Subject))
+	}
+	if requestId := r.Ctx.Values().GetString("requestId"); requestId != "" {
+		fields = append(fields, logger.NewField("request_id", requestId))
+	}
+	if decision.Allowed {
+		p.Logger.Info("policy", fields...)
+	} else {
+		p.Logger.Warn("policy", fields...)
+	}
+}
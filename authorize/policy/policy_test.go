@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"encoding/json"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestApp X-Tenant为"-"时subject没有tenant
+func newTestApp(t *testing.T, p *Policy) *iris.Application {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	identity := baseContext.Handler(func(ctx *baseContext.Context) {
+		claims := map[string]interface{}{}
+		if tenant := ctx.GetHeader("X-Tenant"); tenant != "-" {
+			claims["tenant"] = tenant
+		}
+		authorize.SetIdentity(ctx, &authorize.Identity{Subject: "u1", Claims: claims})
+		ctx.Next()
+	})
+	app.Get("/", identity, p.Handler(), baseContext.Handler(func(ctx *baseContext.Context) {
+		ctx.WriteString("ok")
+	}))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func serve(app *iris.Application, tenant string) string {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant", tenant)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	var resp struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		return w.Body.String()
+	}
+	return resp.Code
+}
+
+func TestDenyFailClosed(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		tenant string
+		want   string
+	}{
+		{"expr", New(WithExpr("user", EffectAllow, `subject.sub != null`), WithExpr("tenant", EffectDeny, `subject.tenant != "t1"`)), "t1", "ok"},
+		{"expr", New(WithExpr("user", EffectAllow, `subject.sub != null`), WithExpr("tenant", EffectDeny, `subject.tenant != "t1"`)), "t2", baseContext.ErrorForbidden},
+		//缺少tenant时deny规则无法判定, 拒绝
+		{"expr", New(WithExpr("user", EffectAllow, `subject.sub != null`), WithExpr("tenant", EffectDeny, `subject.tenant != "t1"`)), "-", baseContext.ErrorForbidden},
+		{"exprNull", New(WithExpr("user", EffectAllow, `subject.sub != null`), WithExpr("tenant", EffectDeny, `subject.tenant != null && subject.tenant != "t1"`)), "-", "ok"},
+		//allow规则无法判定时不匹配
+		{"allow", New(WithExpr("tenant", EffectAllow, `!(subject.tenant == "t2")`)), "-", baseContext.ErrorForbidden},
+		{"func", New(WithExpr("user", EffectAllow, `subject.sub != null`), WithRules(Deny("tenant", ConditionFunc(func(r *Request) bool {
+			return r.Subject["tenant"] == "t2"
+		})))), "-", "ok"},
+	}
+	for _, tt := range tests {
+		if got := serve(newTestApp(t, tt.policy), tt.tenant); got != tt.want {
+			t.Errorf("%s(%q) = %s, want %s", tt.name, tt.tenant, got, tt.want)
+		}
+	}
+}
+
+// TestHeaderKey header名转为小写, 含-的header用["key"]访问
+func TestHeaderKey(t *testing.T) {
+	p := New(WithExpr("tenant", EffectAllow, `request.header["x-tenant"] == subject.tenant`))
+	app := newTestApp(t, p)
+	if got := serve(app, "t1"); got != "ok" {
+		t.Errorf("header = %s, want ok", got)
+	}
+	if got := serve(app, "-"); got != baseContext.ErrorForbidden {
+		t.Errorf("missing tenant = %s, want %s", got, baseContext.ErrorForbidden)
+	}
+}
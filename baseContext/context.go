@@ -22,9 +22,23 @@ import (
 )
 
 var (
-	ErrorSystem     = "100"
-	ErrorReadParams = "101"
-	ErrorValidation = "102"
+	ErrorSystem             = "100"
+	ErrorReadParams         = "101"
+	ErrorValidation         = "102"
+	ErrorUnauthorized       = "103"
+	ErrorForbidden          = "104"
+	ErrorReplay             = "105"
+	ErrorTimestampMissing   = "106"
+	ErrorTimestampMalformed = "107"
+	ErrorTimestampFuture    = "108"
+	ErrorTimestampExpired   = "109"
+)
+
+// 中间件拒绝请求的原因, 供metrics等统计
+const (
+	RejectedLimiter   = "limiter"
+	RejectedSignature = "signature"
+	RejectedAuthorize = "authorize"
 )
 
 type Logger interface {
@@ -66,6 +80,27 @@ func New(env string, logger Logger, opts ...Option) {
 	if baseContext.ErrorCodes["Validation"] == "" {
 		baseContext.ErrorCodes["Validation"] = ErrorValidation
 	}
+	if baseContext.ErrorCodes["Unauthorized"] == "" {
+		baseContext.ErrorCodes["Unauthorized"] = ErrorUnauthorized
+	}
+	if baseContext.ErrorCodes["Forbidden"] == "" {
+		baseContext.ErrorCodes["Forbidden"] = ErrorForbidden
+	}
+	if baseContext.ErrorCodes["Replay"] == "" {
+		baseContext.ErrorCodes["Replay"] = ErrorReplay
+	}
+	if baseContext.ErrorCodes["TimestampMissing"] == "" {
+		baseContext.ErrorCodes["TimestampMissing"] = ErrorTimestampMissing
+	}
+	if baseContext.ErrorCodes["TimestampMalformed"] == "" {
+		baseContext.ErrorCodes["TimestampMalformed"] = ErrorTimestampMalformed
+	}
+	if baseContext.ErrorCodes["TimestampFuture"] == "" {
+		baseContext.ErrorCodes["TimestampFuture"] = ErrorTimestampFuture
+	}
+	if baseContext.ErrorCodes["TimestampExpired"] == "" {
+		baseContext.ErrorCodes["TimestampExpired"] = ErrorTimestampExpired
+	}
 }
 
 func WithApplicationName(val string) Option {
@@ -113,6 +148,69 @@ func WithValidationErrorCode(val string) Option {
 	}
 }
 
+func WithUnauthorizedErrorCode(val string) Option {
+	return func(ctx *Context) {
+		if ctx.ErrorCodes == nil {
+			ctx.ErrorCodes = make(map[string]string)
+		}
+		ctx.ErrorCodes["Unauthorized"] = val
+	}
+}
+
+func WithForbiddenErrorCode(val string) Option {
+	return func(ctx *Context) {
+		if ctx.ErrorCodes == nil {
+			ctx.ErrorCodes = make(map[string]string)
+		}
+		ctx.ErrorCodes["Forbidden"] = val
+	}
+}
+
+func WithReplayErrorCode(val string) Option {
+	return func(ctx *Context) {
+		if ctx.ErrorCodes == nil {
+			ctx.ErrorCodes = make(map[string]string)
+		}
+		ctx.ErrorCodes["Replay"] = val
+	}
+}
+
+func WithTimestampMissingErrorCode(val string) Option {
+	return func(ctx *Context) {
+		if ctx.ErrorCodes == nil {
+			ctx.ErrorCodes = make(map[string]string)
+		}
+		ctx.ErrorCodes["TimestampMissing"] = val
+	}
+}
+
+func WithTimestampMalformedErrorCode(val string) Option {
+	return func(ctx *Context) {
+		if ctx.ErrorCodes == nil {
+			ctx.ErrorCodes = make(map[string]string)
+		}
+		ctx.ErrorCodes["TimestampMalformed"] = val
+	}
+}
+
+func WithTimestampFutureErrorCode(val string) Option {
+	return func(ctx *Context) {
+		if ctx.ErrorCodes == nil {
+			ctx.ErrorCodes = make(map[string]string)
+		}
+		ctx.ErrorCodes["TimestampFuture"] = val
+	}
+}
+
+func WithTimestampExpiredErrorCode(val string) Option {
+	return func(ctx *Context) {
+		if ctx.ErrorCodes == nil {
+			ctx.ErrorCodes = make(map[string]string)
+		}
+		ctx.ErrorCodes["TimestampExpired"] = val
+	}
+}
+
 func WithSystemErrorTypes(val ...string) Option {
 	return func(ctx *Context) {
 		ctx.SystemErrorTypes = append(ctx.SystemErrorTypes, val...)
@@ -293,13 +391,11 @@ func (ctx *Context) BaseError(err error) (e *baseError.Error) {
 
 	//参数校验失败
 	if errorType == "*json.SyntaxError" || errorType == "validator.ValidationErrors" || errorType == "schema.MultiError" {
-		if errorType == "*json.SyntaxError" {
-			e = baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
-		} else if errorType == "validator.ValidationErrors" {
+		if errorType == "validator.ValidationErrors" {
 			emap := err.(validator.ValidationErrors).Translate(validate.Validate.Trans)
-			e = baseError.NewCodeWrap(ctx.ErrorCodes["Validation"], errors.New(fmt.Sprint(emap)))
+			e = baseError.NewCodeWrap(ctx.ErrorCode(err), errors.New(fmt.Sprint(emap)))
 		} else {
-			e = baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
+			e = baseError.NewCodeWrap(ctx.ErrorCode(err), err)
 		}
 		return e
 	}
@@ -318,6 +414,24 @@ func (ctx *Context) BaseError(err error) (e *baseError.Error) {
 	return e
 }
 
+// ErrorCode 返回err经BaseError转换后的错误码, 不输出日志也不设置ctx错误
+func (ctx *Context) ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	switch reflect.TypeOf(err).String() {
+	case "*baseError.Error":
+		if code := err.(*baseError.Error).Code; code != "" {
+			return code
+		}
+	case "*json.SyntaxError", "schema.MultiError":
+		return ctx.ErrorCodes["ReadParams"]
+	case "validator.ValidationErrors":
+		return ctx.ErrorCodes["Validation"]
+	}
+	return ctx.ErrorCodes["System"]
+}
+
 func (ctx *Context) GetIP() string {
 	ip := ctx.RemoteAddr()
 	if ctx.GetHeader("X-REAL-IP") != "" {
@@ -430,6 +544,14 @@ func (ctx *Context) SetTraceCtx(traceCtx context.Context) {
 	ctx.Values().Set("traceCtx", traceCtx)
 }
 
+func (ctx *Context) SetRejected(reason string) {
+	ctx.Values().Set("rejected", reason)
+}
+
+func (ctx *Context) GetRejected() string {
+	return ctx.Values().GetString("rejected")
+}
+
 func (ctx *Context) SetResponse(response NewResponse) {
 	ctx.Values().Set("response", response)
 }
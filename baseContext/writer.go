@@ -0,0 +1,90 @@
+package baseContext
+
+import (
+	"bufio"
+	"github.com/kataras/iris/v12/context"
+	"net"
+	"net/http"
+)
+
+const responseTrackerContextKey = "responseTracker"
+
+// responseTracker 位于最底层writer之上, 响应完全写出(含压缩flush)后回调
+// 插在recorder/压缩writer之下, 不影响iris对ctx.ResponseWriter()的类型判断
+type responseTracker struct {
+	context.ResponseWriter
+	done []func()
+}
+
+func (w *responseTracker) EndResponse() {
+	for _, fn := range w.done {
+		fn()
+	}
+	w.done = nil
+	w.ResponseWriter.EndResponse()
+}
+
+func (w *responseTracker) Reset() bool {
+	rs, ok := w.ResponseWriter.(context.ResponseWriterReseter)
+	return ok && rs.Reset()
+}
+
+func (w *responseTracker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (ctx *Context) responseTracker() *responseTracker {
+	if t, ok := ctx.Values().Get(responseTrackerContextKey).(*responseTracker); ok {
+		return t
+	}
+
+	var parent context.ResponseWriter
+	w := ctx.ResponseWriter()
+loop:
+	for {
+		switch v := w.(type) {
+		case *context.ResponseRecorder:
+			parent, w = v, v.ResponseWriter
+		case *context.CompressResponseWriter:
+			parent, w = v, v.ResponseWriter
+		default:
+			break loop
+		}
+	}
+
+	t := &responseTracker{ResponseWriter: w}
+	switch v := parent.(type) {
+	case *context.ResponseRecorder:
+		v.ResponseWriter = t
+	case *context.CompressResponseWriter:
+		v.ResponseWriter = t
+	default:
+		ctx.ResetResponseWriter(t)
+	}
+	ctx.Values().Set(responseTrackerContextKey, t)
+	return t
+}
+
+// OnResponseEnd 响应完全写出后回调, 压缩writer此时已flush, 可读取ResponseSize
+func (ctx *Context) OnResponseEnd(cb func(*Context)) {
+	t := ctx.responseTracker()
+	original := ctx.Context
+	t.done = append(t.done, func() {
+		Handler(cb)(original)
+	})
+}
+
+// ResponseSize 写入连接的响应字节数, 开启压缩时为压缩后的字节数, 需在OnResponseEnd回调中读取; 未统计时返回-1
+func (ctx *Context) ResponseSize() int64 {
+	t, ok := ctx.Values().Get(responseTrackerContextKey).(*responseTracker)
+	if !ok {
+		return -1
+	}
+	if n := t.ResponseWriter.Written(); n > 0 {
+		return int64(n)
+	}
+	return 0
+}
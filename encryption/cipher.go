@@ -0,0 +1,195 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	stderrors "errors"
+	"github.com/emmansun/gmsm/sm4"
+	"io"
+)
+
+var (
+	// ErrorDecrypt 解密/验证/解包key的所有失败都返回该错误, 不区分原因
+	ErrorDecrypt = stderrors.New("decrypt failed")
+	ErrorIV      = stderrors.New("invalid iv length")
+)
+
+// Cipher 对称加密, 密文包含随机nonce/iv
+type Cipher interface {
+	Encrypt(key []byte, plaintext []byte) ([]byte, error)
+	Decrypt(key []byte, ciphertext []byte) ([]byte, error)
+}
+
+// GCM 密文格式: nonce(12) || ciphertext || tag
+type GCM struct {
+	NewBlock func(key []byte) (cipher.Block, error)
+}
+
+func NewAESGCM() *GCM {
+	return &GCM{NewBlock: aes.NewCipher}
+}
+
+func NewSM4GCM() *GCM {
+	return &GCM{NewBlock: sm4.NewCipher}
+}
+
+func (c *GCM) aead(key []byte) (cipher.AEAD, error) {
+	block, err := c.NewBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *GCM) Encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c *GCM) Decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, ErrorDecrypt
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrorDecrypt
+	}
+	nonce, data := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, ErrorDecrypt
+	}
+	return plaintext, nil
+}
+
+// CBC 标准CBC PKCS7填充, 密文格式: [iv] || ciphertext, 无完整性保护, 用于对接已有的"AES-CBC/SM4-CBC PKCS7"接口
+// IV为空时随机生成并放在密文前; IV固定时密文不含iv, 相同明文得到相同密文, 只用于兼容要求固定IV的对方
+// MAC为true时encrypt-then-MAC, 追加tag = HMAC-SHA256(macKey, iv || ciphertext), 32字节; macKey = HMAC-SHA256(key, "cbc-hmac-sha256")
+// 验证tag通过后才解密. 带tag的格式为本包自定义, 对方需按同样方式生成tag, 见NewAESCBCHMAC
+type CBC struct {
+	NewBlock func(key []byte) (cipher.Block, error)
+	IV       []byte
+	MAC      bool
+}
+
+// NewAESCBC 标准AES-CBC PKCS7, iv为空时密文前16字节为iv
+func NewAESCBC(iv []byte) *CBC {
+	return &CBC{NewBlock: aes.NewCipher, IV: iv}
+}
+
+// NewSM4CBC 标准SM4-CBC PKCS7, iv为空时密文前16字节为iv
+func NewSM4CBC(iv []byte) *CBC {
+	return &CBC{NewBlock: sm4.NewCipher, IV: iv}
+}
+
+// NewAESCBCHMAC AES-CBC + HMAC-SHA256 tag, 本包自定义格式, 双方都使用本包时优先于NewAESCBC; 新接口建议使用GCM
+func NewAESCBCHMAC(iv []byte) *CBC {
+	return &CBC{NewBlock: aes.NewCipher, IV: iv, MAC: true}
+}
+
+// NewSM4CBCHMAC SM4-CBC + HMAC-SHA256 tag, 格式见CBC
+func NewSM4CBCHMAC(iv []byte) *CBC {
+	return &CBC{NewBlock: sm4.NewCipher, IV: iv, MAC: true}
+}
+
+// macKey 由key派生MAC key, 与加密key分离
+func macKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("cbc-hmac-sha256"))
+	return mac.Sum(nil)
+}
+
+func (c *CBC) mac(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, macKey(key))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (c *CBC) Encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := c.NewBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	size := block.BlockSize()
+	if c.IV != nil && len(c.IV) != size {
+		return nil, ErrorIV
+	}
+	data := pkcs7Pad(plaintext, size)
+	var ciphertext []byte
+	if c.IV != nil {
+		ciphertext = make([]byte, len(data))
+		cipher.NewCBCEncrypter(block, c.IV).CryptBlocks(ciphertext, data)
+	} else {
+		ciphertext = make([]byte, size+len(data))
+		iv := ciphertext[:size]
+		if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+			return nil, err
+		}
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext[size:], data)
+	}
+	if !c.MAC {
+		return ciphertext, nil
+	}
+	return append(ciphertext, c.mac(key, append(append([]byte{}, c.IV...), ciphertext...))...), nil
+}
+
+// Decrypt 所有失败返回同一个错误, 避免padding oracle
+func (c *CBC) Decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	block, err := c.NewBlock(key)
+	if err != nil {
+		return nil, ErrorDecrypt
+	}
+	if c.MAC {
+		if len(ciphertext) < sha256.Size {
+			return nil, ErrorDecrypt
+		}
+		data, tag := ciphertext[:len(ciphertext)-sha256.Size], ciphertext[len(ciphertext)-sha256.Size:]
+		if !hmac.Equal(tag, c.mac(key, append(append([]byte{}, c.IV...), data...))) {
+			return nil, ErrorDecrypt
+		}
+		ciphertext = data
+	}
+	size := block.BlockSize()
+	iv := c.IV
+	if iv == nil {
+		if len(ciphertext) < size {
+			return nil, ErrorDecrypt
+		}
+		iv, ciphertext = ciphertext[:size], ciphertext[size:]
+	}
+	if len(iv) != size || len(ciphertext) == 0 || len(ciphertext)%size != 0 {
+		return nil, ErrorDecrypt
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	return pkcs7Unpad(plaintext, size)
+}
+
+func pkcs7Pad(data []byte, size int) []byte {
+	n := size - len(data)%size
+	return append(append([]byte{}, data...), bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func pkcs7Unpad(data []byte, size int) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > size {
+		return nil, ErrorDecrypt
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, ErrorDecrypt
+		}
+	}
+	return data[:len(data)-n], nil
+}
@@ -0,0 +1,374 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/kataras/iris/v12"
+	"github.com/thoas/go-funk"
+	"io"
+	"net/http"
+)
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		DataProperty: "data",
+		KeyProperty:  "key",
+		Response:     true,
+		MaxBodySize:  1 << 20,
+	}
+}
+
+// WithKey 所有调用方共用的对称key
+func WithKey(val []byte) Option {
+	return func(opts *Config) {
+		opts.Key = val
+	}
+}
+
+// WithKeyStore 按appId使用调用方的key, appId从header读取
+// header为空时使用已验证的Identity.Subject, 必须在authorize/signature等设置Identity的中间件之后注册, 否则拒绝请求
+func WithKeyStore(store KeyStore, header string) Option {
+	return func(opts *Config) {
+		if store == nil {
+			panic("key store 必须设置")
+		}
+		opts.KeyStore = store
+		opts.AppIdHeader = header
+	}
+}
+
+// WithKeyWrapper 对称key由调用方生成并加密后放在KeyProperty, 响应使用同一个key加密
+func WithKeyWrapper(val KeyWrapper) Option {
+	return func(opts *Config) {
+		opts.KeyWrapper = val
+	}
+}
+func WithDataProperty(val string) Option {
+	return func(opts *Config) {
+		opts.DataProperty = val
+	}
+}
+func WithKeyProperty(val string) Option {
+	return func(opts *Config) {
+		opts.KeyProperty = val
+	}
+}
+
+// WithEncryptResponse 是否加密Success/Error输出, 默认加密
+func WithEncryptResponse(val bool) Option {
+	return func(opts *Config) {
+		opts.Response = val
+	}
+}
+
+// WithAllowPlaintext WithKeyWrapper时允许不带加密信封的请求(如GET), 请求和响应均为明文, 默认拒绝
+func WithAllowPlaintext(val bool) Option {
+	return func(opts *Config) {
+		opts.AllowPlaintext = val
+	}
+}
+
+// WithMaxBodySize 请求body的最大字节数, 默认1MB
+func WithMaxBodySize(val int64) Option {
+	return func(opts *Config) {
+		opts.MaxBodySize = val
+	}
+}
+func WithIgnorePaths(val ...string) Option {
+	return func(opts *Config) {
+		opts.IgnorePaths = append(opts.IgnorePaths, val...)
+	}
+}
+
+type Config struct {
+	Key            []byte
+	KeyStore       KeyStore
+	AppIdHeader    string
+	KeyWrapper     KeyWrapper
+	DataProperty   string
+	KeyProperty    string
+	Response       bool
+	AllowPlaintext bool
+	MaxBodySize    int64
+	IgnorePaths    []string
+}
+
+// New 请求body格式: {"data":"base64密文","key":"base64加密的key"}, key仅WithKeyWrapper时需要
+func New(cipher Cipher, opts ...Option) *Encryption {
+	if cipher == nil {
+		panic("cipher 必须设置")
+	}
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	if config.Key == nil && config.KeyStore == nil && config.KeyWrapper == nil {
+		panic("key/keyStore/keyWrapper 必须设置一个")
+	}
+	return &Encryption{
+		Cipher: cipher,
+		Config: config,
+	}
+}
+
+type Encryption struct {
+	Cipher Cipher
+	*Config
+}
+
+func (e *Encryption) Context(ctx *baseContext.Context) {
+	if funk.ContainsString(e.IgnorePaths, ctx.Path()) {
+		ctx.Next()
+		return
+	}
+	key, err := e.decrypt(ctx)
+	//key确定后错误响应也加密
+	if key != nil {
+		SetKey(ctx, key)
+		if e.Config.Response {
+			e.Wrap(ctx, key)
+		}
+	}
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.Next()
+}
+
+// decrypt 解密body并替换, 后续的JSONReqBody读取明文
+func (e *Encryption) decrypt(ctx *baseContext.Context) ([]byte, error) {
+	var key []byte
+	if e.Config.KeyWrapper == nil {
+		var err error
+		if key, err = e.key(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	req := ctx.Request()
+	if req.Body == nil {
+		return e.plaintext(ctx, key)
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.ResponseWriter(), req.Body, e.Config.MaxBodySize))
+	_ = req.Body.Close()
+	var maxBytesError *http.MaxBytesError
+	if stderrors.As(err, &maxBytesError) {
+		return key, baseError.NewCode(ctx.ErrorCodes["ReadParams"], "request body too large")
+	}
+	if err != nil {
+		return key, baseError.NewSystemWrap(err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return e.plaintext(ctx, key)
+	}
+
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return key, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
+	}
+	if e.Config.KeyWrapper != nil {
+		wrapped, err := e.property(envelope, e.Config.KeyProperty)
+		if err != nil {
+			return nil, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
+		}
+		if key, err = e.Config.KeyWrapper.Unwrap(wrapped); err != nil {
+			return nil, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], ErrorDecrypt)
+		}
+	}
+	ciphertext, err := e.property(envelope, e.Config.DataProperty)
+	if err != nil {
+		return key, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
+	}
+	//解密失败不区分原因, 避免padding/Bleichenbacher oracle
+	plaintext, err := e.Cipher.Decrypt(key, ciphertext)
+	if err != nil {
+		return key, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], ErrorDecrypt)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(plaintext))
+	req.ContentLength = int64(len(plaintext))
+	return key, nil
+}
+
+// plaintext 请求没有加密信封, WithKeyWrapper时无法确定响应的key, 未允许明文时拒绝
+func (e *Encryption) plaintext(ctx *baseContext.Context, key []byte) ([]byte, error) {
+	if key == nil && !e.Config.AllowPlaintext {
+		return nil, baseError.NewCode(ctx.ErrorCodes["ReadParams"], "missing "+e.Config.KeyProperty)
+	}
+	return key, nil
+}
+
+// key WithKeyStore时按appId查找, 否则使用WithKey
+func (e *Encryption) key(ctx *baseContext.Context) ([]byte, error) {
+	if e.Config.KeyStore == nil {
+		return e.Config.Key, nil
+	}
+	var appId string
+	if e.Config.AppIdHeader != "" {
+		appId = ctx.GetHeader(e.Config.AppIdHeader)
+	} else {
+		identity := authorize.GetIdentity(ctx)
+		if identity == nil {
+			return nil, baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "missing identity, encryption must run after authorize")
+		}
+		appId = identity.Subject
+	}
+	if appId == "" {
+		return nil, baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "missing appId")
+	}
+	key, err := e.Config.KeyStore.Key(ctx.RequestCtx(), appId)
+	if stderrors.Is(err, ErrorKeyNotFound) {
+		return nil, baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], err)
+	}
+	if err != nil {
+		return nil, baseError.NewSystemWrap(err)
+	}
+	return key, nil
+}
+
+func (e *Encryption) property(envelope map[string]interface{}, property string) ([]byte, error) {
+	v, ok := envelope[property].(string)
+	if !ok || v == "" {
+		return nil, fmt.Errorf("missing %s", property)
+	}
+	return base64.StdEncoding.DecodeString(v)
+}
+
+// Encrypt 返回加密后的信封, 用于调用方或自定义输出
+func (e *Encryption) Encrypt(key []byte, plaintext []byte) (map[string]interface{}, error) {
+	ciphertext, err := e.Cipher.Encrypt(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		e.Config.DataProperty: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// Wrap 替换当前请求的NewResponse, 渲染时使用key加密
+func (e *Encryption) Wrap(ctx *baseContext.Context, key []byte) {
+	next := ctx.Response
+	if v := ctx.Values().Get("response"); v != nil {
+		if response, ok := v.(baseContext.NewResponse); ok {
+			next = response
+		}
+	}
+	ctx.SetResponse(func() baseContext.Response {
+		return &encryptedResponse{Response: next(), next: next, encryption: e, key: key, ctx: ctx}
+	})
+}
+
+func (e *Encryption) Handler() iris.Handler {
+	return baseContext.Handler(e.Context)
+}
+
+func SetKey(ctx *baseContext.Context, key []byte) {
+	ctx.Values().Set("encryptionKey", key)
+}
+
+func GetKey(ctx *baseContext.Context) []byte {
+	if v := ctx.Values().Get("encryptionKey"); v != nil {
+		if key, ok := v.([]byte); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// encryptedResponse 包装Response, Content时加密, 链式调用返回自身
+type encryptedResponse struct {
+	baseContext.Response
+	next       baseContext.NewResponse
+	encryption *Encryption
+	key        []byte
+	ctx        *baseContext.Context
+}
+
+func (r *encryptedResponse) Success() baseContext.Response {
+	r.Response.Success()
+	return r
+}
+
+func (r *encryptedResponse) Error(err *baseError.Error) baseContext.Response {
+	r.Response.Error(err)
+	return r
+}
+
+func (r *encryptedResponse) SetCode(code string) baseContext.Response {
+	r.Response.SetCode(code)
+	return r
+}
+
+func (r *encryptedResponse) SetMessage(message string) baseContext.Response {
+	r.Response.SetMessage(message)
+	return r
+}
+
+func (r *encryptedResponse) SetData(data interface{}) baseContext.Response {
+	r.Response.SetData(data)
+	return r
+}
+
+func (r *encryptedResponse) SetRid(rid string) baseContext.Response {
+	r.Response.SetRid(rid)
+	return r
+}
+
+// Content json输出加密信封, text输出base64密文, binary输出密文; 加密失败时输出系统错误(500), 不输出明文
+func (r *encryptedResponse) Content() interface{} {
+	content := r.Response.Content()
+	var plaintext []byte
+	var err error
+	switch r.Response.ContentType() {
+	case "text":
+		plaintext = []byte(content.(string))
+	case "binary":
+		plaintext = content.([]byte)
+	default:
+		plaintext, err = json.Marshal(content)
+	}
+	var ciphertext []byte
+	if err == nil {
+		ciphertext, err = r.encryption.Cipher.Encrypt(r.key, plaintext)
+	}
+	if err != nil {
+		return r.failed(err)
+	}
+	switch r.Response.ContentType() {
+	case "text":
+		return base64.StdEncoding.EncodeToString(ciphertext)
+	case "binary":
+		return ciphertext
+	}
+	return map[string]interface{}{
+		r.encryption.Config.DataProperty: base64.StdEncoding.EncodeToString(ciphertext),
+	}
+}
+
+// failed 使用未包装的Response输出系统错误, 错误信息不含响应内容
+func (r *encryptedResponse) failed(err error) interface{} {
+	r.ctx.Application().Logger().Errorf("response encryption: %s", err)
+	e := baseError.NewCode(r.ctx.ErrorCodes["System"], "response encryption failed", baseError.WithSystem())
+	r.ctx.SetErr(e)
+	r.ctx.StatusCode(http.StatusInternalServerError)
+	switch r.Response.ContentType() {
+	case "text":
+		return ""
+	case "binary":
+		return []byte{}
+	}
+	resp := r.next().Error(e)
+	if requestId := r.ctx.Values().GetString("requestId"); requestId != "" {
+		resp.SetRid(requestId)
+	}
+	return resp.Content()
+}
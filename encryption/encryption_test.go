@@ -0,0 +1,219 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"net/http/httptest"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+func newTestApp(t *testing.T, e *Encryption) *iris.Application {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	handler := baseContext.Handler(func(ctx *baseContext.Context) {
+		var params map[string]interface{}
+		_ = ctx.ReadJSON(&params)
+		ctx.Success(map[string]interface{}{"secret": "s3cr3t", "params": params})
+	})
+	app.Get("/", e.Handler(), handler)
+	app.Post("/", e.Handler(), handler)
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func serve(app *iris.Application, method string, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(method, "/", bytes.NewReader(body)))
+	return w
+}
+
+func envelope(t *testing.T, c Cipher, key []byte, plaintext []byte, extra map[string]interface{}) []byte {
+	t.Helper()
+	ciphertext, err := c.Encrypt(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]interface{}{"data": base64.StdEncoding.EncodeToString(ciphertext)}
+	for k, v := range extra {
+		m[k] = v
+	}
+	b, _ := json.Marshal(m)
+	return b
+}
+
+// decode 解密响应信封
+func decode(t *testing.T, c Cipher, key []byte, body []byte) map[string]interface{} {
+	t.Helper()
+	var m map[string]string
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatalf("response %s: %v", body, err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(m["data"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := c.Decrypt(key, ciphertext)
+	if err != nil {
+		t.Fatalf("decrypt response: %v", err)
+	}
+	var resp map[string]interface{}
+	_ = json.Unmarshal(plaintext, &resp)
+	return resp
+}
+
+// TestCBCKnownAnswer 与openssl enc -aes-128-cbc生成的标准PKCS7密文互通
+func TestCBCKnownAnswer(t *testing.T) {
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	iv, _ := hex.DecodeString("0f0e0d0c0b0a09080706050403020100")
+	want, _ := base64.StdEncoding.DecodeString("zwfOxtsk2l0ZGs8OBllZ2w==")
+
+	ciphertext, err := NewAESCBC(iv).Encrypt(key, []byte("hello partner"))
+	if err != nil || !bytes.Equal(ciphertext, want) {
+		t.Errorf("Encrypt() = %x, %v; want %x", ciphertext, err, want)
+	}
+	for name, tc := range map[string]struct {
+		cipher     *CBC
+		ciphertext []byte
+	}{
+		"fixedIV":  {NewAESCBC(iv), want},
+		"prefixIV": {NewAESCBC(nil), append(append([]byte{}, iv...), want...)},
+	} {
+		plaintext, err := tc.cipher.Decrypt(key, tc.ciphertext)
+		if err != nil || string(plaintext) != "hello partner" {
+			t.Errorf("%s: Decrypt() = %q, %v", name, plaintext, err)
+		}
+	}
+	//带tag的格式要求tag, 标准密文无法通过
+	if _, err := NewAESCBCHMAC(iv).Decrypt(key, want); err != ErrorDecrypt {
+		t.Errorf("NewAESCBCHMAC().Decrypt(standard) = %v, want %v", err, ErrorDecrypt)
+	}
+	//固定IV时相同明文得到相同密文
+	again, _ := NewAESCBC(iv).Encrypt(key, []byte("hello partner"))
+	if !bytes.Equal(again, ciphertext) {
+		t.Errorf("fixed iv ciphertext not deterministic")
+	}
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	for name, c := range map[string]Cipher{
+		"aesGCM":     NewAESGCM(),
+		"sm4GCM":     NewSM4GCM(),
+		"aesCBCHMAC": NewAESCBCHMAC(nil),
+		"sm4CBCHMAC": NewSM4CBCHMAC(nil),
+		"fixedIV":    NewAESCBCHMAC(testKey),
+		"aesCBC":     NewAESCBC(nil),
+		"sm4CBC":     NewSM4CBC(nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ciphertext, err := c.Encrypt(testKey, []byte("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext, err := c.Decrypt(testKey, ciphertext)
+			if err != nil || string(plaintext) != "hello" {
+				t.Fatalf("Decrypt() = %q, %v", plaintext, err)
+			}
+			//标准CBC无完整性保护, 篡改不一定能发现
+			ciphertext[len(ciphertext)-1] ^= 1
+			if _, err := c.Decrypt(testKey, ciphertext); err != ErrorDecrypt && name != "aesCBC" && name != "sm4CBC" {
+				t.Errorf("Decrypt(tampered) = %v, want %v", err, ErrorDecrypt)
+			}
+		})
+	}
+}
+
+func TestSharedKey(t *testing.T) {
+	c := NewAESGCM()
+	app := newTestApp(t, New(c, WithKey(testKey)))
+	w := serve(app, "POST", envelope(t, c, testKey, []byte(`{"a":"1"}`), nil))
+	resp := decode(t, c, testKey, w.Body.Bytes())
+	if data, _ := resp["data"].(map[string]interface{}); data["secret"] != "s3cr3t" {
+		t.Errorf("response = %v", resp)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("s3cr3t")) {
+		t.Error("response is plaintext")
+	}
+
+	w = serve(app, "POST", envelope(t, c, []byte("fedcba9876543210"), []byte(`{}`), nil))
+	if resp := decode(t, c, testKey, w.Body.Bytes()); resp["code"] != baseContext.ErrorReadParams {
+		t.Errorf("wrong key code = %v", resp["code"])
+	}
+}
+
+func TestKeyWrapper(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper := NewRSAKeyWrapper(privateKey, 0)
+	c := NewAESGCM()
+	wrapped, err := wrapper.Wrap(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(t, New(c, WithKeyWrapper(wrapper)))
+	w := serve(app, "POST", envelope(t, c, testKey, []byte(`{"a":"1"}`), map[string]interface{}{
+		"key": base64.StdEncoding.EncodeToString(wrapped),
+	}))
+	resp := decode(t, c, testKey, w.Body.Bytes())
+	if data, _ := resp["data"].(map[string]interface{}); data["secret"] != "s3cr3t" {
+		t.Errorf("response = %v", resp)
+	}
+
+	//没有加密信封时不能以明文输出
+	for _, method := range []string{"GET", "POST"} {
+		w = serve(app, method, nil)
+		if bytes.Contains(w.Body.Bytes(), []byte("s3cr3t")) {
+			t.Errorf("%s without envelope leaked plaintext: %s", method, w.Body.String())
+		}
+		resp = nil
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp["code"] != baseContext.ErrorReadParams {
+			t.Errorf("%s without envelope code = %v, want %s", method, resp["code"], baseContext.ErrorReadParams)
+		}
+	}
+
+	app = newTestApp(t, New(c, WithKeyWrapper(wrapper), WithAllowPlaintext(true)))
+	if w := serve(app, "GET", nil); !bytes.Contains(w.Body.Bytes(), []byte("s3cr3t")) {
+		t.Errorf("allowed plaintext response = %s", w.Body.String())
+	}
+}
+
+type failingCipher struct {
+	Cipher
+}
+
+func (c failingCipher) Encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	return nil, stderrors.New("encrypt failed")
+}
+
+func TestEncryptFailure(t *testing.T) {
+	c := NewAESGCM()
+	app := newTestApp(t, New(failingCipher{c}, WithKey(testKey)))
+	w := serve(app, "POST", envelope(t, c, testKey, []byte(`{}`), nil))
+	if w.Code != 500 {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("s3cr3t")) {
+		t.Errorf("failed encryption leaked plaintext: %s", w.Body.String())
+	}
+	var resp map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["code"] != baseContext.ErrorSystem {
+		t.Errorf("code = %v, want %s", resp["code"], baseContext.ErrorSystem)
+	}
+}
@@ -0,0 +1,102 @@
+package encryption
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	stderrors "errors"
+)
+
+var (
+	ErrorKeyNotFound = stderrors.New("key not found")
+	ErrorNoPublicKey = stderrors.New("public key not set")
+)
+
+// KeyStore 按appId查找调用方的对称key, 不存在时返回ErrorKeyNotFound
+type KeyStore interface {
+	Key(ctx context.Context, appId string) ([]byte, error)
+}
+
+type KeyStoreFunc func(ctx context.Context, appId string) ([]byte, error)
+
+func (f KeyStoreFunc) Key(ctx context.Context, appId string) ([]byte, error) {
+	return f(ctx, appId)
+}
+
+// Keys 静态配置的调用方key
+type Keys map[string][]byte
+
+func (k Keys) Key(ctx context.Context, appId string) ([]byte, error) {
+	if key, ok := k[appId]; ok {
+		return key, nil
+	}
+	return nil, ErrorKeyNotFound
+}
+
+// KeyWrapper 调用方每次请求生成对称key, 用服务端公钥加密后随body传递
+type KeyWrapper interface {
+	Wrap(key []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+// RSAKeyWrapper 默认RSA-OAEP; PKCS1v15仅用于兼容旧接口, 解包失败时使用随机key, 不暴露失败原因
+type RSAKeyWrapper struct {
+	PrivateKey *rsa.PrivateKey
+	PublicKey  *rsa.PublicKey
+	Hash       crypto.Hash
+	PKCS1v15   bool
+	// KeySize PKCS1v15时对称key的长度, 如16/32
+	KeySize int
+}
+
+// NewRSAKeyWrapper RSA-OAEP, hash为0时使用SHA256
+func NewRSAKeyWrapper(privateKey *rsa.PrivateKey, hash crypto.Hash) *RSAKeyWrapper {
+	if privateKey == nil {
+		panic("privateKey 必须设置")
+	}
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	return &RSAKeyWrapper{PrivateKey: privateKey, PublicKey: &privateKey.PublicKey, Hash: hash}
+}
+
+// NewRSAPKCS1KeyWrapper 兼容使用PKCS1v15加密key的旧接口
+func NewRSAPKCS1KeyWrapper(privateKey *rsa.PrivateKey, keySize int) *RSAKeyWrapper {
+	if privateKey == nil {
+		panic("privateKey 必须设置")
+	}
+	if keySize == 0 {
+		panic("keySize 必须设置")
+	}
+	return &RSAKeyWrapper{PrivateKey: privateKey, PublicKey: &privateKey.PublicKey, PKCS1v15: true, KeySize: keySize}
+}
+
+func (w *RSAKeyWrapper) Wrap(key []byte) ([]byte, error) {
+	if w.PublicKey == nil {
+		return nil, ErrorNoPublicKey
+	}
+	if w.PKCS1v15 {
+		return rsa.EncryptPKCS1v15(rand.Reader, w.PublicKey, key)
+	}
+	return rsa.EncryptOAEP(w.Hash.New(), rand.Reader, w.PublicKey, key, nil)
+}
+
+// Unwrap PKCS1v15时解包失败返回随机key, 由后续解密统一失败(Bleichenbacher防护)
+func (w *RSAKeyWrapper) Unwrap(wrapped []byte) ([]byte, error) {
+	if w.PKCS1v15 {
+		key := make([]byte, w.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := rsa.DecryptPKCS1v15SessionKey(rand.Reader, w.PrivateKey, wrapped, key); err != nil {
+			return nil, ErrorDecrypt
+		}
+		return key, nil
+	}
+	key, err := rsa.DecryptOAEP(w.Hash.New(), rand.Reader, w.PrivateKey, wrapped, nil)
+	if err != nil {
+		return nil, ErrorDecrypt
+	}
+	return key, nil
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"github.com/go-estar/iris/baseContext"
+	"github.com/kataras/iris/v12"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"strconv"
+	"time"
+)
+
+func defaultConfig() *Config {
+	return &Config{
+		Path:        "/metrics",
+		Namespace:   "http",
+		Buckets:     prometheus.DefBuckets,
+		SizeBuckets: prometheus.ExponentialBuckets(128, 4, 8),
+	}
+}
+
+type Config struct {
+	Path        string
+	Namespace   string
+	Subsystem   string
+	Buckets     []float64
+	SizeBuckets []float64
+	Registry    *prometheus.Registry
+	Handlers    []iris.Handler
+}
+
+type Option func(*Config)
+
+func WithPath(path string) Option {
+	return func(opts *Config) {
+		opts.Path = path
+	}
+}
+
+func WithNamespace(val string) Option {
+	return func(opts *Config) {
+		opts.Namespace = val
+	}
+}
+
+func WithSubsystem(val string) Option {
+	return func(opts *Config) {
+		opts.Subsystem = val
+	}
+}
+
+func WithBuckets(val ...float64) Option {
+	return func(opts *Config) {
+		opts.Buckets = val
+	}
+}
+
+func WithSizeBuckets(val ...float64) Option {
+	return func(opts *Config) {
+		opts.SizeBuckets = val
+	}
+}
+
+// WithRegistry 使用自定义registry, 默认使用prometheus.DefaultRegisterer
+func WithRegistry(val *prometheus.Registry) Option {
+	return func(opts *Config) {
+		opts.Registry = val
+	}
+}
+
+// WithHandlers metrics路由前置handler, 如鉴权
+func WithHandlers(handlers ...iris.Handler) Option {
+	return func(opts *Config) {
+		opts.Handlers = append(opts.Handlers, handlers...)
+	}
+}
+
+// New 注册采集器并在Path上提供metrics, 返回的Metrics通过Handler()作为中间件使用
+func New(app *iris.Application, opts ...Option) *Metrics {
+	if app == nil {
+		panic("app 必须设置")
+	}
+	config := defaultConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+
+	m := &Metrics{Config: config}
+	m.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.Namespace,
+		Subsystem: config.Subsystem,
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests.",
+	}, []string{"route", "method", "status", "code"})
+	m.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace,
+		Subsystem: config.Subsystem,
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency in seconds.",
+		Buckets:   config.Buckets,
+	}, []string{"route", "method", "status", "code"})
+	m.responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace,
+		Subsystem: config.Subsystem,
+		Name:      "response_size_bytes",
+		Help:      "HTTP response size in bytes.",
+		Buckets:   config.SizeBuckets,
+	}, []string{"route", "method"})
+	m.inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: config.Namespace,
+		Subsystem: config.Subsystem,
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	}, []string{"method"})
+	m.rejected = map[string]*prometheus.CounterVec{
+		baseContext.RejectedLimiter:   m.rejectedCounter("limiter_rejections_total", "Requests rejected by ipLimiter or requestLimiter."),
+		baseContext.RejectedSignature: m.rejectedCounter("signature_failures_total", "Requests failed signature verification."),
+		baseContext.RejectedAuthorize: m.rejectedCounter("auth_failures_total", "Requests failed authorization."),
+	}
+
+	var registerer prometheus.Registerer = prometheus.DefaultRegisterer
+	var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+	if config.Registry != nil {
+		registerer = config.Registry
+		gatherer = config.Registry
+	}
+	registerer.MustRegister(m.requests, m.duration, m.responseSize, m.inFlight)
+	for _, c := range m.rejected {
+		registerer.MustRegister(c)
+	}
+
+	handler := promhttp.InstrumentMetricHandler(registerer, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	app.Get(config.Path, append(config.Handlers, iris.FromStd(handler))...)
+	return m
+}
+
+type Metrics struct {
+	*Config
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	rejected     map[string]*prometheus.CounterVec
+}
+
+func (m *Metrics) rejectedCounter(name string, help string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.Namespace,
+		Subsystem: m.Subsystem,
+		Name:      name,
+		Help:      help,
+	}, []string{"route", "method"})
+}
+
+func (m *Metrics) Context(ctx *baseContext.Context) {
+	if ctx.Request().URL.Path == m.Path {
+		ctx.Next()
+		return
+	}
+
+	method := ctx.Request().Method
+	inFlight := m.inFlight.WithLabelValues(method)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	startTime := time.Now()
+	ctx.OnResponseEnd(m.observeSize)
+	ctx.Next()
+
+	route := ""
+	if r := ctx.GetCurrentRoute(); r != nil {
+		route = r.Path()
+	}
+	status := strconv.Itoa(ctx.GetStatusCode())
+	code := m.errorCode(ctx)
+
+	m.requests.WithLabelValues(route, method, status, code).Inc()
+	m.duration.WithLabelValues(route, method, status, code).Observe(time.Since(startTime).Seconds())
+	if c, ok := m.rejected[ctx.GetRejected()]; ok {
+		c.WithLabelValues(route, method).Inc()
+	}
+}
+
+func (m *Metrics) Handler() iris.Handler {
+	return baseContext.Handler(m.Context)
+}
+
+// errorCode 业务错误码, 与返回给客户端的code一致, 成功为空
+func (m *Metrics) errorCode(ctx *baseContext.Context) string {
+	err := ctx.GetErr()
+	if err == nil {
+		return ""
+	}
+	return ctx.ErrorCode(err)
+}
+
+// observeSize 响应写出后记录, 开启压缩时为压缩后的字节数
+func (m *Metrics) observeSize(ctx *baseContext.Context) {
+	route := ""
+	if r := ctx.GetCurrentRoute(); r != nil {
+		route = r.Path()
+	}
+	if size := ctx.ResponseSize(); size >= 0 {
+		m.responseSize.WithLabelValues(route, ctx.Request().Method).Observe(float64(size))
+	}
+}
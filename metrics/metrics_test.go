@@ -0,0 +1,232 @@
+package metrics
+
+import (
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type sample struct {
+	labels string
+	value  float64
+	count  uint64
+	sum    float64
+}
+
+// gather 返回指标的所有样本, labels格式为"k=v,k=v"
+func gather(t *testing.T, registry *prometheus.Registry, name string) []sample {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []sample
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			var labels []string
+			for _, label := range m.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			s := sample{labels: strings.Join(labels, ",")}
+			switch {
+			case m.GetCounter() != nil:
+				s.value = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				s.value = m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				s.count = m.GetHistogram().GetSampleCount()
+				s.sum = m.GetHistogram().GetSampleSum()
+			}
+			samples = append(samples, s)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].labels < samples[j].labels
+	})
+	return samples
+}
+
+func find(samples []sample, labels string) (sample, bool) {
+	for _, s := range samples {
+		if s.labels == labels {
+			return s, true
+		}
+	}
+	return sample{}, false
+}
+
+func newTestApp(t *testing.T, fn func(app *iris.Application)) (*iris.Application, *prometheus.Registry) {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	registry := prometheus.NewRegistry()
+	app := iris.New()
+	m := New(app, WithRegistry(registry))
+	app.Use(m.Handler(), iris.Compression)
+	fn(app)
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app, registry
+}
+
+func serve(app *iris.Application, method string, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	return w
+}
+
+func reject(reason string, status int) iris.Handler {
+	return baseContext.Handler(func(ctx *baseContext.Context) {
+		ctx.SetRejected(reason)
+		ctx.StatusCode(status)
+		ctx.Error(baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "rejected"))
+	})
+}
+
+func TestRequests(t *testing.T) {
+	app, registry := newTestApp(t, func(app *iris.Application) {
+		app.Get("/users/{id}", baseContext.Handler(func(ctx *baseContext.Context) {
+			ctx.Success("ok")
+		}))
+		app.Post("/users/{id}", baseContext.Handler(func(ctx *baseContext.Context) {
+			ctx.Error(baseError.NewCode(ctx.ErrorCodes["Validation"], "invalid"))
+		}))
+		app.Get("/panic", baseContext.Handler(func(ctx *baseContext.Context) {
+			ctx.Error(baseError.NewSystem("db down"))
+		}))
+	})
+	serve(app, "GET", "/users/1")
+	serve(app, "GET", "/users/2")
+	serve(app, "POST", "/users/1")
+	serve(app, "GET", "/panic")
+	//metrics路由本身不统计
+	if w := serve(app, "GET", "/metrics"); !strings.Contains(w.Body.String(), "http_requests_total") {
+		t.Errorf("metrics body = %s", w.Body.String())
+	}
+
+	//route使用路由模板, code与返回给客户端的code一致
+	want := []struct {
+		labels string
+		count  uint64
+	}{
+		{"code=,method=GET,route=/users/{id},status=200", 2},
+		{"code=" + baseContext.ErrorSystem + ",method=GET,route=/panic,status=200", 1},
+		{"code=" + baseContext.ErrorValidation + ",method=POST,route=/users/{id},status=200", 1},
+	}
+	requests := gather(t, registry, "http_requests_total")
+	duration := gather(t, registry, "http_request_duration_seconds")
+	if len(requests) != len(want) || len(duration) != len(want) {
+		t.Fatalf("requests = %v, duration = %v", requests, duration)
+	}
+	for _, w := range want {
+		if s, ok := find(requests, w.labels); !ok || s.value != float64(w.count) {
+			t.Errorf("requests_total{%s} = %v, want %d", w.labels, s.value, w.count)
+		}
+		if s, ok := find(duration, w.labels); !ok || s.count != w.count {
+			t.Errorf("request_duration_seconds{%s} count = %d, want %d", w.labels, s.count, w.count)
+		}
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	var during float64
+	var registry *prometheus.Registry
+	var app *iris.Application
+	app, registry = newTestApp(t, func(app *iris.Application) {
+		app.Get("/", baseContext.Handler(func(ctx *baseContext.Context) {
+			if s, ok := find(gather(t, registry, "http_requests_in_flight"), "method=GET"); ok {
+				during = s.value
+			}
+			ctx.Success("ok")
+		}))
+	})
+	serve(app, "GET", "/")
+	if during != 1 {
+		t.Errorf("in flight during request = %v, want 1", during)
+	}
+	if s, ok := find(gather(t, registry, "http_requests_in_flight"), "method=GET"); !ok || s.value != 0 {
+		t.Errorf("in flight after request = %v, want 0", s.value)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	app, registry := newTestApp(t, func(app *iris.Application) {
+		app.Get("/limiter", reject(baseContext.RejectedLimiter, http.StatusTooManyRequests))
+		app.Get("/signature", reject(baseContext.RejectedSignature, http.StatusOK))
+		app.Get("/authorize", reject(baseContext.RejectedAuthorize, http.StatusUnauthorized))
+		app.Get("/ok", baseContext.Handler(func(ctx *baseContext.Context) {
+			ctx.Success("ok")
+		}))
+	})
+	serve(app, "GET", "/limiter")
+	serve(app, "GET", "/limiter")
+	serve(app, "GET", "/signature")
+	serve(app, "GET", "/authorize")
+	serve(app, "GET", "/ok")
+
+	tests := []struct {
+		name   string
+		labels string
+		want   float64
+	}{
+		{"http_limiter_rejections_total", "method=GET,route=/limiter", 2},
+		{"http_signature_failures_total", "method=GET,route=/signature", 1},
+		{"http_auth_failures_total", "method=GET,route=/authorize", 1},
+	}
+	for _, tt := range tests {
+		samples := gather(t, registry, tt.name)
+		if len(samples) != 1 || samples[0].labels != tt.labels || samples[0].value != tt.want {
+			t.Errorf("%s = %v, want {%s} %v", tt.name, samples, tt.labels, tt.want)
+		}
+	}
+	if s, ok := find(gather(t, registry, "http_requests_total"), "code="+baseContext.ErrorUnauthorized+",method=GET,route=/limiter,status=429"); !ok || s.value != 2 {
+		t.Errorf("requests_total for limiter = %v", s.value)
+	}
+}
+
+func TestResponseSize(t *testing.T) {
+	body := strings.Repeat("a", 4000)
+	app, registry := newTestApp(t, func(app *iris.Application) {
+		app.Get("/", func(ctx iris.Context) {
+			ctx.WriteString(body)
+		})
+	})
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+	}{
+		{"plain", ""},
+		//记录压缩flush后写出的字节数
+		{"gzip", "gzip"},
+	}
+	var sum float64
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		if tt.acceptEncoding != "" && (w.Header().Get("Content-Encoding") != tt.acceptEncoding || w.Body.Len() >= len(body)) {
+			t.Fatalf("%s: response not compressed", tt.name)
+		}
+		sum += float64(w.Body.Len())
+
+		s, ok := find(gather(t, registry, "http_response_size_bytes"), "method=GET,route=/")
+		if !ok || s.count != uint64(i+1) || s.sum != sum {
+			t.Errorf("%s: response_size_bytes count = %d sum = %v, want %d %v", tt.name, s.count, s.sum, i+1, sum)
+		}
+	}
+}
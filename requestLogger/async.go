@@ -0,0 +1,225 @@
+package requestLogger
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-estar/logger"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const maxCopyDepth = 16
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type Policy int
+
+const (
+	// PolicyDrop 默认, 队列满时丢弃日志并计数, 不影响请求
+	PolicyDrop Policy = iota
+	// PolicyBlock 队列满时阻塞请求协程直到有空位或Close
+	PolicyBlock
+)
+
+type Async struct {
+	QueueSize int
+	Workers   int
+	Policy    Policy
+}
+
+type entry struct {
+	level  string
+	msg    string
+	fields []*logger.Field
+}
+
+type asyncWriter struct {
+	queue   chan *entry
+	policy  Policy
+	dropped uint64
+	mu      sync.RWMutex
+	closed  bool
+	// done Close时关闭, 唤醒阻塞在队列上的请求协程
+	done chan struct{}
+	// senders 正在入队的请求协程, 全部返回后才关闭queue
+	senders sync.WaitGroup
+	wg      sync.WaitGroup
+}
+
+func (l *RequestLogger) startAsync() {
+	w := &asyncWriter{
+		queue:  make(chan *entry, l.Async.QueueSize),
+		policy: l.Async.Policy,
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < l.Async.Workers; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for e := range w.queue {
+				l.write(e)
+			}
+		}()
+	}
+	l.async = w
+}
+
+// enqueue 返回false表示已关闭, 由调用方同步写入; 入队时不持有锁, 阻塞中的入队在Close时返回false
+func (w *asyncWriter) enqueue(e *entry) bool {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return false
+	}
+	w.senders.Add(1)
+	w.mu.RUnlock()
+	defer w.senders.Done()
+
+	if w.policy == PolicyBlock {
+		select {
+		case w.queue <- e:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+	select {
+	case w.queue <- e:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+	}
+	return true
+}
+
+// snapshot 在请求协程中复制字段值, 请求结束后context被回收复用, 异步写入时map/指针/slice可能已被其他请求修改
+// 只复制可变的容器, 值的类型与同步写入时一致
+func snapshot(fields []*logger.Field) []*logger.Field {
+	copied := make([]*logger.Field, len(fields))
+	for i, field := range fields {
+		copied[i] = logger.NewField(field.Key, snapshotValue(field.Value))
+	}
+	return copied
+}
+
+// snapshotValue 基本类型/error/time原样返回, map/slice/指针/结构体深拷贝为同类型的值
+func snapshotValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64,
+		time.Time, time.Duration, error, json.RawMessage:
+		return v
+	case []byte:
+		return append([]byte(nil), v...)
+	}
+	return deepCopy(reflect.ValueOf(value), 0).Interface()
+}
+
+// deepCopy 超过maxCopyDepth(如循环引用)时不再复制
+func deepCopy(v reflect.Value, depth int) reflect.Value {
+	if depth > maxCopyDepth {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), deepCopy(iter.Value(), depth+1))
+		}
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(deepCopy(v.Index(i), depth+1))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(deepCopy(v.Index(i), depth+1))
+		}
+		return copied
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(deepCopy(v.Elem(), depth+1))
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(deepCopy(v.Elem(), depth+1))
+		return copied
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v
+		}
+		//先整体复制(含未导出字段), 再深拷贝导出字段
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if copied.Field(i).CanSet() {
+				copied.Field(i).Set(deepCopy(v.Field(i), depth+1))
+			}
+		}
+		return copied
+	}
+	return v
+}
+
+// Dropped 返回PolicyDrop下被丢弃的日志条数
+func (l *RequestLogger) Dropped() uint64 {
+	if l.async == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&l.async.dropped)
+}
+
+// Pending 返回队列中尚未写入的日志条数
+func (l *RequestLogger) Pending() int {
+	if l.async == nil {
+		return 0
+	}
+	return len(l.async.queue)
+}
+
+// Close 停止接收异步日志并等待队列写完, 用于服务关闭时flush
+// 关闭后的日志及阻塞在队列上的日志改为同步写入; ctx超时返回ctx.Err(), 剩余日志继续在后台写入
+func (l *RequestLogger) Close(ctx context.Context) error {
+	if l.async == nil {
+		return nil
+	}
+	w := l.async
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.done)
+		go func() {
+			w.senders.Wait()
+			close(w.queue)
+		}()
+	}
+	w.mu.Unlock()
+
+	flushed := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
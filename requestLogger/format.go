@@ -0,0 +1,389 @@
+package requestLogger
+
+import (
+	"fmt"
+	"github.com/go-estar/logger"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format int
+
+const (
+	// FormatDefault 原有字段: uri/latency(ms)/user-agent...
+	FormatDefault Format = iota
+	// FormatCombined Apache combined log format, 整行输出在message中, request_id/error等作为字段
+	FormatCombined
+	// FormatECS Elastic Common Schema, event.duration单位ns
+	FormatECS
+	// FormatOTel OpenTelemetry semantic conventions, http.server.request.duration单位s
+	FormatOTel
+)
+
+const ecsVersion = "8.11.0"
+
+// Record 一次请求的日志数据, 由Format决定输出的字段名和单位
+type Record struct {
+	StartTime     time.Time
+	Latency       time.Duration
+	Method        string
+	Scheme        string
+	Host          string
+	URI           string
+	Path          string
+	Route         string
+	Query         string
+	Proto         string
+	TLSVersion    string
+	RequestSize   int64
+	ResponseSize  int64
+	Compressed    bool
+	Status        int
+	IP            string
+	RemoteAddr    string
+	UserAgent     string
+	Referer       string
+	Body          []byte
+	Response      []byte
+	Fields        []*logger.Field
+	SessionId     string
+	SessionFields []*logger.Field
+	RequestId     string
+	TraceId       string
+	Level         string
+	Err           error
+	ErrorCode     string
+	ErrorChain    []string
+}
+
+// startTime 未经过记录startTime的中间件时使用当前时间
+func (r *Record) startTime() time.Time {
+	if r.StartTime.IsZero() {
+		return time.Now()
+	}
+	return r.StartTime
+}
+
+func (l *RequestLogger) format(r *Record) *entry {
+	switch l.Format {
+	case FormatCombined:
+		return &entry{level: r.Level, msg: l.combined(r), fields: combinedFields(r)}
+	case FormatECS:
+		return &entry{level: r.Level, fields: l.ecs(r)}
+	case FormatOTel:
+		return &entry{level: r.Level, fields: l.otel(r)}
+	default:
+		return &entry{level: r.Level, fields: l.standard(r)}
+	}
+}
+
+func (l *RequestLogger) standard(r *Record) []*logger.Field {
+	var startTime interface{}
+	if !r.StartTime.IsZero() {
+		startTime = r.StartTime
+	}
+	fields := []*logger.Field{
+		logger.NewField("startTime", startTime),
+		logger.NewField("method", r.Method),
+		logger.NewField("host", r.Host),
+		logger.NewField("uri", r.URI),
+		logger.NewField("path", r.Path),
+		logger.NewField("latency", r.Latency.Milliseconds()),
+		logger.NewField("status", r.Status),
+	}
+	if l.IP {
+		fields = append(fields, logger.NewField("ip", r.IP))
+	}
+	if l.Query {
+		fields = append(fields, logger.NewField("query", r.Query))
+	}
+	if l.Body {
+		fields = append(fields, logger.NewField("body", r.Body))
+	}
+	if l.UserAgent {
+		fields = append(fields, logger.NewField("user-agent", r.UserAgent))
+	}
+	if r.Response != nil {
+		fields = append(fields, logger.NewField("response", r.Response))
+	}
+	if l.Size {
+		fields = append(fields,
+			logger.NewField("proto", r.Proto),
+			logger.NewField("request_size", r.RequestSize),
+			logger.NewField("response_size", r.ResponseSize),
+			logger.NewField("compressed", r.Compressed),
+		)
+		if r.TLSVersion != "" {
+			fields = append(fields, logger.NewField("tls_version", r.TLSVersion))
+		}
+	}
+	fields = append(fields, r.Fields...)
+	if r.SessionId != "" {
+		fields = append(fields, logger.NewField("session_id", r.SessionId))
+		fields = append(fields, r.SessionFields...)
+	}
+	if r.RequestId != "" {
+		fields = append(fields, logger.NewField("request_id", r.RequestId))
+	}
+	if r.TraceId != "" {
+		fields = append(fields, logger.NewField("trace_id", r.TraceId))
+	}
+	if r.Err != nil {
+		fields = append(fields, logger.NewField("error", r.Err))
+		if len(r.ErrorChain) > 0 {
+			fields = append(fields, logger.NewField("error_chain", r.ErrorChain))
+		}
+	}
+	return fields
+}
+
+// combined %h %l %u [%t] "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+// 未开启IP/UserAgent时对应项为"-", 未开启Query时%r使用path
+func (l *RequestLogger) combined(r *Record) string {
+	host := ""
+	if l.IP {
+		host = r.IP
+		if host == "" {
+			host = r.RemoteAddr
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	uri := r.Path
+	if l.Query {
+		uri = r.URI
+	}
+	size := "-"
+	if r.ResponseSize > 0 {
+		size = strconv.FormatInt(r.ResponseSize, 10)
+	}
+	userAgent := ""
+	if l.UserAgent {
+		userAgent = r.UserAgent
+	}
+	return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s %s %s`,
+		orDash(host),
+		r.startTime().Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, uri, r.Proto,
+		r.Status,
+		size,
+		strconv.Quote(orDash(r.Referer)),
+		strconv.Quote(orDash(userAgent)),
+	)
+}
+
+// combinedFields 日志行之外的上下文字段, 与默认格式的字段名一致
+func combinedFields(r *Record) []*logger.Field {
+	var fields []*logger.Field
+	if r.RequestId != "" {
+		fields = append(fields, logger.NewField("request_id", r.RequestId))
+	}
+	if r.TraceId != "" {
+		fields = append(fields, logger.NewField("trace_id", r.TraceId))
+	}
+	fields = append(fields, r.Fields...)
+	if r.SessionId != "" {
+		fields = append(fields, logger.NewField("session_id", r.SessionId))
+		fields = append(fields, r.SessionFields...)
+	}
+	if r.Err != nil {
+		fields = append(fields, logger.NewField("error", r.Err))
+		if r.ErrorCode != "" {
+			fields = append(fields, logger.NewField("error_code", r.ErrorCode))
+		}
+		if len(r.ErrorChain) > 0 {
+			fields = append(fields, logger.NewField("error_chain", r.ErrorChain))
+		}
+	}
+	return fields
+}
+
+func (l *RequestLogger) ecs(r *Record) []*logger.Field {
+	outcome := "success"
+	if r.Err != nil || r.Status >= 400 {
+		outcome = "failure"
+	}
+	fields := []*logger.Field{
+		logger.NewField("ecs.version", ecsVersion),
+		logger.NewField("@timestamp", r.startTime().UTC().Format(time.RFC3339Nano)),
+		logger.NewField("event.kind", "event"),
+		logger.NewField("event.category", []string{"web"}),
+		logger.NewField("event.outcome", outcome),
+		logger.NewField("event.duration", r.Latency.Nanoseconds()),
+		logger.NewField("http.request.method", r.Method),
+		logger.NewField("http.response.status_code", r.Status),
+		logger.NewField("http.version", httpVersion(r.Proto)),
+		logger.NewField("url.scheme", r.Scheme),
+		logger.NewField("url.path", r.Path),
+	}
+	//url.domain不含端口, 端口单独记录在url.port
+	domain, port := splitHostPort(r.Host)
+	fields = append(fields, logger.NewField("url.domain", domain))
+	if port > 0 {
+		fields = append(fields, logger.NewField("url.port", port))
+	}
+	//url.original包含query, 未开启Query时使用path
+	if l.Query {
+		fields = append(fields, logger.NewField("url.original", r.URI))
+	} else {
+		fields = append(fields, logger.NewField("url.original", r.Path))
+	}
+	if l.IP {
+		fields = append(fields, logger.NewField("client.ip", r.IP))
+	}
+	if l.Query && r.Query != "" {
+		fields = append(fields, logger.NewField("url.query", r.Query))
+	}
+	if l.UserAgent && r.UserAgent != "" {
+		fields = append(fields, logger.NewField("user_agent.original", r.UserAgent))
+	}
+	if r.Referer != "" {
+		fields = append(fields, logger.NewField("http.request.referrer", r.Referer))
+	}
+	if r.Body != nil {
+		fields = append(fields, logger.NewField("http.request.body.content", string(r.Body)))
+	}
+	if r.Response != nil {
+		fields = append(fields, logger.NewField("http.response.body.content", string(r.Response)))
+	}
+	if r.RequestSize >= 0 {
+		fields = append(fields, logger.NewField("http.request.body.bytes", r.RequestSize))
+	}
+	if r.ResponseSize >= 0 {
+		fields = append(fields, logger.NewField("http.response.body.bytes", r.ResponseSize))
+	}
+	if r.Compressed {
+		fields = append(fields, logger.NewField("http.response.compressed", true))
+	}
+	if r.TLSVersion != "" {
+		fields = append(fields, logger.NewField("tls.version_protocol", "tls"), logger.NewField("tls.version", tlsVersion(r.TLSVersion)))
+	}
+	if r.RequestId != "" {
+		fields = append(fields, logger.NewField("http.request.id", r.RequestId))
+	}
+	if r.TraceId != "" {
+		fields = append(fields, logger.NewField("trace.id", r.TraceId))
+	}
+	if r.SessionId != "" {
+		fields = append(fields, logger.NewField("session_id", r.SessionId))
+		fields = append(fields, r.SessionFields...)
+	}
+	fields = append(fields, r.Fields...)
+	if r.Err != nil {
+		fields = append(fields, logger.NewField("error.message", r.Err.Error()))
+		if r.ErrorCode != "" {
+			fields = append(fields, logger.NewField("error.code", r.ErrorCode))
+		}
+		if len(r.ErrorChain) > 0 {
+			fields = append(fields, logger.NewField("error.chain", r.ErrorChain))
+		}
+	}
+	return fields
+}
+
+func (l *RequestLogger) otel(r *Record) []*logger.Field {
+	fields := []*logger.Field{
+		logger.NewField("timestamp", r.startTime().UnixNano()),
+		logger.NewField("http.request.method", r.Method),
+		logger.NewField("http.response.status_code", r.Status),
+		logger.NewField("http.server.request.duration", r.Latency.Seconds()),
+		logger.NewField("network.protocol.name", "http"),
+		logger.NewField("network.protocol.version", httpVersion(r.Proto)),
+		logger.NewField("url.scheme", r.Scheme),
+		logger.NewField("url.path", r.Path),
+	}
+	address, port := splitHostPort(r.Host)
+	fields = append(fields, logger.NewField("server.address", address))
+	if port > 0 {
+		fields = append(fields, logger.NewField("server.port", port))
+	}
+	if l.IP {
+		fields = append(fields, logger.NewField("client.address", r.IP))
+	}
+	if r.Route != "" {
+		fields = append(fields, logger.NewField("http.route", r.Route))
+	}
+	if l.Query && r.Query != "" {
+		fields = append(fields, logger.NewField("url.query", r.Query))
+	}
+	if l.UserAgent && r.UserAgent != "" {
+		fields = append(fields, logger.NewField("user_agent.original", r.UserAgent))
+	}
+	if r.Body != nil {
+		fields = append(fields, logger.NewField("http.request.body", string(r.Body)))
+	}
+	if r.Response != nil {
+		fields = append(fields, logger.NewField("http.response.body", string(r.Response)))
+	}
+	if r.RequestSize >= 0 {
+		fields = append(fields, logger.NewField("http.request.body.size", r.RequestSize))
+	}
+	if r.ResponseSize >= 0 {
+		fields = append(fields, logger.NewField("http.response.body.size", r.ResponseSize))
+	}
+	if r.Compressed {
+		fields = append(fields, logger.NewField("http.response.compressed", true))
+	}
+	if r.TLSVersion != "" {
+		fields = append(fields, logger.NewField("tls.protocol.name", "tls"), logger.NewField("tls.protocol.version", tlsVersion(r.TLSVersion)))
+	}
+	if r.RequestId != "" {
+		//http.request.header.<key>的值为字符串数组
+		fields = append(fields, logger.NewField("http.request.header.x-request-id", []string{r.RequestId}))
+	}
+	if r.TraceId != "" {
+		fields = append(fields, logger.NewField("trace_id", r.TraceId))
+	}
+	if r.SessionId != "" {
+		fields = append(fields, logger.NewField("session.id", r.SessionId))
+		fields = append(fields, r.SessionFields...)
+	}
+	fields = append(fields, r.Fields...)
+	if r.Err != nil {
+		errorType := r.ErrorCode
+		if errorType == "" {
+			errorType = fmt.Sprintf("%T", r.Err)
+		}
+		fields = append(fields, logger.NewField("error.type", errorType))
+		fields = append(fields, logger.NewField("exception.message", r.Err.Error()))
+	} else if r.Status >= 500 {
+		fields = append(fields, logger.NewField("error.type", strconv.Itoa(r.Status)))
+	}
+	return fields
+}
+
+// splitHostPort example.com:8080 -> example.com, 8080; 没有端口时port为0, IPv6去掉方括号
+func splitHostPort(hostport string) (string, int) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]"), 0
+	}
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
+
+// httpVersion HTTP/1.1 -> 1.1
+func httpVersion(proto string) string {
+	if len(proto) > 5 && proto[:5] == "HTTP/" {
+		return proto[5:]
+	}
+	return proto
+}
+
+// tlsVersion TLS 1.3 -> 1.3
+func tlsVersion(name string) string {
+	if len(name) > 4 && name[:4] == "TLS " {
+		return name[4:]
+	}
+	return name
+}
+
+func orDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
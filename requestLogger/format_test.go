@@ -0,0 +1,276 @@
+package requestLogger
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"github.com/go-estar/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecord() *Record {
+	return &Record{
+		StartTime:     time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.FixedZone("CST", 8*3600)),
+		Latency:       1500 * time.Millisecond,
+		Method:        "POST",
+		Scheme:        "https",
+		Host:          "api.example.com:8443",
+		URI:           "/users/1?lang=en",
+		Path:          "/users/1",
+		Route:         "/users/{id}",
+		Query:         "lang=en",
+		Proto:         "HTTP/1.1",
+		TLSVersion:    "TLS 1.3",
+		RequestSize:   13,
+		ResponseSize:  27,
+		Compressed:    true,
+		Status:        400,
+		IP:            "203.0.113.9",
+		RemoteAddr:    "10.0.0.1:5555",
+		UserAgent:     "curl/8.0",
+		Referer:       "https://example.com/",
+		Body:          []byte(`{"name":"a"}`),
+		Response:      []byte(`{"code":"102"}`),
+		Fields:        []*logger.Field{logger.NewField("user", "u1")},
+		SessionId:     "s1",
+		SessionFields: []*logger.Field{logger.NewField("tenant", "t1")},
+		RequestId:     "r1",
+		TraceId:       "t1",
+		Level:         "warn",
+		Err:           stderrors.New("name invalid"),
+		ErrorCode:     "102",
+		ErrorChain:    []string{"validate", "name invalid"},
+	}
+}
+
+// golden 字段按输出顺序, 值为JSON
+func golden(fields []*logger.Field) []string {
+	var lines []string
+	for _, field := range fields {
+		b, err := json.Marshal(field.Value)
+		if err != nil {
+			panic(err)
+		}
+		if err, ok := field.Value.(error); ok {
+			b, _ = json.Marshal(err.Error())
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s", field.Key, b))
+	}
+	return lines
+}
+
+func TestFormatGolden(t *testing.T) {
+	tests := []struct {
+		format Format
+		msg    string
+		fields []string
+	}{
+		{FormatDefault, "", []string{
+			`startTime="2024-01-02T03:04:05.006+08:00"`,
+			`method="POST"`,
+			`host="api.example.com:8443"`,
+			`uri="/users/1?lang=en"`,
+			`path="/users/1"`,
+			`latency=1500`,
+			`status=400`,
+			`ip="203.0.113.9"`,
+			`query="lang=en"`,
+			`body="eyJuYW1lIjoiYSJ9"`,
+			`user-agent="curl/8.0"`,
+			`response="eyJjb2RlIjoiMTAyIn0="`,
+			`proto="HTTP/1.1"`,
+			`request_size=13`,
+			`response_size=27`,
+			`compressed=true`,
+			`tls_version="TLS 1.3"`,
+			`user="u1"`,
+			`session_id="s1"`,
+			`tenant="t1"`,
+			`request_id="r1"`,
+			`trace_id="t1"`,
+			`error="name invalid"`,
+			`error_chain=["validate","name invalid"]`,
+		}},
+		{FormatCombined, `203.0.113.9 - - [02/Jan/2024:03:04:05 +0800] "POST /users/1?lang=en HTTP/1.1" 400 27 "https://example.com/" "curl/8.0"`, []string{
+			`request_id="r1"`,
+			`trace_id="t1"`,
+			`user="u1"`,
+			`session_id="s1"`,
+			`tenant="t1"`,
+			`error="name invalid"`,
+			`error_code="102"`,
+			`error_chain=["validate","name invalid"]`,
+		}},
+		{FormatECS, "", []string{
+			`ecs.version="8.11.0"`,
+			`@timestamp="2024-01-01T19:04:05.006Z"`,
+			`event.kind="event"`,
+			`event.category=["web"]`,
+			`event.outcome="failure"`,
+			`event.duration=1500000000`,
+			`http.request.method="POST"`,
+			`http.response.status_code=400`,
+			`http.version="1.1"`,
+			`url.scheme="https"`,
+			`url.path="/users/1"`,
+			`url.domain="api.example.com"`,
+			`url.port=8443`,
+			`url.original="/users/1?lang=en"`,
+			`client.ip="203.0.113.9"`,
+			`url.query="lang=en"`,
+			`user_agent.original="curl/8.0"`,
+			`http.request.referrer="https://example.com/"`,
+			`http.request.body.content="{\"name\":\"a\"}"`,
+			`http.response.body.content="{\"code\":\"102\"}"`,
+			`http.request.body.bytes=13`,
+			`http.response.body.bytes=27`,
+			`http.response.compressed=true`,
+			`tls.version_protocol="tls"`,
+			`tls.version="1.3"`,
+			`http.request.id="r1"`,
+			`trace.id="t1"`,
+			`session_id="s1"`,
+			`tenant="t1"`,
+			`user="u1"`,
+			`error.message="name invalid"`,
+			`error.code="102"`,
+			`error.chain=["validate","name invalid"]`,
+		}},
+		{FormatOTel, "", []string{
+			`timestamp=1704135845006000000`,
+			`http.request.method="POST"`,
+			`http.response.status_code=400`,
+			`http.server.request.duration=1.5`,
+			`network.protocol.name="http"`,
+			`network.protocol.version="1.1"`,
+			`url.scheme="https"`,
+			`url.path="/users/1"`,
+			`server.address="api.example.com"`,
+			`server.port=8443`,
+			`client.address="203.0.113.9"`,
+			`http.route="/users/{id}"`,
+			`url.query="lang=en"`,
+			`user_agent.original="curl/8.0"`,
+			`http.request.body="{\"name\":\"a\"}"`,
+			`http.response.body="{\"code\":\"102\"}"`,
+			`http.request.body.size=13`,
+			`http.response.body.size=27`,
+			`http.response.compressed=true`,
+			`tls.protocol.name="tls"`,
+			`tls.protocol.version="1.3"`,
+			`http.request.header.x-request-id=["r1"]`,
+			`trace_id="t1"`,
+			`session.id="s1"`,
+			`tenant="t1"`,
+			`user="u1"`,
+			`error.type="102"`,
+			`exception.message="name invalid"`,
+		}},
+	}
+	for _, tt := range tests {
+		l := New(&captureLogger{}, WithFormat(tt.format), WithIP(true), WithQuery(true), WithUserAgent(true), WithSize(true), WithBody(true))
+		e := l.format(testRecord())
+		if e.msg != tt.msg {
+			t.Errorf("format %d msg = %s, want %s", tt.format, e.msg, tt.msg)
+		}
+		if e.level != "warn" {
+			t.Errorf("format %d level = %s, want warn", tt.format, e.level)
+		}
+		got := golden(e.fields)
+		if len(got) != len(tt.fields) {
+			t.Errorf("format %d fields = %d, want %d\n%s", tt.format, len(got), len(tt.fields), strings.Join(got, "\n"))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.fields[i] {
+				t.Errorf("format %d field %d = %s, want %s", tt.format, i, got[i], tt.fields[i])
+			}
+		}
+	}
+}
+
+// TestFormatMinimal 关闭可选项且没有上下文数据时只输出必需字段
+func TestFormatMinimal(t *testing.T) {
+	r := &Record{
+		StartTime:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Latency:      2 * time.Millisecond,
+		Method:       "GET",
+		Scheme:       "http",
+		Host:         "[::1]",
+		URI:          "/?a=1",
+		Path:         "/",
+		Query:        "a=1",
+		Proto:        "HTTP/2.0",
+		RequestSize:  -1,
+		ResponseSize: -1,
+		Status:       200,
+		IP:           "::1",
+		UserAgent:    "curl/8.0",
+		Level:        "info",
+	}
+	tests := []struct {
+		format Format
+		msg    string
+		fields []string
+	}{
+		{FormatCombined, `- - - [02/Jan/2024:03:04:05 +0000] "GET / HTTP/2.0" 200 - "-" "-"`, nil},
+		{FormatECS, "", []string{
+			`ecs.version="8.11.0"`,
+			`@timestamp="2024-01-02T03:04:05Z"`,
+			`event.kind="event"`,
+			`event.category=["web"]`,
+			`event.outcome="success"`,
+			`event.duration=2000000`,
+			`http.request.method="GET"`,
+			`http.response.status_code=200`,
+			`http.version="2.0"`,
+			`url.scheme="http"`,
+			`url.path="/"`,
+			`url.domain="::1"`,
+			`url.original="/"`,
+		}},
+		{FormatOTel, "", []string{
+			`timestamp=1704164645000000000`,
+			`http.request.method="GET"`,
+			`http.response.status_code=200`,
+			`http.server.request.duration=0.002`,
+			`network.protocol.name="http"`,
+			`network.protocol.version="2.0"`,
+			`url.scheme="http"`,
+			`url.path="/"`,
+			`server.address="::1"`,
+		}},
+	}
+	for _, tt := range tests {
+		l := New(&captureLogger{}, WithFormat(tt.format), WithIP(false), WithQuery(false))
+		e := l.format(r)
+		if e.msg != tt.msg {
+			t.Errorf("format %d msg = %s, want %s", tt.format, e.msg, tt.msg)
+		}
+		if got := golden(e.fields); strings.Join(got, "\n") != strings.Join(tt.fields, "\n") {
+			t.Errorf("format %d fields:\n%s\nwant:\n%s", tt.format, strings.Join(got, "\n"), strings.Join(tt.fields, "\n"))
+		}
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		hostport string
+		host     string
+		port     int
+	}{
+		{"example.com", "example.com", 0},
+		{"example.com:8080", "example.com", 8080},
+		{"127.0.0.1:80", "127.0.0.1", 80},
+		{"[::1]:8443", "::1", 8443},
+		{"[::1]", "::1", 0},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		if host, port := splitHostPort(tt.hostport); host != tt.host || port != tt.port {
+			t.Errorf("splitHostPort(%q) = %q, %d, want %q, %d", tt.hostport, host, port, tt.host, tt.port)
+		}
+	}
+}
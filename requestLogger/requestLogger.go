@@ -1,6 +1,7 @@
 package requestLogger
 
 import (
+	"crypto/tls"
 	baseError "github.com/go-estar/base-error"
 	"github.com/go-estar/iris/baseContext"
 	"github.com/go-estar/logger"
@@ -31,10 +32,14 @@ func New(logger logger.Logger, opts ...Option) *RequestLogger {
 	for _, apply := range opts {
 		apply(config)
 	}
-	return &RequestLogger{
+	l := &RequestLogger{
 		logger: logger,
 		Config: config,
 	}
+	if config.Async != nil {
+		l.startAsync()
+	}
+	return l
 }
 
 func WithIP(val bool) Option {
@@ -57,6 +62,11 @@ func WithUserAgent(val bool) Option {
 		opts.UserAgent = val
 	}
 }
+func WithSize(val bool) Option {
+	return func(opts *Config) {
+		opts.Size = val
+	}
+}
 func WithResponse(val bool) Option {
 	return func(opts *Config) {
 		opts.Response = val
@@ -77,6 +87,25 @@ func WithSessionKeys(val ...string) Option {
 		opts.SessionKeys = append(opts.SessionKeys, val...)
 	}
 }
+func WithFormat(val Format) Option {
+	return func(opts *Config) {
+		opts.Format = val
+	}
+}
+func WithAsync(async *Async) Option {
+	return func(opts *Config) {
+		if async == nil {
+			panic("async 必须设置")
+		}
+		if async.QueueSize <= 0 {
+			async.QueueSize = 1024
+		}
+		if async.Workers <= 0 {
+			async.Workers = 1
+		}
+		opts.Async = async
+	}
+}
 func WithPath(path interface{}, level Level) Option {
 	return func(opts *Config) {
 		opts.Paths = append(opts.Paths, PathConfig{path, level})
@@ -133,16 +162,20 @@ type Config struct {
 	Body        bool
 	Response    bool
 	UserAgent   bool
+	Size        bool
 	ContextKeys []string
 	HeaderKeys  []string
 	SessionKeys []string
 	Paths       []PathConfig
+	Format      Format
+	Async       *Async
 }
 
 type RequestLogger struct {
 	logger logger.Logger
 	*Config
 	pathLevel []PathLevel
+	async     *asyncWriter
 }
 
 func (l *RequestLogger) GetLogger() logger.Logger {
@@ -160,6 +193,12 @@ func (l *RequestLogger) Context(ctx *baseContext.Context) {
 	if level == LevelResponse {
 		ctx.Record()
 	}
+	if l.Size || l.Format == FormatCombined {
+		//压缩writer在handler之后才flush, 响应写出后再记录才能拿到实际字节数
+		ctx.OnResponseEnd(l.Log)
+		ctx.Next()
+		return
+	}
 	ctx.Next()
 	l.Log(ctx)
 }
@@ -212,45 +251,84 @@ func (l *RequestLogger) CheckPath(currPath string) Level {
 }
 
 func (l *RequestLogger) Log(ctx *baseContext.Context) {
+	e := l.entry(ctx)
+	if l.async != nil {
+		e.fields = snapshot(e.fields)
+		if l.async.enqueue(e) {
+			return
+		}
+	}
+	l.write(e)
+}
 
-	startTime := ctx.Values().Get("startTime")
-	var latency int64
-	if startTime != nil {
-		latency = time.Since(startTime.(time.Time)).Milliseconds()
+func (l *RequestLogger) write(e *entry) {
+	switch e.level {
+	case "warn":
+		l.logger.Warn(e.msg, e.fields...)
+	case "error":
+		l.logger.Error(e.msg, e.fields...)
+	default:
+		l.logger.Info(e.msg, e.fields...)
 	}
+}
 
-	requestBody, _ := ctx.GetBody()
+func (l *RequestLogger) entry(ctx *baseContext.Context) *entry {
+	return l.format(l.record(ctx))
+}
 
-	fields := []*logger.Field{
-		logger.NewField("startTime", startTime),
-		logger.NewField("method", ctx.Request().Method),
-		logger.NewField("host", ctx.Request().Host),
-		logger.NewField("uri", ctx.Request().RequestURI),
-		logger.NewField("path", ctx.Request().URL.Path),
-		logger.NewField("latency", latency),
-		logger.NewField("status", ctx.ResponseWriter().StatusCode()),
+func (l *RequestLogger) record(ctx *baseContext.Context) *Record {
+	r := &Record{
+		Method:       ctx.Request().Method,
+		Host:         ctx.Request().Host,
+		URI:          ctx.Request().RequestURI,
+		Path:         ctx.Request().URL.Path,
+		Query:        ctx.Request().URL.RawQuery,
+		Proto:        ctx.Request().Proto,
+		IP:           ctx.GetIP(),
+		UserAgent:    ctx.GetHeader("user-agent"),
+		Status:       ctx.ResponseWriter().StatusCode(),
+		Level:        "info",
+		RemoteAddr:   ctx.RemoteAddr(),
+		Referer:      ctx.GetHeader("referer"),
+		Scheme:       "http",
+		RequestSize:  -1,
+		ResponseSize: -1,
+	}
+	if ctx.Request().TLS != nil {
+		r.Scheme = "https"
+		r.TLSVersion = tls.VersionName(ctx.Request().TLS.Version)
+	}
+	if l.Size {
+		r.RequestSize = ctx.Request().ContentLength
+		r.ResponseSize = ctx.ResponseSize()
+		r.Compressed = isCompressed(ctx.Context)
+	} else if l.Format == FormatCombined {
+		//combined格式固定包含%b
+		r.ResponseSize = ctx.ResponseSize()
+	}
+	if route := ctx.GetCurrentRoute(); route != nil {
+		r.Route = route.Path()
 	}
 
-	if l.IP {
-		fields = append(fields, logger.NewField("ip", ctx.GetIP()))
-	}
-	if l.Query {
-		fields = append(fields, logger.NewField("query", ctx.Request().URL.RawQuery))
+	if startTime, ok := ctx.Values().Get("startTime").(time.Time); ok {
+		r.StartTime = startTime
+		r.Latency = time.Since(startTime)
 	}
+
 	if l.Body {
-		fields = append(fields, logger.NewField("body", requestBody))
-	}
-	if l.UserAgent {
-		fields = append(fields, logger.NewField("user-agent", ctx.GetHeader("user-agent")))
+		r.Body, _ = ctx.GetBody()
 	}
 	if l.CheckPath(ctx.Request().URL.Path) == LevelResponse {
-		fields = append(fields, logger.NewField("response", ctx.Recorder().Body()))
+		r.Response = ctx.Recorder().Body()
+		if r.Response == nil {
+			r.Response = []byte{}
+		}
 	}
 
 	if headerKeys := l.HeaderKeys; len(headerKeys) > 0 {
 		for _, key := range headerKeys {
 			if value := ctx.GetHeader(key); value != "" {
-				fields = append(fields, logger.NewField(key, value))
+				r.Fields = append(r.Fields, logger.NewField(key, value))
 			}
 		}
 	}
@@ -258,58 +336,47 @@ func (l *RequestLogger) Log(ctx *baseContext.Context) {
 	if ctxKeys := l.ContextKeys; len(ctxKeys) > 0 {
 		for _, key := range ctxKeys {
 			if value := ctx.Values().Get(key); value != nil {
-				fields = append(fields, logger.NewField(key, value))
+				r.Fields = append(r.Fields, logger.NewField(key, value))
 			}
 		}
 	}
 
 	if logFields := ctx.GetLogFields(); len(logFields) > 0 {
-		fields = append(fields, logFields...)
+		r.Fields = append(r.Fields, logFields...)
 	}
 	if contextKeys := ctx.GetLogContextKeys(); len(contextKeys) > 0 {
 		for _, key := range contextKeys {
 			if value := ctx.Values().Get(key); value != nil {
-				fields = append(fields, logger.NewField(key, value))
+				r.Fields = append(r.Fields, logger.NewField(key, value))
 			}
 		}
 	}
 
 	if session := ctx.GetSession(); session != nil {
-		fields = append(fields, logger.NewField("session_id", session.ID()))
+		r.SessionId = session.ID()
 		if sessionKeys := append(l.SessionKeys, ctx.GetLogSessionKeys()...); len(sessionKeys) > 0 {
 			for _, key := range sessionKeys {
 				if value := session.Get(key); value != nil {
-					fields = append(fields, logger.NewField(key, value))
+					r.SessionFields = append(r.SessionFields, logger.NewField(key, value))
 				}
 			}
 		}
 	}
 
-	if requestId := ctx.Values().GetString("requestId"); requestId != "" {
-		fields = append(fields, logger.NewField("request_id", requestId))
-	}
-	if traceId := ctx.Values().GetString("traceId"); traceId != "" {
-		fields = append(fields, logger.NewField("trace_id", traceId))
-	}
+	r.RequestId = ctx.Values().GetString("requestId")
+	r.TraceId = ctx.Values().GetString("traceId")
 
 	if ctxErr := ctx.GetErr(); ctxErr != nil {
-		fields = append(fields, logger.NewField("error", ctxErr))
-		level := "error"
+		r.Err = ctxErr
+		r.Level = "error"
 		if reflect.TypeOf(ctxErr).String() == "*baseError.Error" {
 			e := ctxErr.(*baseError.Error)
 			if !e.System {
-				level = "warn"
+				r.Level = "warn"
 			}
-			if len(e.Chain) > 0 {
-				fields = append(fields, logger.NewField("error_chain", e.Chain))
-			}
-		}
-		if level == "warn" {
-			l.logger.Warn("", fields...)
-		} else {
-			l.logger.Error("", fields...)
+			r.ErrorCode = e.Code
+			r.ErrorChain = e.Chain
 		}
-	} else {
-		l.logger.Info("", fields...)
 	}
+	return r
 }
@@ -0,0 +1,200 @@
+package requestLogger
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/go-estar/logger"
+	"github.com/kataras/iris/v12"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger 写入前等待gate, 模拟异步写入晚于请求结束
+type captureLogger struct {
+	gate    chan struct{}
+	mu      sync.Mutex
+	entries []map[string]json.RawMessage
+	types   []map[string]string
+}
+
+func (c *captureLogger) Level() string { return "debug" }
+
+func (c *captureLogger) capture(msg string, fields ...*logger.Field) {
+	<-c.gate
+	m := map[string]json.RawMessage{}
+	types := map[string]string{}
+	for _, field := range fields {
+		b, err := json.Marshal(field.Value)
+		if err != nil {
+			panic(err)
+		}
+		m[field.Key] = b
+		types[field.Key] = fmt.Sprintf("%T", field.Value)
+	}
+	c.mu.Lock()
+	c.entries = append(c.entries, m)
+	c.types = append(c.types, types)
+	c.mu.Unlock()
+}
+
+func (c *captureLogger) Debug(msg string, fields ...*logger.Field) { c.capture(msg, fields...) }
+func (c *captureLogger) Info(msg string, fields ...*logger.Field)  { c.capture(msg, fields...) }
+func (c *captureLogger) Warn(msg string, fields ...*logger.Field)  { c.capture(msg, fields...) }
+func (c *captureLogger) Error(msg string, fields ...*logger.Field) { c.capture(msg, fields...) }
+func (c *captureLogger) Fatal(msg string, fields ...*logger.Field) { c.capture(msg, fields...) }
+
+func TestAsyncSnapshot(t *testing.T) {
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	capture := &captureLogger{gate: make(chan struct{})}
+	l := New(capture, WithAsync(&Async{QueueSize: 10, Workers: 1}), WithContextKeys("user"), WithResponse(true))
+
+	user := map[string]interface{}{"id": "A"}
+	app := iris.New()
+	app.Get("/", l.Handler(), baseContext.Handler(func(ctx *baseContext.Context) {
+		ctx.Values().Set("user", user)
+		ctx.AddLogField("tags", []string{"a"})
+		ctx.Success("ok")
+	}))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	//请求结束后context被复用, 引用的值被其他请求修改
+	user["id"] = "B"
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	close(capture.gate)
+	if err := l.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(capture.entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(capture.entries))
+	}
+	for i, want := range []string{`{"id":"A"}`, `{"id":"B"}`} {
+		if got := string(capture.entries[i]["user"]); got != want {
+			t.Errorf("entry %d user = %s, want %s", i, got, want)
+		}
+		if got := string(capture.entries[i]["tags"]); got != `["a"]` {
+			t.Errorf("entry %d tags = %s", i, got)
+		}
+		if _, ok := capture.entries[i]["response"]; !ok {
+			t.Errorf("entry %d missing response", i)
+		}
+	}
+}
+
+func TestResponseSizeCompressed(t *testing.T) {
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	body := strings.Repeat("a", 4000)
+
+	for _, tc := range []struct {
+		name     string
+		response bool
+		before   bool
+	}{
+		{name: "logger first"},
+		{name: "compression first", before: true},
+		{name: "recorded response", response: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			capture := &captureLogger{gate: make(chan struct{})}
+			close(capture.gate)
+			l := New(capture, WithSize(true), WithResponse(tc.response), WithBody(false))
+
+			app := iris.New()
+			if tc.before {
+				app.Use(iris.Compression, l.Handler())
+			} else {
+				app.Use(l.Handler(), iris.Compression)
+			}
+			app.Get("/", func(ctx iris.Context) {
+				ctx.WriteString(body)
+			})
+			if err := app.Build(); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			if rec.Header().Get("Content-Encoding") != "gzip" {
+				t.Fatalf("response not compressed")
+			}
+			if rec.Body.Len() >= len(body) {
+				t.Fatalf("compressed body = %d bytes", rec.Body.Len())
+			}
+			if len(capture.entries) != 1 {
+				t.Fatalf("entries = %d, want 1", len(capture.entries))
+			}
+			if got, want := string(capture.entries[0]["response_size"]), strconv.Itoa(rec.Body.Len()); got != want {
+				t.Errorf("response_size = %s, want %s", got, want)
+			}
+			if got := string(capture.entries[0]["compressed"]); got != "true" {
+				t.Errorf("compressed = %s", got)
+			}
+		})
+	}
+}
+
+type testProfile struct {
+	Name string
+	Tags []string
+	Meta map[string]int
+	note string
+}
+
+// TestAsyncSameOutput 同一配置下异步和同步写入的字段值和类型一致
+func TestAsyncSameOutput(t *testing.T) {
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	serve := func(l *RequestLogger) {
+		app := iris.New()
+		app.Get("/", l.Handler(), baseContext.Handler(func(ctx *baseContext.Context) {
+			ctx.AddLogField("profile", &testProfile{Name: "a", Tags: []string{"x"}, Meta: map[string]int{"n": 1}, note: "n"})
+			ctx.AddLogField("value", testProfile{Name: "b"})
+			ctx.AddLogField("cause", stderrors.New("boom"))
+			ctx.AddLogField("ids", []int{1, 2})
+			ctx.AddLogField("attrs", map[string]interface{}{"k": []string{"v"}})
+			ctx.Error(stderrors.New("failed"))
+		}))
+		if err := app.Build(); err != nil {
+			t.Fatal(err)
+		}
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	sync := &captureLogger{gate: make(chan struct{})}
+	close(sync.gate)
+	serve(New(sync))
+
+	async := &captureLogger{gate: make(chan struct{})}
+	close(async.gate)
+	l := New(async, WithAsync(&Async{QueueSize: 10}))
+	serve(l)
+	if err := l.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sync.entries) != 1 || len(async.entries) != 1 {
+		t.Fatalf("entries = %d/%d, want 1", len(sync.entries), len(async.entries))
+	}
+	for _, key := range []string{"profile", "value", "cause", "ids", "attrs", "error"} {
+		if sync.types[0][key] != async.types[0][key] {
+			t.Errorf("%s type: sync %s, async %s", key, sync.types[0][key], async.types[0][key])
+		}
+		if string(sync.entries[0][key]) != string(async.entries[0][key]) {
+			t.Errorf("%s value: sync %s, async %s", key, sync.entries[0][key], async.entries[0][key])
+		}
+	}
+	if got := async.types[0]["cause"]; got != "*errors.errorString" {
+		t.Errorf("cause type = %s", got)
+	}
+}
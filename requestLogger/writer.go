@@ -0,0 +1,17 @@
+package requestLogger
+
+import (
+	"github.com/kataras/iris/v12/context"
+)
+
+func isCompressed(ctx *context.Context) bool {
+	if ctx.ResponseWriter().Header().Get(context.ContentEncodingHeaderKey) != "" {
+		return true
+	}
+	if rec, ok := ctx.IsRecording(); ok {
+		cw, ok := rec.ResponseWriter.(*context.CompressResponseWriter)
+		return ok && !cw.Disabled
+	}
+	cw, ok := ctx.ResponseWriter().(*context.CompressResponseWriter)
+	return ok && !cw.Disabled
+}
@@ -9,6 +9,7 @@ import (
 func New(fl *rateLimiter.RateLimiter) iris.Handler {
 	return baseContext.Handler(func(ctx *baseContext.Context) {
 		if _, err := fl.Check(ctx.GetIP()); err != nil {
+			ctx.SetRejected(baseContext.RejectedLimiter)
 			if ctx.GetHeader("referer") != "" {
 				ctx.Error(err)
 			} else {
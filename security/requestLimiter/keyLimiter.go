@@ -0,0 +1,53 @@
+package requestLimiter
+
+import (
+	"github.com/didip/tollbooth"
+	"github.com/didip/tollbooth/limiter"
+	"sync"
+)
+
+// KeyLimiter 按key独立限流, 每个key可使用不同速率, 如每个api key单独配额
+func NewKeyLimiter(options *limiter.ExpirableOptions) *KeyLimiter {
+	return &KeyLimiter{
+		options:  options,
+		limiters: make(map[string]*limiter.Limiter),
+	}
+}
+
+type KeyLimiter struct {
+	options  *limiter.ExpirableOptions
+	mu       sync.Mutex
+	limiters map[string]*limiter.Limiter
+}
+
+// Limit max为每秒请求数, burst<=0时使用默认值
+func (k *KeyLimiter) Limit(key string, max float64, burst int) error {
+	lmt := k.get(key, max, burst)
+	if err := tollbooth.LimitByKeys(lmt, []string{key}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Remove 删除key的限流器, 如key被吊销
+func (k *KeyLimiter) Remove(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.limiters, key)
+}
+
+func (k *KeyLimiter) get(key string, max float64, burst int) *limiter.Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	lmt, ok := k.limiters[key]
+	if !ok {
+		lmt = tollbooth.NewLimiter(max, k.options)
+		k.limiters[key] = lmt
+	} else if lmt.GetMax() != max {
+		lmt.SetMax(max)
+	}
+	if burst > 0 && lmt.GetBurst() != burst {
+		lmt.SetBurst(burst)
+	}
+	return lmt
+}
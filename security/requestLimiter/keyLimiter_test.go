@@ -0,0 +1,57 @@
+package requestLimiter
+
+import (
+	stderrors "errors"
+	"github.com/didip/tollbooth/errors"
+	"github.com/didip/tollbooth/limiter"
+	"testing"
+	"time"
+)
+
+func newTestKeyLimiter() *KeyLimiter {
+	return NewKeyLimiter(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Hour})
+}
+
+func TestKeyLimiter(t *testing.T) {
+	k := newTestKeyLimiter()
+	for i := 0; i < 2; i++ {
+		if err := k.Limit("a", 1, 2); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	var httpErr *errors.HTTPError
+	if err := k.Limit("a", 1, 2); !stderrors.As(err, &httpErr) || httpErr.StatusCode != 429 {
+		t.Errorf("burst exceeded: %v, want 429", err)
+	}
+	//每个key独立计数
+	if err := k.Limit("b", 1, 1); err != nil {
+		t.Errorf("key b: %v", err)
+	}
+
+	//Remove后重新计数
+	k.Remove("a")
+	if err := k.Limit("a", 1, 2); err != nil {
+		t.Errorf("after Remove: %v", err)
+	}
+}
+
+func TestKeyLimiterUpdate(t *testing.T) {
+	k := newTestKeyLimiter()
+	lmt := k.get("a", 1, 0)
+	if lmt.GetMax() != 1 {
+		t.Errorf("Max = %v, want 1", lmt.GetMax())
+	}
+	burst := lmt.GetBurst()
+
+	//速率和burst随key配置更新, 复用同一个限流器
+	if got := k.get("a", 10, 5); got != lmt || got.GetMax() != 10 || got.GetBurst() != 5 {
+		t.Errorf("get() = %p max %v burst %d, want %p max 10 burst 5", got, got.GetMax(), got.GetBurst(), lmt)
+	}
+	//burst<=0时保留当前值
+	if got := k.get("a", 10, 0); got.GetBurst() != 5 {
+		t.Errorf("Burst = %d, want 5", got.GetBurst())
+	}
+	if k.get("b", 1, 0).GetBurst() != burst {
+		t.Errorf("default Burst changed")
+	}
+}
@@ -14,6 +14,7 @@ func New(lmt *limiter.Limiter) iris.Handler {
 func LimitHandler(lmt *limiter.Limiter) func(ctx *baseContext.Context) {
 	return func(ctx *baseContext.Context) {
 		if err := tollbooth.LimitByRequest(lmt, ctx.ResponseWriter(), ctx.Request()); err != nil {
+			ctx.SetRejected(baseContext.RejectedLimiter)
 			ctx.Error(err)
 			return
 		}
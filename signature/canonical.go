@@ -0,0 +1,232 @@
+package signature
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/thoas/go-funk"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type CanonicalOption func(*CanonicalConfig)
+
+func defaultCanonicalConfig() *CanonicalConfig {
+	return &CanonicalConfig{
+		SignProperty:  "sign",
+		PairSeparator: "&",
+		KVSeparator:   "=",
+	}
+}
+
+// WithSignProperty 签名字段, 不参与签名
+func WithSignProperty(val string) CanonicalOption {
+	return func(opts *CanonicalConfig) {
+		opts.SignProperty = val
+	}
+}
+
+// WithExclude 不参与签名的字段, 嵌套字段展开后使用"a.b"
+func WithExclude(fields ...string) CanonicalOption {
+	return func(opts *CanonicalConfig) {
+		opts.Exclude = append(opts.Exclude, fields...)
+	}
+}
+
+// WithIncludeEmpty 空值(nil、""、空数组/对象)也参与签名
+func WithIncludeEmpty(val bool) CanonicalOption {
+	return func(opts *CanonicalConfig) {
+		opts.IncludeEmpty = val
+	}
+}
+
+// WithFlatten 嵌套对象展开为"a.b=1", 数组为"a[0]=1"; 未设置时嵌套值为JSON(key排序)
+func WithFlatten(val bool) CanonicalOption {
+	return func(opts *CanonicalConfig) {
+		opts.Flatten = val
+	}
+}
+func WithSeparator(pair string, kv string) CanonicalOption {
+	return func(opts *CanonicalConfig) {
+		opts.PairSeparator = pair
+		opts.KVSeparator = kv
+	}
+}
+
+// WithRepeat 重复key(如query中的a=1&a=2)的拼接方式
+func WithRepeat(val RepeatMode) CanonicalOption {
+	return func(opts *CanonicalConfig) {
+		opts.Repeat = val
+	}
+}
+
+// WithSecretKey 末尾追加"&<name>=<secret>", 如MD5签名的"&key=secret"
+func WithSecretKey(name string) CanonicalOption {
+	return func(opts *CanonicalConfig) {
+		opts.SecretKey = name
+	}
+}
+
+// WithSecretSuffix 末尾直接追加secret
+func WithSecretSuffix(val bool) CanonicalOption {
+	return func(opts *CanonicalConfig) {
+		opts.SecretSuffix = val
+	}
+}
+
+type RepeatMode int
+
+const (
+	// RepeatPairs 默认, 每个值单独一项并按值排序, a=1&a=2
+	RepeatPairs RepeatMode = iota
+	// RepeatJoin 按原顺序以逗号拼接, a=1,2; 与值本身含逗号的a=1,2无法区分, 仅用于兼容约定了该格式的调用方
+	RepeatJoin
+)
+
+type CanonicalConfig struct {
+	SignProperty  string
+	Exclude       []string
+	IncludeEmpty  bool
+	Flatten       bool
+	Repeat        RepeatMode
+	PairSeparator string
+	KVSeparator   string
+	SecretKey     string
+	SecretSuffix  bool
+}
+
+// Canonical 生成待签名字符串: key按字典序排列, 以key=value&key=value拼接
+func NewCanonical(opts ...CanonicalOption) *Canonical {
+	config := defaultCanonicalConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &Canonical{CanonicalConfig: config}
+}
+
+type Canonical struct {
+	*CanonicalConfig
+}
+
+// keyed 待签名字符串是否包含secret
+func (c *Canonical) keyed() bool {
+	return c.SecretKey != "" || c.SecretSuffix
+}
+
+type pair struct {
+	key   string
+	value string
+}
+
+func (c *Canonical) Build(params map[string]interface{}, secret string) string {
+	pairs := make([]pair, 0, len(params))
+	for key, value := range params {
+		if key == c.SignProperty {
+			continue
+		}
+		pairs = c.appendPair(pairs, key, value)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key == pairs[j].key {
+			return pairs[i].value < pairs[j].value
+		}
+		return pairs[i].key < pairs[j].key
+	})
+
+	var b strings.Builder
+	for i, p := range pairs {
+		if i > 0 {
+			b.WriteString(c.PairSeparator)
+		}
+		b.WriteString(p.key)
+		b.WriteString(c.KVSeparator)
+		b.WriteString(p.value)
+	}
+	if c.SecretKey != "" {
+		if b.Len() > 0 {
+			b.WriteString(c.PairSeparator)
+		}
+		b.WriteString(c.SecretKey)
+		b.WriteString(c.KVSeparator)
+		b.WriteString(secret)
+	}
+	if c.SecretSuffix {
+		b.WriteString(secret)
+	}
+	return b.String()
+}
+
+func (c *Canonical) appendPair(pairs []pair, key string, value interface{}) []pair {
+	if funk.ContainsString(c.Exclude, key) {
+		return pairs
+	}
+	if c.Flatten {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for k, item := range v {
+				pairs = c.appendPair(pairs, key+"."+k, item)
+			}
+			return pairs
+		case []interface{}:
+			for i, item := range v {
+				pairs = c.appendPair(pairs, key+"["+strconv.Itoa(i)+"]", item)
+			}
+			return pairs
+		}
+	}
+	if values, ok := value.([]string); ok && c.Repeat == RepeatPairs {
+		for _, v := range values {
+			if c.IncludeEmpty || v != "" {
+				pairs = append(pairs, pair{key: key, value: v})
+			}
+		}
+		return pairs
+	}
+	if !c.IncludeEmpty && isEmpty(value) {
+		return pairs
+	}
+	return append(pairs, pair{key: key, value: FormatValue(value)})
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	}
+	return false
+}
+
+// FormatValue 数字保持原文, 嵌套值为JSON
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		return strings.Join(v, ",")
+	case map[string]interface{}, []interface{}:
+		var b strings.Builder
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Sprint(v)
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	return fmt.Sprint(value)
+}
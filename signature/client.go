@@ -0,0 +1,163 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	stderrors "errors"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/go-estar/iris/authorize"
+	"github.com/go-estar/iris/baseContext"
+	"hash"
+)
+
+var (
+	ErrorClientNotFound = stderrors.New("client not found")
+	ErrorClientKey      = stderrors.New("client key not supported")
+)
+
+// Client 调用方, Secret用于HMAC/摘要, PublicKey用于RSA/SM2
+type Client struct {
+	AppId     string
+	Name      string
+	Secret    string
+	PublicKey crypto.PublicKey
+	Scopes    []string
+	Roles     []string
+	Disabled  bool
+}
+
+// KeyStore 按appId查找调用方, 不存在时返回ErrorClientNotFound
+type KeyStore interface {
+	Client(ctx context.Context, appId string) (*Client, error)
+}
+
+type KeyStoreFunc func(ctx context.Context, appId string) (*Client, error)
+
+func (f KeyStoreFunc) Client(ctx context.Context, appId string) (*Client, error) {
+	return f(ctx, appId)
+}
+
+// Clients 静态配置的调用方
+type Clients map[string]*Client
+
+func (c Clients) Client(ctx context.Context, appId string) (*Client, error) {
+	if client, ok := c[appId]; ok {
+		return client, nil
+	}
+	return nil, ErrorClientNotFound
+}
+
+// AppId Header优先, 否则从参数中读取Property
+type AppId struct {
+	Property string
+	Header   string
+	Store    KeyStore
+}
+
+// ClientSigner 使用调用方的key验签, 设置WithAppId时signer必须实现
+type ClientSigner interface {
+	VerifyClient(client *Client, params map[string]interface{}) error
+}
+
+// AlgorithmFactory 由调用方的key生成Algorithm
+type AlgorithmFactory func(client *Client) (Algorithm, error)
+
+func HMACFactory(h func() hash.Hash, encoding Encoding) AlgorithmFactory {
+	return func(client *Client) (Algorithm, error) {
+		if client.Secret == "" {
+			return nil, ErrorClientKey
+		}
+		return NewHMAC(h, []byte(client.Secret), encoding), nil
+	}
+}
+
+// DigestFactory secret由Canonical拼接, 需设置WithSecretKey或WithSecretSuffix, 不支持raw模式
+func DigestFactory(h func() hash.Hash, encoding Encoding) AlgorithmFactory {
+	digest := NewDigest(h, encoding)
+	return func(client *Client) (Algorithm, error) {
+		if client.Secret == "" {
+			return nil, ErrorClientKey
+		}
+		return digest, nil
+	}
+}
+
+// isDigestFactory 用带secret的调用方试探factory是否返回不含key的摘要
+func isDigestFactory(factory AlgorithmFactory) bool {
+	algorithm, err := factory(&Client{Secret: "probe"})
+	_, ok := algorithm.(*Digest)
+	return err == nil && ok
+}
+
+// checkFactory 设置appId时必须按调用方生成Algorithm, 不能回退到全局key
+func checkFactory(signer interface{}) {
+	switch v := signer.(type) {
+	case *ParamSigner:
+		if v.Factory == nil {
+			panic("设置appId时signer必须设置Factory, 见NewClientSigner")
+		}
+	case *BodySigner:
+		if v.Factory == nil {
+			panic("设置appId时signer必须设置Factory, 见NewClientBodySigner")
+		}
+	}
+}
+
+func RSAFactory(h crypto.Hash) AlgorithmFactory {
+	return func(client *Client) (Algorithm, error) {
+		key, ok := client.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrorClientKey
+		}
+		return NewRSA(h, key, nil), nil
+	}
+}
+
+func SM2Factory() AlgorithmFactory {
+	return func(client *Client) (Algorithm, error) {
+		key, ok := client.PublicKey.(*ecdsa.PublicKey)
+		if !ok || !sm2.IsSM2PublicKey(key) {
+			return nil, ErrorClientKey
+		}
+		return NewSM2(key, nil), nil
+	}
+}
+
+// NewClientSigner 每个调用方使用自己的key, 见HMACFactory/RSAFactory等
+func NewClientSigner(factory AlgorithmFactory, opts ...CanonicalOption) *ParamSigner {
+	if factory == nil {
+		panic("factory 必须设置")
+	}
+	canonical := NewCanonical(opts...)
+	if isDigestFactory(factory) && !canonical.keyed() {
+		panic("DigestFactory 必须设置WithSecretKey或WithSecretSuffix")
+	}
+	return &ParamSigner{
+		Factory:   factory,
+		Canonical: canonical,
+	}
+}
+
+// SetClient 验签通过的调用方写入context, 同时作为Identity供权限判断
+func SetClient(ctx *baseContext.Context, client *Client) {
+	ctx.Values().Set("client", client)
+	ctx.AddLogField("app_id", client.AppId)
+	authorize.SetIdentity(ctx, &authorize.Identity{
+		Subject: client.AppId,
+		Scheme:  "signature",
+		Scopes:  client.Scopes,
+		Roles:   client.Roles,
+		Claims:  client,
+	})
+}
+
+func GetClient(ctx *baseContext.Context) *Client {
+	if v := ctx.Values().Get("client"); v != nil {
+		if client, ok := v.(*Client); ok {
+			return client
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	stderrors "errors"
+	"fmt"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/baseContext"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrorMissingDigest     = stderrors.New("missing content-digest")
+	ErrorUnsupportedDigest = stderrors.New("unsupported content-digest algorithm")
+	ErrorInvalidDigest     = stderrors.New("invalid content-digest")
+)
+
+// digestAlgorithms RFC 9530 Content-Digest
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// ContentDigest 生成Content-Digest header值, 默认sha-256
+func ContentDigest(body []byte, algorithms ...string) (string, error) {
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha-256"}
+	}
+	values := make([]string, 0, len(algorithms))
+	for _, alg := range algorithms {
+		h, ok := digestAlgorithms[alg]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrorUnsupportedDigest, alg)
+		}
+		d := h()
+		d.Write(body)
+		values = append(values, alg+"=:"+base64.StdEncoding.EncodeToString(d.Sum(nil))+":")
+	}
+	return strings.Join(values, ", "), nil
+}
+
+// VerifyContentDigest 支持的算法都必须匹配, 至少有一个支持的算法
+func VerifyContentDigest(header string, body []byte) error {
+	if strings.TrimSpace(header) == "" {
+		return ErrorMissingDigest
+	}
+	members, err := parseDictionary(header)
+	if err != nil {
+		return ErrorInvalidDigest
+	}
+	verified := false
+	for _, m := range members {
+		h, ok := digestAlgorithms[strings.ToLower(m.name)]
+		if !ok {
+			continue
+		}
+		expected, err := parseByteSequence(m.value)
+		if err != nil {
+			return ErrorInvalidDigest
+		}
+		d := h()
+		d.Write(body)
+		if subtle.ConstantTimeCompare(expected, d.Sum(nil)) != 1 {
+			return ErrorInvalidDigest
+		}
+		verified = true
+	}
+	if !verified {
+		return ErrorUnsupportedDigest
+	}
+	return nil
+}
+
+// ReadRawBody 读取原始body并放回, 后续handler可以再次读取; 超过maxSize时返回ReadParams错误, maxSize<=0时不限制
+func ReadRawBody(ctx *baseContext.Context, maxSize int64) ([]byte, error) {
+	req := ctx.Request()
+	if req.Body == nil {
+		return nil, nil
+	}
+	reader := req.Body
+	if maxSize > 0 {
+		reader = http.MaxBytesReader(ctx.ResponseWriter(), req.Body, maxSize)
+	}
+	body, err := io.ReadAll(reader)
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	var maxBytesError *http.MaxBytesError
+	if stderrors.As(err, &maxBytesError) {
+		return nil, baseError.NewCode(ctx.ErrorCodes["ReadParams"], "request body too large")
+	}
+	if err != nil {
+		return nil, baseError.NewSystemWrap(err)
+	}
+	return body, nil
+}
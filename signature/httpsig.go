@@ -0,0 +1,706 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	stderrors "errors"
+	"fmt"
+	"github.com/emmansun/gmsm/sm2"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/kataras/iris/v12"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RFC 9421 HTTP Message Signatures
+
+var (
+	ErrorMissingSignature   = stderrors.New("missing signature")
+	ErrorSignatureInput     = stderrors.New("invalid signature-input")
+	ErrorSignatureExpired   = stderrors.New("signature expired")
+	ErrorSignatureCreated   = stderrors.New("signature created in the future")
+	ErrorMissingComponent   = stderrors.New("missing covered component")
+	ErrorUnsupportedAlg     = stderrors.New("unsupported signature algorithm")
+	ErrorUnsupportedKey     = stderrors.New("unsupported signature key")
+	ErrorRequiredComponents = stderrors.New("required component not covered")
+)
+
+const (
+	AlgHMACSHA256      = "hmac-sha256"
+	AlgRSAPSSSHA512    = "rsa-pss-sha512"
+	AlgRSAV15SHA256    = "rsa-v1_5-sha256"
+	AlgECDSAP256SHA256 = "ecdsa-p256-sha256"
+	AlgED25519         = "ed25519"
+	// AlgSM2SM3 非RFC注册算法, 用于国密对接
+	AlgSM2SM3 = "sm2-sm3"
+)
+
+// SignatureParams Signature-Input中的一个签名
+type SignatureParams struct {
+	Label      string
+	Components []string
+	Created    time.Time
+	Expires    time.Time
+	Nonce      string
+	KeyId      string
+	Alg        string
+	Tag        string
+	// raw Signature-Input中的原始值, 作为@signature-params
+	raw string
+}
+
+// Serialize 生成@signature-params, 也是Signature-Input中label对应的值
+func (p *SignatureParams) Serialize() string {
+	if p.raw != "" {
+		return p.raw
+	}
+	var b strings.Builder
+	b.WriteString("(")
+	for i, c := range p.Components {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(serializeComponent(c))
+	}
+	b.WriteString(")")
+	if !p.Created.IsZero() {
+		b.WriteString(";created=" + strconv.FormatInt(p.Created.Unix(), 10))
+	}
+	if !p.Expires.IsZero() {
+		b.WriteString(";expires=" + strconv.FormatInt(p.Expires.Unix(), 10))
+	}
+	for _, kv := range [][2]string{{"nonce", p.Nonce}, {"alg", p.Alg}, {"keyid", p.KeyId}, {"tag", p.Tag}} {
+		if kv[1] != "" {
+			b.WriteString(";" + kv[0] + "=" + strconv.Quote(kv[1]))
+		}
+	}
+	return b.String()
+}
+
+// serializeComponent "@query-param;name=id"转为"\"@query-param\";name=\"id\""
+func serializeComponent(c string) string {
+	name, params, _ := strings.Cut(c, ";")
+	s := strconv.Quote(name)
+	if params != "" {
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(param, "=")
+			if ok {
+				s += ";" + k + "=" + strconv.Quote(strings.Trim(v, `"`))
+			} else {
+				s += ";" + k
+			}
+		}
+	}
+	return s
+}
+
+// ParseSignatureInput 解析Signature-Input, 组件参数保存为"name;key=value"
+func ParseSignatureInput(header string) ([]*SignatureParams, error) {
+	members, err := parseDictionary(header)
+	if err != nil {
+		return nil, ErrorSignatureInput
+	}
+	result := make([]*SignatureParams, 0, len(members))
+	for _, m := range members {
+		p, err := parseSignatureParams(m.name, m.value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+func parseSignatureParams(label string, value string) (*SignatureParams, error) {
+	p := &SignatureParams{Label: label, raw: value}
+	if !strings.HasPrefix(value, "(") {
+		return nil, ErrorSignatureInput
+	}
+	end := closingParen(value)
+	if end == -1 {
+		return nil, ErrorSignatureInput
+	}
+	for _, item := range splitOutside(value[1:end], ' ') {
+		if item == "" {
+			continue
+		}
+		name, params, err := parseItem(item)
+		if err != nil {
+			return nil, ErrorSignatureInput
+		}
+		component := strings.ToLower(name)
+		for _, kv := range params {
+			component += ";" + kv[0]
+			if kv[1] != "" {
+				component += "=" + kv[1]
+			}
+		}
+		p.Components = append(p.Components, component)
+	}
+	_, params, err := parseItem(`""` + value[end+1:])
+	if err != nil {
+		return nil, ErrorSignatureInput
+	}
+	for _, kv := range params {
+		switch kv[0] {
+		case "created", "expires":
+			n, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return nil, ErrorSignatureInput
+			}
+			if kv[0] == "created" {
+				p.Created = time.Unix(n, 0)
+			} else {
+				p.Expires = time.Unix(n, 0)
+			}
+		case "nonce":
+			p.Nonce = kv[1]
+		case "keyid":
+			p.KeyId = kv[1]
+		case "alg":
+			p.Alg = kv[1]
+		case "tag":
+			p.Tag = kv[1]
+		}
+	}
+	return p, nil
+}
+
+// SignatureBase RFC 9421 2.5
+func SignatureBase(req *http.Request, params *SignatureParams) (string, error) {
+	var b strings.Builder
+	for _, c := range params.Components {
+		value, err := componentValue(req, c)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(serializeComponent(c))
+		b.WriteString(": ")
+		b.WriteString(value)
+		b.WriteString("\n")
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(params.Serialize())
+	return b.String(), nil
+}
+
+func componentValue(req *http.Request, component string) (string, error) {
+	name, param, _ := strings.Cut(component, ";")
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	switch name {
+	case "@method":
+		return strings.ToUpper(req.Method), nil
+	case "@target-uri":
+		return scheme + "://" + strings.ToLower(req.Host) + req.URL.RequestURI(), nil
+	case "@authority":
+		return strings.ToLower(req.Host), nil
+	case "@scheme":
+		return scheme, nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if path := req.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	case "@query-param":
+		key, value, _ := strings.Cut(param, "=")
+		if key != "name" {
+			return "", fmt.Errorf("%w: %s", ErrorSignatureInput, component)
+		}
+		values, ok := req.URL.Query()[value]
+		if !ok || len(values) == 0 {
+			return "", fmt.Errorf("%w: %s", ErrorMissingComponent, component)
+		}
+		return strings.ReplaceAll(url.QueryEscape(values[0]), "+", "%20"), nil
+	}
+	if strings.HasPrefix(name, "@") || param != "" {
+		return "", fmt.Errorf("%w: %s", ErrorSignatureInput, component)
+	}
+	if name == "host" {
+		return strings.ToLower(req.Host), nil
+	}
+	header := req.Header.Values(name)
+	if len(header) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrorMissingComponent, name)
+	}
+	values := make([]string, len(header))
+	for i, v := range header {
+		values[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+// SignRequest 为请求添加Signature-Input和Signature, key类型见signHTTP
+func SignRequest(req *http.Request, params *SignatureParams, key interface{}) error {
+	if params.Label == "" {
+		params.Label = "sig1"
+	}
+	params.raw = ""
+	base, err := SignatureBase(req, params)
+	if err != nil {
+		return err
+	}
+	sig, err := signHTTP(params.Alg, key, []byte(base))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature-Input", params.Label+"="+params.Serialize())
+	req.Header.Set("Signature", params.Label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// signHTTP key: []byte(HMAC)、*rsa.PrivateKey、*ecdsa.PrivateKey、ed25519.PrivateKey、*sm2.PrivateKey
+func signHTTP(alg string, key interface{}, base []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case []byte:
+		if alg != "" && alg != AlgHMACSHA256 {
+			return nil, ErrorUnsupportedAlg
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	case *rsa.PrivateKey:
+		if alg == AlgRSAV15SHA256 {
+			digest := sha256.Sum256(base)
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		}
+		if alg != "" && alg != AlgRSAPSSSHA512 {
+			return nil, ErrorUnsupportedAlg
+		}
+		digest := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, k, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+	case *sm2.PrivateKey:
+		return k.Sign(rand.Reader, base, sm2.NewSM2SignerOption(true, nil))
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, ErrorUnsupportedKey
+		}
+		digest := sha256.Sum256(base)
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, base), nil
+	}
+	return nil, ErrorUnsupportedKey
+}
+
+// verifyHTTP alg为空时按key类型确定, RSA默认rsa-pss-sha512
+func verifyHTTP(alg string, client *Client, base []byte, sig []byte) error {
+	if alg == "" {
+		alg = defaultAlg(client)
+	}
+	valid := false
+	switch alg {
+	case AlgHMACSHA256:
+		if client.Secret == "" {
+			return ErrorUnsupportedKey
+		}
+		mac := hmac.New(sha256.New, []byte(client.Secret))
+		mac.Write(base)
+		valid = hmac.Equal(sig, mac.Sum(nil))
+	case AlgRSAPSSSHA512, AlgRSAV15SHA256:
+		key, ok := client.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return ErrorUnsupportedKey
+		}
+		if alg == AlgRSAV15SHA256 {
+			digest := sha256.Sum256(base)
+			valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+		} else {
+			digest := sha512.Sum512(base)
+			valid = rsa.VerifyPSS(key, crypto.SHA512, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil
+		}
+	case AlgECDSAP256SHA256:
+		key, ok := client.PublicKey.(*ecdsa.PublicKey)
+		if !ok || key.Curve != elliptic.P256() || len(sig) != 64 {
+			return ErrorUnsupportedKey
+		}
+		digest := sha256.Sum256(base)
+		valid = ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+	case AlgED25519:
+		key, ok := client.PublicKey.(ed25519.PublicKey)
+		if !ok {
+			return ErrorUnsupportedKey
+		}
+		valid = ed25519.Verify(key, base, sig)
+	case AlgSM2SM3:
+		key, ok := client.PublicKey.(*ecdsa.PublicKey)
+		if !ok || !sm2.IsSM2PublicKey(key) {
+			return ErrorUnsupportedKey
+		}
+		valid = sm2.VerifyASN1WithSM2(key, nil, base, sig)
+	default:
+		return ErrorUnsupportedAlg
+	}
+	if !valid {
+		return ErrorInvalidSign
+	}
+	return nil
+}
+
+func defaultAlg(client *Client) string {
+	switch k := client.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return AlgRSAPSSSHA512
+	case *ecdsa.PublicKey:
+		if sm2.IsSM2PublicKey(k) {
+			return AlgSM2SM3
+		}
+		return AlgECDSAP256SHA256
+	case ed25519.PublicKey:
+		return AlgED25519
+	}
+	return AlgHMACSHA256
+}
+
+// DefaultHTTPComponents 未设置WithHTTPComponents时必须覆盖的组件, 有body时还必须覆盖content-digest
+var DefaultHTTPComponents = []string{"@method", "@authority", "@path"}
+
+type HTTPOption func(*HTTPConfig)
+
+func defaultHTTPConfig() *HTTPConfig {
+	return &HTTPConfig{
+		MaxAge:      5 * time.Minute,
+		Skew:        10 * time.Second,
+		Clock:       time.Now,
+		MaxBodySize: 1 << 20,
+	}
+}
+
+// WithHTTPLabel 只验证指定label的签名, 未设置时验证Signature-Input中的第一个
+func WithHTTPLabel(val string) HTTPOption {
+	return func(opts *HTTPConfig) {
+		opts.Label = val
+	}
+}
+
+// WithHTTPComponents 必须覆盖的组件, 替换DefaultHTTPComponents
+func WithHTTPComponents(components ...string) HTTPOption {
+	return func(opts *HTTPConfig) {
+		for _, c := range components {
+			opts.Components = append(opts.Components, strings.ToLower(c))
+		}
+	}
+}
+
+// WithHTTPMaxAge created距今的最长时间, 0表示不检查
+func WithHTTPMaxAge(val time.Duration) HTTPOption {
+	return func(opts *HTTPConfig) {
+		opts.MaxAge = val
+	}
+}
+
+// WithHTTPAlgorithm 忽略alg参数, 固定使用该算法
+func WithHTTPAlgorithm(val string) HTTPOption {
+	return func(opts *HTTPConfig) {
+		opts.Algorithm = val
+	}
+}
+
+// WithHTTPNonce 签名参数带nonce时检查重放, 有效期为MaxAge, 未设置MaxAge时为1小时
+func WithHTTPNonce(store NonceStore) HTTPOption {
+	return func(opts *HTTPConfig) {
+		opts.NonceStore = store
+	}
+}
+func WithHTTPPaths(paths ...PathConfig) HTTPOption {
+	return func(opts *HTTPConfig) {
+		opts.Paths = append(opts.Paths, paths...)
+	}
+}
+func WithHTTPIgnorePaths(paths ...string) HTTPOption {
+	return func(opts *HTTPConfig) {
+		for _, path := range paths {
+			opts.Paths = append(opts.Paths, PathConfig{path, LevelIgnore})
+		}
+	}
+}
+
+// WithHTTPMaxBodySize 校验content-digest时读取body的最大字节数, 默认1MB
+func WithHTTPMaxBodySize(val int64) HTTPOption {
+	return func(opts *HTTPConfig) {
+		opts.MaxBodySize = val
+	}
+}
+func WithHTTPClock(val func() time.Time) HTTPOption {
+	return func(opts *HTTPConfig) {
+		opts.Clock = val
+	}
+}
+
+type HTTPConfig struct {
+	Label       string
+	Components  []string
+	MaxAge      time.Duration
+	Skew        time.Duration
+	Algorithm   string
+	NonceStore  NonceStore
+	Paths       []PathConfig
+	Clock       func() time.Time
+	MaxBodySize int64
+}
+
+// NewHTTPSignature 验证Signature/Signature-Input header, keyid对应KeyStore的appId
+// 覆盖content-digest时同时校验body
+func NewHTTPSignature(store KeyStore, opts ...HTTPOption) *HTTPSignature {
+	if store == nil {
+		panic("store 必须设置")
+	}
+	config := defaultHTTPConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	if len(config.Components) == 0 {
+		config.Components = append([]string{}, DefaultHTTPComponents...)
+	}
+	return &HTTPSignature{
+		Store:      store,
+		HTTPConfig: config,
+	}
+}
+
+type HTTPSignature struct {
+	Store KeyStore
+	*HTTPConfig
+}
+
+// Verify 返回验签通过的调用方和签名参数
+func (h *HTTPSignature) Verify(ctx *baseContext.Context) (*Client, *SignatureParams, error) {
+	client, params, err := h.verify(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client.AppId == "" {
+		copied := *client
+		copied.AppId = params.KeyId
+		client = &copied
+	}
+	return client, params, nil
+}
+
+func (h *HTTPSignature) verify(ctx *baseContext.Context) (*Client, *SignatureParams, error) {
+	req := ctx.Request()
+	input := req.Header.Get("Signature-Input")
+	signature := req.Header.Get("Signature")
+	if input == "" || signature == "" {
+		return nil, nil, ErrorMissingSignature
+	}
+	inputs, err := ParseSignatureInput(input)
+	if err != nil || len(inputs) == 0 {
+		return nil, nil, ErrorSignatureInput
+	}
+	params := inputs[0]
+	if h.Label != "" {
+		params = nil
+		for _, p := range inputs {
+			if p.Label == h.Label {
+				params = p
+			}
+		}
+		if params == nil {
+			return nil, nil, ErrorMissingSignature
+		}
+	}
+	sig, err := lookupSignature(signature, params.Label)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, c := range h.Components {
+		if !containsComponent(params.Components, c) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrorRequiredComponents, c)
+		}
+	}
+	if err := h.checkTime(params); err != nil {
+		return nil, nil, err
+	}
+	if params.KeyId == "" {
+		return nil, nil, fmt.Errorf("%w: keyid", ErrorSignatureInput)
+	}
+	client, err := h.Store.Client(ctx.RequestCtx(), params.KeyId)
+	if stderrors.Is(err, ErrorClientNotFound) {
+		return nil, nil, baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], err)
+	}
+	if err != nil {
+		return nil, nil, baseError.NewSystemWrap(err)
+	}
+	if client.Disabled {
+		return nil, nil, baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "client disabled")
+	}
+
+	base, err := SignatureBase(req, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	alg := params.Alg
+	if h.Algorithm != "" {
+		alg = h.Algorithm
+	}
+	if err := verifyHTTP(alg, client, []byte(base), sig); err != nil {
+		return nil, nil, err
+	}
+	//有body时必须覆盖content-digest, 否则body可被替换; 未覆盖时只判断body是否为空, 不读取整个body
+	if !containsComponent(params.Components, "content-digest") {
+		nonEmpty, err := hasBody(req)
+		if err != nil {
+			return nil, nil, baseError.NewSystemWrap(err)
+		}
+		if nonEmpty {
+			return nil, nil, fmt.Errorf("%w: content-digest", ErrorRequiredComponents)
+		}
+		return client, params, nil
+	}
+	body, err := ReadRawBody(ctx, h.MaxBodySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := VerifyContentDigest(req.Header.Get("Content-Digest"), body); err != nil {
+		return nil, nil, err
+	}
+	return client, params, nil
+}
+
+// hasBody 长度未知时读取1字节判断, 读取的内容放回body
+func hasBody(req *http.Request) (bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return false, nil
+	}
+	if req.ContentLength > 0 {
+		return true, nil
+	}
+	var b [1]byte
+	n, err := io.ReadFull(req.Body, b[:])
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b[:n]), req.Body), req.Body}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (h *HTTPSignature) checkTime(params *SignatureParams) error {
+	now := h.Clock()
+	if !params.Expires.IsZero() && !now.Before(params.Expires) {
+		return ErrorSignatureExpired
+	}
+	if params.Created.IsZero() {
+		if h.MaxAge > 0 {
+			return fmt.Errorf("%w: created", ErrorSignatureInput)
+		}
+		return nil
+	}
+	if params.Created.Sub(now) > h.Skew {
+		return ErrorSignatureCreated
+	}
+	if h.MaxAge > 0 && now.Sub(params.Created) > h.MaxAge {
+		return ErrorSignatureExpired
+	}
+	return nil
+}
+
+func (h *HTTPSignature) Context(ctx *baseContext.Context) {
+	if MatchPath(h.Paths, ctx.Request().URL.Path) == LevelIgnore {
+		ctx.Next()
+		return
+	}
+	client, params, err := h.Verify(ctx)
+	if err != nil {
+		h.reject(ctx, err)
+		return
+	}
+	if h.NonceStore != nil && params.Nonce != "" {
+		ttl := h.MaxAge + h.Skew
+		if h.MaxAge <= 0 {
+			ttl = time.Hour
+		}
+		ok, err := h.NonceStore.Use(ctx.RequestCtx(), client.AppId+":"+params.Nonce, ttl)
+		if err != nil {
+			h.reject(ctx, baseError.NewSystemWrap(err))
+			return
+		}
+		if !ok {
+			h.reject(ctx, baseError.NewCode(ctx.ErrorCodes["Replay"], "nonce has been used"))
+			return
+		}
+	}
+	SetClient(ctx, client)
+	ctx.Next()
+}
+
+func (h *HTTPSignature) reject(ctx *baseContext.Context, err error) {
+	ctx.SetRejected(baseContext.RejectedSignature)
+	ctx.Error(httpSigRejectError(ctx, err))
+}
+
+// httpSigRejectError 将RFC 9421/9530验签错误映射为Unauthorized, 其余交给rejectError处理
+func httpSigRejectError(ctx *baseContext.Context, err error) error {
+	switch {
+	case stderrors.Is(err, ErrorMissingSignature), stderrors.Is(err, ErrorSignatureInput),
+		stderrors.Is(err, ErrorSignatureExpired), stderrors.Is(err, ErrorSignatureCreated),
+		stderrors.Is(err, ErrorMissingComponent), stderrors.Is(err, ErrorRequiredComponents),
+		stderrors.Is(err, ErrorUnsupportedAlg), stderrors.Is(err, ErrorMissingDigest),
+		stderrors.Is(err, ErrorUnsupportedDigest), stderrors.Is(err, ErrorInvalidDigest):
+		if !baseError.IsBaseError(err) {
+			return baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], err)
+		}
+	}
+	return rejectError(ctx, err)
+}
+
+func (h *HTTPSignature) Handler() iris.Handler {
+	return baseContext.Handler(h.Context)
+}
+
+func containsComponent(components []string, component string) bool {
+	for _, c := range components {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+func lookupSignature(header string, label string) ([]byte, error) {
+	members, err := parseDictionary(header)
+	if err != nil {
+		return nil, ErrorSignatureInput
+	}
+	for _, m := range members {
+		if m.name == label {
+			sig, err := parseByteSequence(m.value)
+			if err != nil {
+				return nil, ErrorSignatureInput
+			}
+			return sig, nil
+		}
+	}
+	return nil, ErrorMissingSignature
+}
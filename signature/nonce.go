@@ -0,0 +1,87 @@
+package signature
+
+import (
+	"container/list"
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// NonceStore 记录已使用的nonce, 首次使用返回true
+type NonceStore interface {
+	Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+type Nonce struct {
+	Property string
+	Store    NonceStore
+}
+
+func NewMemoryNonceStore(size int) *MemoryNonceStore {
+	if size <= 0 {
+		panic("size 必须大于0")
+	}
+	return &MemoryNonceStore{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+		Clock: time.Now,
+	}
+}
+
+type nonceItem struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// MemoryNonceStore 单实例使用, 超过size时淘汰最早的nonce
+// 淘汰未过期的nonce会使其可被重放, size应大于时间窗口内的请求数
+// 通过WithNonce传入时Clock与Signature使用同一时钟
+type MemoryNonceStore struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+	Clock func() time.Time
+}
+
+func (s *MemoryNonceStore) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	now := s.Clock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[nonce]; ok {
+		if now.Before(el.Value.(*nonceItem).expiresAt) {
+			return false, nil
+		}
+		s.order.Remove(el)
+		delete(s.items, nonce)
+	}
+	// 按写入顺序过期, 从最早的开始清理
+	for el := s.order.Front(); el != nil; el = s.order.Front() {
+		item := el.Value.(*nonceItem)
+		if now.Before(item.expiresAt) && s.order.Len() < s.size {
+			break
+		}
+		s.order.Remove(el)
+		delete(s.items, item.nonce)
+	}
+	s.items[nonce] = s.order.PushBack(&nonceItem{nonce: nonce, expiresAt: now.Add(ttl)})
+	return true, nil
+}
+
+func NewRedisNonceStore(client *redis.Client, prefix string) *RedisNonceStore {
+	if client == nil {
+		panic("client 必须设置")
+	}
+	return &RedisNonceStore{Client: client, Prefix: prefix}
+}
+
+type RedisNonceStore struct {
+	Client *redis.Client
+	Prefix string
+}
+
+func (s *RedisNonceStore) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.Client.SetNX(ctx, s.Prefix+"nonce:"+nonce, 1, ttl).Result()
+}
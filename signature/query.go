@@ -0,0 +1,74 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrorDuplicateParam = stderrors.New("duplicate param in query and body")
+)
+
+// ParseQuery 解析query, 单个值为string, 重复key为[]string(保持原顺序), 与ReadForm一致
+// raw为true时保留百分号编码, 用于对原样query签名的调用方
+func ParseQuery(rawQuery string, raw bool) (map[string]interface{}, error) {
+	values := make(map[string][]string)
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		if !raw {
+			var err error
+			if key, err = url.QueryUnescape(key); err != nil {
+				return nil, err
+			}
+			if value, err = url.QueryUnescape(value); err != nil {
+				return nil, err
+			}
+		}
+		values[key] = append(values[key], value)
+	}
+	params := make(map[string]interface{}, len(values))
+	for key, v := range values {
+		if len(v) == 1 {
+			params[key] = v[0]
+		} else {
+			params[key] = v
+		}
+	}
+	return params, nil
+}
+
+// decodeJSONBody 空body返回空参数
+func decodeJSONBody(body []byte) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if len(bytes.TrimSpace(body)) == 0 {
+		return params, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// mergeParams query和body的同名参数视为错误, 避免签名与业务读取的值不一致
+func mergeParams(query map[string]interface{}, body map[string]interface{}) (map[string]interface{}, error) {
+	params := make(map[string]interface{}, len(query)+len(body))
+	for key, value := range query {
+		params[key] = value
+	}
+	for key, value := range body {
+		if _, ok := params[key]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrorDuplicateParam, key)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
@@ -0,0 +1,127 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// RawSigner 对原始body验签, 保留key顺序和数字格式
+type RawSigner interface {
+	VerifyRaw(header http.Header, body []byte) error
+}
+
+// RawClientSigner 使用调用方的key验签, 设置WithAppId时raw signer必须实现
+type RawClientSigner interface {
+	VerifyRawClient(client *Client, header http.Header, body []byte) error
+}
+
+// NewRaw 以原始body验签, body验签后仍可被后续handler读取
+// body为JSON对象时解析为参数, 供timestamp/nonce/appId读取
+func NewRaw(signer RawSigner, opts ...Option) *Signature {
+	if signer == nil {
+		panic("signer 必须设置")
+	}
+	s := newSignature(nil, signer, append(opts, WithBodyType(BodyTypeRaw))...)
+	if s.AppId != nil {
+		if _, ok := signer.(RawClientSigner); !ok {
+			panic("设置appId时signer必须实现RawClientSigner")
+		}
+		checkFactory(signer)
+	}
+	return s
+}
+
+// BodySigner 签名在header中, 待签名数据为原始body
+type BodySigner struct {
+	Algorithm Algorithm
+	Factory   AlgorithmFactory
+	Header    string
+}
+
+func NewBodySigner(algorithm Algorithm, header string) *BodySigner {
+	if algorithm == nil {
+		panic("algorithm 必须设置")
+	}
+	if header == "" {
+		panic("header 必须设置")
+	}
+	return &BodySigner{Algorithm: algorithm, Header: header}
+}
+
+// NewClientBodySigner 每个调用方使用自己的key, 见HMACFactory/RSAFactory等
+func NewClientBodySigner(factory AlgorithmFactory, header string) *BodySigner {
+	if factory == nil {
+		panic("factory 必须设置")
+	}
+	if header == "" {
+		panic("header 必须设置")
+	}
+	if isDigestFactory(factory) {
+		panic("raw模式不支持DigestFactory")
+	}
+	return &BodySigner{Factory: factory, Header: header}
+}
+
+// algorithm client为nil时使用固定的Algorithm, 否则只使用调用方的key
+func (s *BodySigner) algorithm(client *Client) (Algorithm, error) {
+	if client == nil {
+		if s.Algorithm == nil {
+			return nil, ErrorClientNotFound
+		}
+		return s.Algorithm, nil
+	}
+	if s.Factory == nil {
+		return nil, ErrorClientKey
+	}
+	algorithm, err := s.Factory(client)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := algorithm.(*Digest); ok {
+		return nil, ErrorClientKey
+	}
+	return algorithm, nil
+}
+
+func (s *BodySigner) VerifyRaw(header http.Header, body []byte) error {
+	return s.VerifyRawClient(nil, header, body)
+}
+
+func (s *BodySigner) VerifyRawClient(client *Client, header http.Header, body []byte) error {
+	sign := header.Get(s.Header)
+	if sign == "" {
+		return ErrorMissingSign
+	}
+	algorithm, err := s.algorithm(client)
+	if err != nil {
+		return err
+	}
+	return algorithm.Verify(body, sign)
+}
+
+// Sign 返回body的签名, 用于调用方或响应签名
+func (s *BodySigner) Sign(body []byte) (string, error) {
+	return s.SignClient(nil, body)
+}
+
+func (s *BodySigner) SignClient(client *Client, body []byte) (string, error) {
+	algorithm, err := s.algorithm(client)
+	if err != nil {
+		return "", err
+	}
+	return algorithm.Sign(body)
+}
+
+// rawParams body为JSON对象时解析为参数, 否则为空
+func rawParams(body []byte) map[string]interface{} {
+	params := make(map[string]interface{})
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return params
+	}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+	_ = decoder.Decode(&params)
+	return params
+}
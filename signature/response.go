@@ -0,0 +1,313 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	baseError "github.com/go-estar/base-error"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorEnvelopeContent = stderrors.New("text/binary response can't be signed in envelope mode")
+	ErrorJSONOptions     = stderrors.New("json Secure/ASCII/Prefix options can't be signed in header mode")
+)
+
+type ResponseOption func(*ResponseConfig)
+
+func defaultResponseConfig() *ResponseConfig {
+	return &ResponseConfig{
+		TimestampUnit: time.Second,
+		Clock:         time.Now,
+	}
+}
+
+// WithResponseTimestamp 写入签名时间, 信封模式为字段名, header模式为header名
+func WithResponseTimestamp(name string, unit time.Duration) ResponseOption {
+	return func(opts *ResponseConfig) {
+		if name == "" {
+			panic("timestamp 必须设置")
+		}
+		if unit != 0 {
+			opts.TimestampUnit = unit
+		}
+		opts.Timestamp = name
+	}
+}
+
+// WithResponseNonce 写入随机nonce, 信封模式为字段名, header模式为header名
+func WithResponseNonce(name string) ResponseOption {
+	return func(opts *ResponseConfig) {
+		if name == "" {
+			panic("nonce 必须设置")
+		}
+		opts.Nonce = name
+	}
+}
+
+func WithResponseClock(val func() time.Time) ResponseOption {
+	return func(opts *ResponseConfig) {
+		opts.Clock = val
+	}
+}
+
+type ResponseConfig struct {
+	Timestamp     string
+	TimestampUnit time.Duration
+	Nonce         string
+	Clock         func() time.Time
+}
+
+// ResponseSigner 使用服务端的key(HMAC secret或私钥)对输出的Response签名
+type ResponseSigner struct {
+	Signer     *ParamSigner
+	BodySigner *BodySigner
+	*ResponseConfig
+}
+
+// NewResponseSigner 信封模式: JSON响应的字段参与签名, 签名写入Canonical的SignProperty
+func NewResponseSigner(signer *ParamSigner, opts ...ResponseOption) *ResponseSigner {
+	if signer == nil || signer.Algorithm == nil {
+		panic("signer 必须设置Algorithm")
+	}
+	return newResponseSigner(signer, nil, opts...)
+}
+
+// NewResponseBodySigner header模式: 对输出的原始bytes签名, 签名写入BodySigner.Header
+// 设置timestamp/nonce时待签名数据为 timestamp\nnonce\nbody
+func NewResponseBodySigner(signer *BodySigner, opts ...ResponseOption) *ResponseSigner {
+	if signer == nil || signer.Algorithm == nil {
+		panic("signer 必须设置Algorithm")
+	}
+	return newResponseSigner(nil, signer, opts...)
+}
+
+func newResponseSigner(signer *ParamSigner, bodySigner *BodySigner, opts ...ResponseOption) *ResponseSigner {
+	config := defaultResponseConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &ResponseSigner{
+		Signer:         signer,
+		BodySigner:     bodySigner,
+		ResponseConfig: config,
+	}
+}
+
+// Wrap 替换当前请求的NewResponse, 在渲染时签名
+func (r *ResponseSigner) Wrap(ctx *baseContext.Context) {
+	next := ctx.Response
+	if v := ctx.Values().Get("response"); v != nil {
+		if response, ok := v.(baseContext.NewResponse); ok {
+			next = response
+		}
+	}
+	ctx.SetResponse(func() baseContext.Response {
+		return &signedResponse{Response: next(), next: next, signer: r, ctx: ctx}
+	})
+}
+
+func (r *ResponseSigner) Context(ctx *baseContext.Context) {
+	r.Wrap(ctx)
+	ctx.Next()
+}
+
+func (r *ResponseSigner) Handler() iris.Handler {
+	return baseContext.Handler(r.Context)
+}
+
+func (r *ResponseSigner) timestamp() string {
+	return strconv.FormatInt(r.Clock().UnixNano()/int64(r.TimestampUnit), 10)
+}
+
+// signEnvelope JSON响应转为参数后签名, 返回带签名的信封
+func (r *ResponseSigner) signEnvelope(content interface{}) (interface{}, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	params := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&params); err != nil {
+		return nil, err
+	}
+	if r.Timestamp != "" {
+		params[r.Timestamp] = r.timestamp()
+	}
+	if r.Nonce != "" {
+		params[r.Nonce] = newNonce()
+	}
+	sign, err := r.Signer.Sign(params)
+	if err != nil {
+		return nil, err
+	}
+	params[r.Signer.Canonical.SignProperty] = sign
+	return params, nil
+}
+
+// signBody 对输出的bytes签名, 签名成功后才写入header
+func (r *ResponseSigner) signBody(ctx *baseContext.Context, body []byte) error {
+	var timestamp, nonce string
+	parts := make([]string, 0, 3)
+	if r.Timestamp != "" {
+		timestamp = r.timestamp()
+		parts = append(parts, timestamp)
+	}
+	if r.Nonce != "" {
+		nonce = newNonce()
+		parts = append(parts, nonce)
+	}
+	data := body
+	if len(parts) > 0 {
+		data = []byte(strings.Join(append(parts, string(body)), "\n"))
+	}
+	sign, err := r.BodySigner.Sign(data)
+	if err != nil {
+		return err
+	}
+	//ctx.Header为Add, 使用Set保证只有一个值
+	header := ctx.ResponseWriter().Header()
+	if timestamp != "" {
+		header.Set(r.Timestamp, timestamp)
+	}
+	if nonce != "" {
+		header.Set(r.Nonce, nonce)
+	}
+	header.Set(r.BodySigner.Header, sign)
+	return nil
+}
+
+// encodeJSON 与iris的ctx.JSON输出一致(json.Encoder, DefaultJSONOptions的转义及缩进, 末尾换行), 保证签名的bytes与响应body相同
+// Secure/ASCII/Prefix会在编码后改写bytes, 不支持
+func encodeJSON(content interface{}) ([]byte, error) {
+	options := context.DefaultJSONOptions
+	if options.Secure || options.ASCII || options.Prefix != "" {
+		return nil, ErrorJSONOptions
+	}
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(!options.UnescapeHTML)
+	enc.SetIndent("", options.Indent)
+	if err := enc.Encode(content); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// signedResponse 包装Response, Content时签名, 链式调用返回自身
+type signedResponse struct {
+	baseContext.Response
+	next   baseContext.NewResponse
+	signer *ResponseSigner
+	ctx    *baseContext.Context
+	// content 签名结果, 多次调用Content时只签名一次, 避免header与body的timestamp/nonce不一致
+	content interface{}
+	signed  bool
+}
+
+func (s *signedResponse) Success() baseContext.Response {
+	s.Response.Success()
+	return s
+}
+
+func (s *signedResponse) Error(err *baseError.Error) baseContext.Response {
+	s.Response.Error(err)
+	return s
+}
+
+func (s *signedResponse) SetCode(code string) baseContext.Response {
+	s.Response.SetCode(code)
+	return s
+}
+
+func (s *signedResponse) SetMessage(message string) baseContext.Response {
+	s.Response.SetMessage(message)
+	return s
+}
+
+func (s *signedResponse) SetData(data interface{}) baseContext.Response {
+	s.Response.SetData(data)
+	return s
+}
+
+func (s *signedResponse) SetRid(rid string) baseContext.Response {
+	s.Response.SetRid(rid)
+	return s
+}
+
+// Content 签名失败时输出系统错误(500), 不输出未签名的内容
+func (s *signedResponse) Content() interface{} {
+	if !s.signed {
+		s.content = s.sign()
+		s.signed = true
+	}
+	return s.content
+}
+
+func (s *signedResponse) sign() interface{} {
+	content := s.Response.Content()
+	var err error
+	var signed interface{}
+	switch s.Response.ContentType() {
+	case "text":
+		if s.signer.BodySigner == nil {
+			return s.failed(ErrorEnvelopeContent)
+		}
+		err = s.signer.signBody(s.ctx, []byte(content.(string)))
+		signed = content
+	case "binary":
+		if s.signer.BodySigner == nil {
+			return s.failed(ErrorEnvelopeContent)
+		}
+		err = s.signer.signBody(s.ctx, content.([]byte))
+		signed = content
+	default:
+		if s.signer.Signer != nil {
+			signed, err = s.signer.signEnvelope(content)
+			break
+		}
+		//iris对json.RawMessage压缩后按相同的转义及缩进重新编码, 输出的bytes与签名的body相同
+		var body []byte
+		if body, err = encodeJSON(content); err == nil {
+			if err = s.signer.signBody(s.ctx, body); err == nil {
+				signed = json.RawMessage(body)
+			}
+		}
+	}
+	if err != nil {
+		return s.failed(err)
+	}
+	return signed
+}
+
+// failed 使用未包装的Response输出系统错误
+func (s *signedResponse) failed(err error) interface{} {
+	s.ctx.Application().Logger().Errorf("response signature: %s", err)
+	s.ctx.StatusCode(http.StatusInternalServerError)
+	switch s.Response.ContentType() {
+	case "text":
+		return ""
+	case "binary":
+		return []byte{}
+	}
+	resp := s.next().Error(baseError.NewCode(s.ctx.ErrorCodes["System"], "response signature failed", baseError.WithSystem()))
+	if requestId := s.ctx.Values().GetString("requestId"); requestId != "" {
+		resp.SetRid(requestId)
+	}
+	return resp.Content()
+}
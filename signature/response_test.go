@@ -0,0 +1,78 @@
+package signature
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newResponseTestApp(t *testing.T, r *ResponseSigner, handler func(ctx *baseContext.Context)) *iris.Application {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	app.Get("/", r.Handler(), baseContext.Handler(handler))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestResponseBodySigner(t *testing.T) {
+	signer := NewBodySigner(NewHMAC(sha256.New, []byte("secret"), EncodingHex), "X-Signature")
+	r := NewResponseBodySigner(signer, WithResponseTimestamp("X-Timestamp", 0), WithResponseNonce("X-Nonce"))
+	data := map[string]interface{}{"html": "<a&b>", "list": []int{1, 2}}
+
+	for name, indent := range map[string]string{"compact": "", "indent": "  "} {
+		t.Run(name, func(t *testing.T) {
+			defer func(options context.JSON) { context.DefaultJSONOptions = options }(context.DefaultJSONOptions)
+			context.DefaultJSONOptions.Indent = indent
+
+			var calls int
+			app := newResponseTestApp(t, r, func(ctx *baseContext.Context) {
+				resp := ctx.NewSuccess("", data)
+				//多次调用Content只签名一次
+				first := resp.Content()
+				if string(first.(json.RawMessage)) != string(resp.Content().(json.RawMessage)) {
+					t.Error("Content() changed")
+				}
+				calls++
+				ctx.Success(resp)
+			})
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if calls != 1 || w.Code != 200 {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			for _, key := range []string{"X-Timestamp", "X-Nonce", "X-Signature"} {
+				if values := w.Header().Values(key); len(values) != 1 {
+					t.Errorf("%s = %v, want one value", key, values)
+				}
+			}
+			signed := strings.Join([]string{w.Header().Get("X-Timestamp"), w.Header().Get("X-Nonce"), w.Body.String()}, "\n")
+			if err := signer.VerifyRaw(w.Header(), []byte(signed)); err != nil {
+				t.Errorf("VerifyRaw(body %q) = %v", w.Body.String(), err)
+			}
+		})
+	}
+}
+
+func TestResponseBodySignerJSONOptions(t *testing.T) {
+	defer func(options context.JSON) { context.DefaultJSONOptions = options }(context.DefaultJSONOptions)
+	context.DefaultJSONOptions.ASCII = true
+
+	signer := NewBodySigner(NewHMAC(sha256.New, []byte("secret"), EncodingHex), "X-Signature")
+	app := newResponseTestApp(t, NewResponseBodySigner(signer), func(ctx *baseContext.Context) {
+		ctx.Success("中文")
+	})
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 500 || w.Header().Get("X-Signature") != "" {
+		t.Errorf("status = %d, signature = %q", w.Code, w.Header().Get("X-Signature"))
+	}
+}
@@ -0,0 +1,156 @@
+package signature
+
+import (
+	"encoding/base64"
+	stderrors "errors"
+	"strings"
+)
+
+// RFC 8941 Structured Field Values中Signature/Signature-Input/Content-Digest用到的部分
+
+var errorStructuredField = stderrors.New("invalid structured field")
+
+type member struct {
+	name  string
+	value string
+}
+
+// parseDictionary 保留每个成员的原始值
+func parseDictionary(s string) ([]member, error) {
+	var members []member
+	for _, item := range splitOutside(s, ',') {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			value = "?1"
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, errorStructuredField
+		}
+		members = append(members, member{name: name, value: strings.TrimSpace(value)})
+	}
+	if len(members) == 0 {
+		return nil, errorStructuredField
+	}
+	return members, nil
+}
+
+// parseByteSequence 解析":base64:", 忽略其后的参数
+func parseByteSequence(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, ":") {
+		return nil, errorStructuredField
+	}
+	end := strings.IndexByte(s[1:], ':')
+	if end == -1 {
+		return nil, errorStructuredField
+	}
+	return base64.StdEncoding.DecodeString(s[1 : end+1])
+}
+
+// parseItem 解析"\"name\";k=v;k2", 返回去掉引号的name和参数
+func parseItem(s string) (string, [][2]string, error) {
+	name, rest, err := parseString(strings.TrimSpace(s))
+	if err != nil {
+		return "", nil, err
+	}
+	var params [][2]string
+	for rest != "" {
+		if rest[0] != ';' {
+			return "", nil, errorStructuredField
+		}
+		rest = strings.TrimLeft(rest[1:], " ")
+		end := strings.IndexAny(rest, "=;")
+		if end == -1 {
+			end = len(rest)
+		}
+		key := rest[:end]
+		if key == "" {
+			return "", nil, errorStructuredField
+		}
+		rest = rest[end:]
+		value := ""
+		if strings.HasPrefix(rest, "=") {
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				if value, rest, err = parseString(rest); err != nil {
+					return "", nil, err
+				}
+			} else {
+				end := strings.IndexByte(rest, ';')
+				if end == -1 {
+					end = len(rest)
+				}
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params = append(params, [2]string{key, value})
+	}
+	return name, params, nil
+}
+
+// parseString 解析sf-string, 返回值和剩余部分
+func parseString(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", errorStructuredField
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", errorStructuredField
+			}
+			i++
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", errorStructuredField
+}
+
+// closingParen 返回与开头"("匹配的")"位置
+func closingParen(s string) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ')' && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitOutside 按sep拆分, 忽略引号和括号内的sep
+func splitOutside(s string, sep byte) []string {
+	var result []string
+	quoted, depth, start := false, 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+		case s[i] == sep && depth == 0:
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, s[start:])
+}
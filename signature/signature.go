@@ -1,14 +1,13 @@
 package signature
 
 import (
-	"encoding/json"
 	stderrors "errors"
 	"fmt"
+	baseError "github.com/go-estar/base-error"
 	"github.com/go-estar/iris/baseContext"
 	"github.com/kataras/iris/v12"
 	"github.com/thoas/go-funk"
 	"regexp"
-	"strconv"
 	"time"
 )
 
@@ -19,19 +18,50 @@ type Signer interface {
 type Option func(*Config)
 
 func defaultConfig() *Config {
-	return &Config{}
+	return &Config{
+		Clock:       time.Now,
+		MaxBodySize: 1 << 20,
+	}
 }
 func New(signer Signer, opts ...Option) *Signature {
 	if signer == nil {
 		panic("signer 必须设置")
 	}
+	rawSigner, _ := signer.(RawSigner)
+	s := newSignature(signer, rawSigner, opts...)
+	if s.BodyType == BodyTypeRaw {
+		if rawSigner == nil {
+			panic("BodyTypeRaw时signer必须实现RawSigner")
+		}
+		if _, ok := signer.(RawClientSigner); s.AppId != nil && !ok {
+			panic("设置appId时signer必须实现RawClientSigner")
+		}
+	} else if _, ok := signer.(ClientSigner); s.AppId != nil && !ok {
+		panic("设置appId时signer必须实现ClientSigner")
+	}
+	if s.AppId != nil {
+		checkFactory(signer)
+	}
+	return s
+}
+
+func newSignature(signer Signer, rawSigner RawSigner, opts ...Option) *Signature {
 	config := defaultConfig()
 	for _, apply := range opts {
 		apply(config)
 	}
+	if config.Nonce != nil && config.Timestamp == nil {
+		panic("nonce 必须同时设置timestamp")
+	}
+	if config.Nonce != nil {
+		if memory, ok := config.Nonce.Store.(*MemoryNonceStore); ok {
+			memory.Clock = config.Clock
+		}
+	}
 	return &Signature{
-		Signer: signer,
-		Config: config,
+		Signer:    signer,
+		RawSigner: rawSigner,
+		Config:    config,
 	}
 }
 
@@ -46,14 +76,64 @@ func WithTimestamp(timestamp *Timestamp) Option {
 		if timestamp.Property == "" {
 			timestamp.Property = "timestamp"
 		}
+		if timestamp.Skew == 0 && !timestamp.Strict {
+			timestamp.Skew = 10 * time.Second
+		}
 		opts.Timestamp = timestamp
 	}
 }
+
+// WithNonce 拒绝timestamp有效期内重复的nonce, 需同时设置WithTimestamp
+func WithNonce(nonce *Nonce) Option {
+	return func(opts *Config) {
+		if nonce == nil || nonce.Store == nil {
+			panic("nonce store 必须设置")
+		}
+		if nonce.Property == "" {
+			nonce.Property = "nonce"
+		}
+		opts.Nonce = nonce
+	}
+}
+
+// WithAppId 按appId查找调用方的key验签, 验签通过后调用方写入context
+func WithAppId(appId *AppId) Option {
+	return func(opts *Config) {
+		if appId == nil || appId.Store == nil {
+			panic("appId store 必须设置")
+		}
+		if appId.Property == "" && appId.Header == "" {
+			appId.Property = "appId"
+		}
+		opts.AppId = appId
+	}
+}
 func WithBodyType(bodyType BodyType) Option {
 	return func(opts *Config) {
 		opts.BodyType = bodyType
 	}
 }
+
+// WithClock 校验timestamp使用的时钟, 默认time.Now
+func WithClock(val func() time.Time) Option {
+	return func(opts *Config) {
+		opts.Clock = val
+	}
+}
+
+// WithMaxBodySize raw和query+JSON模式读取body的最大字节数, 默认1MB
+func WithMaxBodySize(val int64) Option {
+	return func(opts *Config) {
+		opts.MaxBodySize = val
+	}
+}
+
+// WithRawQuery query参数不做URL解码, 按原样参与签名
+func WithRawQuery(val bool) Option {
+	return func(opts *Config) {
+		opts.RawQuery = val
+	}
+}
 func WithPath(path string, level Level) Option {
 	return func(opts *Config) {
 		opts.Paths = append(opts.Paths, PathConfig{path, level})
@@ -96,22 +176,45 @@ const (
 	BodyTypeJSON BodyType = iota
 	BodyTypeForm
 	BodyTypeQuery
+	// BodyTypeRaw 对原始body验签, 见NewRaw
+	BodyTypeRaw
+	// BodyTypeQueryJSON query和JSON body合并验签, 同名参数视为错误
+	BodyTypeQueryJSON
+	// BodyTypeQueryForm query和form body合并验签, 同名参数视为错误
+	BodyTypeQueryForm
 )
 
+// Timestamp Unit为0时自动识别秒/毫秒, 也支持RFC3339; Skew为允许超前的时间, 默认10s
 type Timestamp struct {
 	Property string
 	Duration time.Duration
 	Unit     time.Duration
+	Skew     time.Duration
+	// Strict 不允许超前, 忽略Skew
+	Strict bool
+}
+
+func (t *Timestamp) skew() time.Duration {
+	if t.Strict {
+		return 0
+	}
+	return t.Skew
 }
 
 type Config struct {
-	BodyType  BodyType
-	Timestamp *Timestamp
-	Paths     []PathConfig
+	BodyType    BodyType
+	RawQuery    bool
+	Timestamp   *Timestamp
+	Nonce       *Nonce
+	AppId       *AppId
+	Paths       []PathConfig
+	Clock       func() time.Time
+	MaxBodySize int64
 }
 
 type Signature struct {
 	Signer
+	RawSigner RawSigner
 	*Config
 	pathLevel []PathLevel
 }
@@ -125,33 +228,29 @@ func (s *Signature) CheckPath(currPath string) Level {
 		return pathLevel.(PathLevel).Level
 	}
 
-	for _, path := range s.Paths {
+	level := MatchPath(s.Paths, currPath)
+	s.pathLevel = append(s.pathLevel, PathLevel{
+		Path:  currPath,
+		Level: level,
+	})
+	return level
+}
+
+// MatchPath 返回第一个匹配的规则的Level, 无匹配时为LevelVerify
+func MatchPath(paths []PathConfig, currPath string) Level {
+	for _, path := range paths {
 		switch v := (path.Name).(type) {
 		case string:
 			if v == currPath {
-				s.pathLevel = append(s.pathLevel, PathLevel{
-					Path:  currPath,
-					Level: path.Level,
-				})
 				return path.Level
 			}
 		case *regexp.Regexp:
 			if result := v.MatchString(currPath); result {
-				s.pathLevel = append(s.pathLevel, PathLevel{
-					Path:  currPath,
-					Level: path.Level,
-				})
 				return path.Level
 			}
 		}
 	}
-
-	var defaultLevel = LevelVerify
-	s.pathLevel = append(s.pathLevel, PathLevel{
-		Path:  currPath,
-		Level: defaultLevel,
-	})
-	return defaultLevel
+	return LevelVerify
 }
 
 func (s *Signature) Context(ctx *baseContext.Context) {
@@ -161,52 +260,207 @@ func (s *Signature) Context(ctx *baseContext.Context) {
 		return
 	}
 
-	var params map[string]interface{}
-	if s.Config.BodyType == BodyTypeJSON {
-		if err := ctx.ReadJSONUseNumber(&params); err != nil {
-			ctx.Error(err)
+	params, body, err := s.params(ctx)
+	if err != nil {
+		s.reject(ctx, err)
+		return
+	}
+
+	if s.Config.Timestamp != nil {
+		if err := s.checkTimestamp(ctx, params); err != nil {
+			s.reject(ctx, err)
 			return
 		}
-	} else if s.Config.BodyType == BodyTypeForm {
-		if err := ctx.ReadForm(&params); err != nil {
-			ctx.Error(err)
+	}
+
+	var client *Client
+	if s.Config.AppId != nil {
+		var err error
+		if client, err = s.client(ctx, params); err != nil {
+			s.reject(ctx, err)
 			return
 		}
 	}
+	if err := s.verify(ctx, client, params, body); err != nil {
+		s.reject(ctx, err)
+		return
+	}
 
-	if s.Config.Timestamp != nil {
-		timestamp := params[s.Config.Timestamp.Property]
-		var t int64
-		switch v := timestamp.(type) {
-		case string:
-			t, _ = strconv.ParseInt(v, 10, 64)
-		case json.Number:
-			t, _ = v.Int64()
-		case float64:
-			t = int64(v)
-		default:
-			ctx.Error(stderrors.New(fmt.Sprintf("missing %s", s.Config.Timestamp.Property)))
+	//验签通过后再记录nonce, 避免未签名的请求占用nonce
+	if s.Config.Nonce != nil {
+		nonce := FormatValue(params[s.Config.Nonce.Property])
+		if nonce == "" {
+			s.reject(ctx, baseError.NewCode(ctx.ErrorCodes["Replay"], fmt.Sprintf("missing %s", s.Config.Nonce.Property)))
 			return
 		}
-
-		tm := time.Unix(t/int64(time.Second/s.Config.Timestamp.Unit), 0)
-		if time.Until(tm) > 10*time.Second {
-			ctx.Error(stderrors.New(fmt.Sprintf("%s can't after now", s.Config.Timestamp.Property)))
+		if client != nil {
+			nonce = client.AppId + ":" + nonce
+		}
+		ok, err := s.Config.Nonce.Store.Use(ctx.RequestCtx(), nonce, s.Config.Timestamp.Duration+s.Config.Timestamp.skew())
+		if err != nil {
+			s.reject(ctx, baseError.NewSystemWrap(err))
 			return
 		}
-		if time.Since(tm) > s.Config.Timestamp.Duration {
-			ctx.Error(stderrors.New(fmt.Sprintf("%s expired (validity%s)", s.Config.Timestamp.Property, s.Config.Timestamp.Duration)))
+		if !ok {
+			s.reject(ctx, baseError.NewCode(ctx.ErrorCodes["Replay"], fmt.Sprintf("%s has been used", s.Config.Nonce.Property)))
 			return
 		}
 	}
-
-	if err := s.Signer.Verify(params); err != nil {
-		ctx.Error(err)
-		return
+	if client != nil {
+		SetClient(ctx, client)
 	}
 	ctx.Next()
 }
 
+// checkTimestamp 缺失/格式错误/超前/过期分别使用不同的错误码
+func (s *Signature) checkTimestamp(ctx *baseContext.Context, params map[string]interface{}) error {
+	property := s.Config.Timestamp.Property
+	tm, err := ParseTimestamp(params[property], s.Config.Timestamp.Unit)
+	if stderrors.Is(err, ErrorMissingTimestamp) {
+		return baseError.NewCode(ctx.ErrorCodes["TimestampMissing"], fmt.Sprintf("missing %s", property))
+	}
+	if err != nil {
+		return baseError.NewCode(ctx.ErrorCodes["TimestampMalformed"], fmt.Sprintf("malformed %s", property))
+	}
+	now := s.Config.Clock()
+	if tm.Sub(now) > s.Config.Timestamp.skew() {
+		return baseError.NewCode(ctx.ErrorCodes["TimestampFuture"], fmt.Sprintf("%s can't after now", property))
+	}
+	if now.Sub(tm) > s.Config.Timestamp.Duration {
+		return baseError.NewCode(ctx.ErrorCodes["TimestampExpired"], fmt.Sprintf("%s expired (validity%s)", property, s.Config.Timestamp.Duration))
+	}
+	return nil
+}
+
+// params 按BodyType读取参数, raw模式同时返回原始body
+func (s *Signature) params(ctx *baseContext.Context) (map[string]interface{}, []byte, error) {
+	var params map[string]interface{}
+	switch s.Config.BodyType {
+	case BodyTypeRaw:
+		body, err := ReadRawBody(ctx, s.Config.MaxBodySize)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rawParams(body), body, nil
+	case BodyTypeJSON:
+		if err := ctx.ReadJSONUseNumber(&params); err != nil {
+			return nil, nil, err
+		}
+		return params, nil, nil
+	case BodyTypeForm:
+		if err := ctx.ReadForm(&params); err != nil {
+			return nil, nil, err
+		}
+		return params, nil, nil
+	}
+
+	query, err := ParseQuery(ctx.Request().URL.RawQuery, s.Config.RawQuery)
+	if err != nil {
+		return nil, nil, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
+	}
+	switch s.Config.BodyType {
+	case BodyTypeQueryJSON:
+		body, err := ReadRawBody(ctx, s.Config.MaxBodySize)
+		if err != nil {
+			return nil, nil, err
+		}
+		if params, err = decodeJSONBody(body); err != nil {
+			return nil, nil, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
+		}
+	case BodyTypeQueryForm:
+		if err := ctx.Request().ParseForm(); err != nil {
+			return nil, nil, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
+		}
+		params = make(map[string]interface{}, len(ctx.Request().PostForm))
+		for key, values := range ctx.Request().PostForm {
+			if len(values) == 1 {
+				params[key] = values[0]
+			} else {
+				params[key] = values
+			}
+		}
+	default:
+		return query, nil, nil
+	}
+	if params, err = mergeParams(query, params); err != nil {
+		return nil, nil, baseError.NewCodeWrap(ctx.ErrorCodes["ReadParams"], err)
+	}
+	return params, nil, nil
+}
+
+// verify raw模式对body验签, 否则对参数验签
+func (s *Signature) verify(ctx *baseContext.Context, client *Client, params map[string]interface{}, body []byte) error {
+	if s.Config.BodyType == BodyTypeRaw {
+		if client != nil {
+			return s.RawSigner.(RawClientSigner).VerifyRawClient(client, ctx.Request().Header, body)
+		}
+		return s.RawSigner.VerifyRaw(ctx.Request().Header, body)
+	}
+	if client != nil {
+		return s.Signer.(ClientSigner).VerifyClient(client, params)
+	}
+	return s.Signer.Verify(params)
+}
+
+// client Header优先读取appId, 再从参数读取
+func (s *Signature) client(ctx *baseContext.Context, params map[string]interface{}) (*Client, error) {
+	var appId string
+	if s.Config.AppId.Header != "" {
+		appId = ctx.GetHeader(s.Config.AppId.Header)
+	}
+	if appId == "" && s.Config.AppId.Property != "" {
+		appId = FormatValue(params[s.Config.AppId.Property])
+	}
+	if appId == "" {
+		return nil, baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "missing appId")
+	}
+	client, err := s.Config.AppId.Store.Client(ctx.RequestCtx(), appId)
+	if stderrors.Is(err, ErrorClientNotFound) {
+		return nil, baseError.NewCodeWrap(ctx.ErrorCodes["Unauthorized"], err)
+	}
+	if err != nil {
+		return nil, baseError.NewSystemWrap(err)
+	}
+	if client.Disabled {
+		return nil, baseError.NewCode(ctx.ErrorCodes["Unauthorized"], "client disabled")
+	}
+	if client.AppId == "" {
+		copied := *client
+		copied.AppId = appId
+		client = &copied
+	}
+	return client, nil
+}
+
+func (s *Signature) reject(ctx *baseContext.Context, err error) {
+	ctx.SetRejected(baseContext.RejectedSignature)
+	ctx.Error(rejectError(ctx, err))
+}
+
+// rejectError 将验签返回的错误映射为对应的错误码, 避免按系统错误返回; 其他错误原样返回
+func rejectError(ctx *baseContext.Context, err error) error {
+	if baseError.IsBaseError(err) {
+		return err
+	}
+	var code string
+	switch {
+	case stderrors.Is(err, ErrorMissingTimestamp):
+		code = ctx.ErrorCodes["TimestampMissing"]
+	case stderrors.Is(err, ErrorMalformedTimestamp):
+		code = ctx.ErrorCodes["TimestampMalformed"]
+	case stderrors.Is(err, ErrorTimestampFuture):
+		code = ctx.ErrorCodes["TimestampFuture"]
+	case stderrors.Is(err, ErrorTimestampTolerance):
+		code = ctx.ErrorCodes["TimestampExpired"]
+	case stderrors.Is(err, ErrorMissingSign), stderrors.Is(err, ErrorInvalidSign),
+		stderrors.Is(err, ErrorClientNotFound):
+		code = ctx.ErrorCodes["Unauthorized"]
+	default:
+		return err
+	}
+	return baseError.NewCodeWrap(code, err)
+}
+
 func (s *Signature) Handler() iris.Handler {
 	return baseContext.Handler(s.Context)
 }
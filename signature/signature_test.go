@@ -0,0 +1,264 @@
+package signature
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func newTestApp(t *testing.T, s *Signature) *iris.Application {
+	t.Helper()
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	app := iris.New()
+	app.Post("/", s.Handler(), func(ctx iris.Context) {
+		ctx.WriteString("ok")
+	})
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// serve 返回响应的code, 验签通过时为"ok"
+func serve(app *iris.Application, params map[string]interface{}) string {
+	body, _ := json.Marshal(params)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(string(body))))
+	return responseCode(w)
+}
+
+// responseCode 返回响应的code, 通过时为"ok"
+func responseCode(w *httptest.ResponseRecorder) string {
+	if w.Body.String() == "ok" {
+		return "ok"
+	}
+	var resp struct {
+		Code string `json:"code"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Code
+}
+
+func signed(signer *ParamSigner, params map[string]interface{}) map[string]interface{} {
+	sign, _ := signer.Sign(params)
+	params["sign"] = sign
+	return params
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  time.Time
+		err   error
+	}{
+		{"1700000000", testNow, nil},
+		{"1700000000123", testNow.Add(123 * time.Millisecond), nil},
+		{json.Number("1700000000123456"), testNow.Add(123456 * time.Microsecond), nil},
+		{float64(1700000000), testNow, nil},
+		{"2023-11-14T22:13:20Z", testNow, nil},
+		{"2023-11-15T06:13:20+08:00", testNow, nil},
+		{nil, time.Time{}, ErrorMissingTimestamp},
+		{"", time.Time{}, ErrorMissingTimestamp},
+		{"abc", time.Time{}, ErrorMalformedTimestamp},
+		{"-5", time.Time{}, ErrorMalformedTimestamp},
+		{1.5, time.Time{}, ErrorMalformedTimestamp},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.value, 0)
+		if err != tt.err {
+			t.Errorf("ParseTimestamp(%v) error = %v, want %v", tt.value, err, tt.err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTimestamp(%v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTimestampCheck(t *testing.T) {
+	signer := NewHMACSHA256Signer("secret")
+	app := newTestApp(t, New(signer,
+		WithTimestamp(&Timestamp{Duration: time.Minute}),
+		WithClock(func() time.Time { return testNow }),
+	))
+	ts := func(d time.Duration) string {
+		return strconv.FormatInt(testNow.Add(d).Unix(), 10)
+	}
+	tests := []struct {
+		name      string
+		timestamp interface{}
+		want      string
+	}{
+		{"valid", ts(0), "ok"},
+		{"withinSkew", ts(5 * time.Second), "ok"},
+		{"missing", nil, baseContext.ErrorTimestampMissing},
+		{"malformed", "abc", baseContext.ErrorTimestampMalformed},
+		{"future", ts(time.Minute), baseContext.ErrorTimestampFuture},
+		{"expired", ts(-2 * time.Minute), baseContext.ErrorTimestampExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]interface{}{"a": "1"}
+			if tt.timestamp != nil {
+				params["timestamp"] = tt.timestamp
+			}
+			if got := serve(app, signed(signer, params)); got != tt.want {
+				t.Errorf("code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampStrict(t *testing.T) {
+	signer := NewHMACSHA256Signer("secret")
+	app := newTestApp(t, New(signer,
+		WithTimestamp(&Timestamp{Duration: time.Minute, Strict: true}),
+		WithClock(func() time.Time { return testNow }),
+	))
+	params := map[string]interface{}{"timestamp": strconv.FormatInt(testNow.Add(time.Second).Unix(), 10)}
+	if got := serve(app, signed(signer, params)); got != baseContext.ErrorTimestampFuture {
+		t.Errorf("code = %s, want %s", got, baseContext.ErrorTimestampFuture)
+	}
+}
+
+func TestNonceReplay(t *testing.T) {
+	signer := NewHMACSHA256Signer("secret")
+	app := newTestApp(t, New(signer,
+		WithTimestamp(&Timestamp{Duration: time.Minute}),
+		WithNonce(&Nonce{Store: NewMemoryNonceStore(10)}),
+		WithClock(func() time.Time { return testNow }),
+	))
+	request := func(nonce string) map[string]interface{} {
+		return signed(signer, map[string]interface{}{
+			"timestamp": strconv.FormatInt(testNow.Unix(), 10),
+			"nonce":     nonce,
+		})
+	}
+	if got := serve(app, request("n1")); got != "ok" {
+		t.Fatalf("first request code = %s", got)
+	}
+	if got := serve(app, request("n1")); got != baseContext.ErrorReplay {
+		t.Errorf("replay code = %s, want %s", got, baseContext.ErrorReplay)
+	}
+	if got := serve(app, request("n2")); got != "ok" {
+		t.Errorf("new nonce code = %s", got)
+	}
+	//未通过验签的请求不占用nonce
+	unsigned := request("n3")
+	unsigned["sign"] = "bad"
+	serve(app, unsigned)
+	if got := serve(app, request("n3")); got != "ok" {
+		t.Errorf("nonce after bad sign code = %s", got)
+	}
+	if got := serve(app, request("")); got != baseContext.ErrorReplay {
+		t.Errorf("missing nonce code = %s, want %s", got, baseContext.ErrorReplay)
+	}
+}
+
+func TestMemoryNonceStoreTTL(t *testing.T) {
+	now := testNow
+	store := NewMemoryNonceStore(10)
+	store.Clock = func() time.Time { return now }
+	ctx := context.Background()
+	use := func(nonce string) bool {
+		ok, err := store.Use(ctx, nonce, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if !use("n1") {
+		t.Fatal("first use rejected")
+	}
+	now = testNow.Add(59 * time.Second)
+	if use("n1") {
+		t.Error("reuse within ttl accepted")
+	}
+	//重复使用不延长有效期
+	now = testNow.Add(time.Minute)
+	if !use("n1") {
+		t.Error("reuse after ttl rejected")
+	}
+	//写入时清理过期的nonce
+	use("n2")
+	now = testNow.Add(3 * time.Minute)
+	use("n3")
+	if _, ok := store.items["n2"]; ok || len(store.items) != 1 || store.order.Len() != 1 {
+		t.Errorf("items = %v, want only n3", store.items)
+	}
+}
+
+func TestMemoryNonceStoreEviction(t *testing.T) {
+	now := testNow
+	store := NewMemoryNonceStore(2)
+	store.Clock = func() time.Time { return now }
+	ctx := context.Background()
+	use := func(nonce string) bool {
+		ok, err := store.Use(ctx, nonce, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	for _, nonce := range []string{"n1", "n2", "n3"} {
+		if !use(nonce) {
+			t.Fatalf("%s rejected", nonce)
+		}
+	}
+	if len(store.items) != 2 || store.order.Len() != 2 {
+		t.Fatalf("items = %d, want 2", len(store.items))
+	}
+	//超过size时淘汰最早写入的nonce, 未过期也可被重放
+	if use("n3") || use("n2") {
+		t.Error("recent nonce accepted")
+	}
+	if !use("n1") {
+		t.Error("evicted nonce rejected")
+	}
+	//n1写入时淘汰了n2
+	if _, ok := store.items["n2"]; ok {
+		t.Error("n2 not evicted")
+	}
+}
+
+func TestNonceSharesClock(t *testing.T) {
+	now := testNow
+	store := NewMemoryNonceStore(10)
+	New(NewHMACSHA256Signer("secret"),
+		WithTimestamp(&Timestamp{Duration: time.Minute}),
+		WithNonce(&Nonce{Store: store}),
+		WithClock(func() time.Time { return now }),
+	)
+	if got := store.Clock(); !got.Equal(testNow) {
+		t.Errorf("store clock = %v, want %v", got, testNow)
+	}
+}
+
+func TestRawBodyLimit(t *testing.T) {
+	signer := NewBodySigner(NewHMAC(sha256.New, []byte("secret"), EncodingHex), "X-Sign")
+	app := newTestApp(t, NewRaw(signer, WithMaxBodySize(16)))
+	request := func(body string) string {
+		sign, _ := signer.Sign([]byte(body))
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("X-Sign", sign)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		return responseCode(w)
+	}
+	if got := request(`{"a":"1"}`); got != "ok" {
+		t.Errorf("code = %s, want ok", got)
+	}
+	if got := request(`{"a":"` + strings.Repeat("x", 32) + `"}`); got != baseContext.ErrorReadParams {
+		t.Errorf("code = %s, want %s", got, baseContext.ErrorReadParams)
+	}
+}
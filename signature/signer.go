@@ -0,0 +1,342 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/sm3"
+	"hash"
+	"strings"
+)
+
+var (
+	ErrorMissingSign  = stderrors.New("missing sign")
+	ErrorInvalidSign  = stderrors.New("invalid sign")
+	ErrorNoPrivateKey = stderrors.New("private key not set")
+	ErrorNoSecret     = stderrors.New("secret not set")
+)
+
+// Encoding 签名的文本编码
+type Encoding int
+
+const (
+	EncodingHex Encoding = iota
+	EncodingHexUpper
+	EncodingBase64
+)
+
+func (e Encoding) encode(b []byte) string {
+	switch e {
+	case EncodingHexUpper:
+		return strings.ToUpper(hex.EncodeToString(b))
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+// decode hex不区分大小写, base64兼容URL编码和无padding
+func (e Encoding) decode(s string) ([]byte, error) {
+	if e == EncodingBase64 {
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+			if b, err := enc.DecodeString(s); err == nil {
+				return b, nil
+			}
+		}
+		return nil, ErrorInvalidSign
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrorInvalidSign
+	}
+	return b, nil
+}
+
+// Algorithm 对待签名字符串签名/验签
+type Algorithm interface {
+	Sign(data []byte) (string, error)
+	Verify(data []byte, sign string) error
+}
+
+// Digest MD5等摘要算法, secret由Canonical拼接
+type Digest struct {
+	Hash     func() hash.Hash
+	Encoding Encoding
+}
+
+func NewDigest(h func() hash.Hash, encoding Encoding) *Digest {
+	return &Digest{Hash: h, Encoding: encoding}
+}
+
+func (d *Digest) sum(data []byte) []byte {
+	h := d.Hash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (d *Digest) Sign(data []byte) (string, error) {
+	return d.Encoding.encode(d.sum(data)), nil
+}
+
+func (d *Digest) Verify(data []byte, sign string) error {
+	b, err := d.Encoding.decode(sign)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(b, d.sum(data)) != 1 {
+		return ErrorInvalidSign
+	}
+	return nil
+}
+
+type HMAC struct {
+	Hash     func() hash.Hash
+	Key      []byte
+	Encoding Encoding
+}
+
+func NewHMAC(h func() hash.Hash, key []byte, encoding Encoding) *HMAC {
+	if len(key) == 0 {
+		panic("key 必须设置")
+	}
+	return &HMAC{Hash: h, Key: key, Encoding: encoding}
+}
+
+func (m *HMAC) sum(data []byte) []byte {
+	mac := hmac.New(m.Hash, m.Key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (m *HMAC) Sign(data []byte) (string, error) {
+	return m.Encoding.encode(m.sum(data)), nil
+}
+
+func (m *HMAC) Verify(data []byte, sign string) error {
+	b, err := m.Encoding.decode(sign)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(b, m.sum(data)) {
+		return ErrorInvalidSign
+	}
+	return nil
+}
+
+// RSA RSASSA-PKCS1-v1_5, 只验签时PrivateKey可为空
+type RSA struct {
+	Hash       crypto.Hash
+	PublicKey  *rsa.PublicKey
+	PrivateKey *rsa.PrivateKey
+	Encoding   Encoding
+}
+
+func NewRSA(h crypto.Hash, publicKey *rsa.PublicKey, privateKey *rsa.PrivateKey) *RSA {
+	if publicKey == nil && privateKey != nil {
+		publicKey = &privateKey.PublicKey
+	}
+	if publicKey == nil {
+		panic("publicKey 必须设置")
+	}
+	return &RSA{Hash: h, PublicKey: publicKey, PrivateKey: privateKey, Encoding: EncodingBase64}
+}
+
+func (r *RSA) digest(data []byte) []byte {
+	h := r.Hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (r *RSA) Sign(data []byte) (string, error) {
+	if r.PrivateKey == nil {
+		return "", ErrorNoPrivateKey
+	}
+	b, err := rsa.SignPKCS1v15(rand.Reader, r.PrivateKey, r.Hash, r.digest(data))
+	if err != nil {
+		return "", err
+	}
+	return r.Encoding.encode(b), nil
+}
+
+func (r *RSA) Verify(data []byte, sign string) error {
+	b, err := r.Encoding.decode(sign)
+	if err != nil {
+		return err
+	}
+	if err := rsa.VerifyPKCS1v15(r.PublicKey, r.Hash, r.digest(data), b); err != nil {
+		return ErrorInvalidSign
+	}
+	return nil
+}
+
+// SM2 SM2签名(SM3摘要, 含Z值), UID为空时使用默认值1234567812345678
+type SM2 struct {
+	PublicKey  *ecdsa.PublicKey
+	PrivateKey *sm2.PrivateKey
+	UID        []byte
+	Encoding   Encoding
+}
+
+func NewSM2(publicKey *ecdsa.PublicKey, privateKey *sm2.PrivateKey) *SM2 {
+	if publicKey == nil && privateKey != nil {
+		publicKey = &privateKey.PublicKey
+	}
+	if publicKey == nil {
+		panic("publicKey 必须设置")
+	}
+	return &SM2{PublicKey: publicKey, PrivateKey: privateKey, Encoding: EncodingBase64}
+}
+
+func (s *SM2) Sign(data []byte) (string, error) {
+	if s.PrivateKey == nil {
+		return "", ErrorNoPrivateKey
+	}
+	b, err := s.PrivateKey.Sign(rand.Reader, data, sm2.NewSM2SignerOption(true, s.UID))
+	if err != nil {
+		return "", err
+	}
+	return s.Encoding.encode(b), nil
+}
+
+func (s *SM2) Verify(data []byte, sign string) error {
+	b, err := s.Encoding.decode(sign)
+	if err != nil {
+		return err
+	}
+	if !sm2.VerifyASN1WithSM2(s.PublicKey, s.UID, data, b) {
+		return ErrorInvalidSign
+	}
+	return nil
+}
+
+// ParamSigner 实现Signer: 参数经Canonical生成待签名字符串后由Algorithm验签
+type ParamSigner struct {
+	Algorithm Algorithm
+	// Factory 按调用方生成Algorithm, 见NewClientSigner
+	Factory   AlgorithmFactory
+	Canonical *Canonical
+	// Secret 由Canonical追加到待签名字符串, 见WithSecretKey/WithSecretSuffix
+	Secret string
+}
+
+// NewSigner Digest不含密钥, 需使用NewDigestSigner或设置WithSecretKey/WithSecretSuffix后再设置Secret
+func NewSigner(algorithm Algorithm, opts ...CanonicalOption) *ParamSigner {
+	if algorithm == nil {
+		panic("algorithm 必须设置")
+	}
+	canonical := NewCanonical(opts...)
+	if _, ok := algorithm.(*Digest); ok && !canonical.keyed() {
+		panic("Digest 必须设置WithSecretKey或WithSecretSuffix")
+	}
+	return &ParamSigner{
+		Algorithm: algorithm,
+		Canonical: canonical,
+	}
+}
+
+// NewDigestSigner 摘要签名, secret默认以"&key=secret"追加, 可用WithSecretKey/WithSecretSuffix覆盖
+func NewDigestSigner(algorithm *Digest, secret string, opts ...CanonicalOption) *ParamSigner {
+	if secret == "" {
+		panic("secret 必须设置")
+	}
+	s := NewSigner(algorithm, append([]CanonicalOption{WithSecretKey("key")}, opts...)...)
+	s.Secret = secret
+	return s
+}
+
+// NewHMACSHA256Signer 输出小写hex
+func NewHMACSHA256Signer(secret string, opts ...CanonicalOption) *ParamSigner {
+	return NewSigner(NewHMAC(sha256.New, []byte(secret), EncodingHex), opts...)
+}
+
+func NewHMACSHA512Signer(secret string, opts ...CanonicalOption) *ParamSigner {
+	return NewSigner(NewHMAC(sha512.New, []byte(secret), EncodingHex), opts...)
+}
+
+// NewMD5Signer 旧接口常用格式: MD5(a=1&b=2&key=secret)转大写
+func NewMD5Signer(secret string, opts ...CanonicalOption) *ParamSigner {
+	return NewDigestSigner(NewDigest(md5.New, EncodingHexUpper), secret, opts...)
+}
+
+// NewRSASHA256Signer 输出base64, privateKey用于Sign, 只验签时传nil
+func NewRSASHA256Signer(publicKey *rsa.PublicKey, privateKey *rsa.PrivateKey, opts ...CanonicalOption) *ParamSigner {
+	return NewSigner(NewRSA(crypto.SHA256, publicKey, privateKey), opts...)
+}
+
+// NewSM2SM3Signer 输出base64, privateKey用于Sign, 只验签时传nil
+func NewSM2SM3Signer(publicKey *ecdsa.PublicKey, privateKey *sm2.PrivateKey, opts ...CanonicalOption) *ParamSigner {
+	return NewSigner(NewSM2(publicKey, privateKey), opts...)
+}
+
+// NewSM3Signer 旧接口的SM3摘要签名, 格式同NewMD5Signer
+func NewSM3Signer(secret string, opts ...CanonicalOption) *ParamSigner {
+	return NewDigestSigner(NewDigest(sm3.New, EncodingHexUpper), secret, opts...)
+}
+
+func (s *ParamSigner) Verify(params map[string]interface{}) error {
+	return s.VerifyClient(nil, params)
+}
+
+// Sign 返回params的签名, 不修改params
+func (s *ParamSigner) Sign(params map[string]interface{}) (string, error) {
+	return s.SignClient(nil, params)
+}
+
+// algorithm client为nil时使用固定的Algorithm和Secret, 否则只使用调用方的key
+func (s *ParamSigner) algorithm(client *Client) (Algorithm, string, error) {
+	if client == nil {
+		if s.Algorithm == nil {
+			return nil, "", ErrorClientNotFound
+		}
+		if _, ok := s.Algorithm.(*Digest); ok && s.Secret == "" {
+			return nil, "", ErrorNoSecret
+		}
+		return s.Algorithm, s.Secret, nil
+	}
+	if s.Factory == nil {
+		return nil, "", ErrorClientKey
+	}
+	algorithm, err := s.Factory(client)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, ok := algorithm.(*Digest); ok && (client.Secret == "" || !s.Canonical.keyed()) {
+		return nil, "", ErrorClientKey
+	}
+	return algorithm, client.Secret, nil
+}
+
+func (s *ParamSigner) VerifyClient(client *Client, params map[string]interface{}) error {
+	sign, ok := params[s.Canonical.SignProperty].(string)
+	if !ok || sign == "" {
+		return ErrorMissingSign
+	}
+	algorithm, secret, err := s.algorithm(client)
+	if err != nil {
+		return err
+	}
+	return algorithm.Verify([]byte(s.Canonical.Build(params, secret)), sign)
+}
+
+func (s *ParamSigner) SignClient(client *Client, params map[string]interface{}) (string, error) {
+	algorithm, secret, err := s.algorithm(client)
+	if err != nil {
+		return "", err
+	}
+	sign, err := algorithm.Sign([]byte(s.Canonical.Build(params, secret)))
+	if err != nil {
+		return "", fmt.Errorf("sign: %w", err)
+	}
+	return sign, nil
+}
@@ -0,0 +1,194 @@
+package signature
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/sm3"
+	"testing"
+)
+
+func TestCanonicalBuild(t *testing.T) {
+	params := map[string]interface{}{
+		"b":    "2",
+		"a":    "1",
+		"c":    "",
+		"sign": "ignored",
+		"n":    json.Number("1.50"),
+		"o":    map[string]interface{}{"y": json.Number("1"), "x": "q"},
+	}
+	tests := []struct {
+		name string
+		opts []CanonicalOption
+		want string
+	}{
+		{"default", nil, `a=1&b=2&n=1.50&o={"x":"q","y":1}`},
+		{"includeEmpty", []CanonicalOption{WithIncludeEmpty(true)}, `a=1&b=2&c=&n=1.50&o={"x":"q","y":1}`},
+		{"flatten", []CanonicalOption{WithFlatten(true)}, `a=1&b=2&n=1.50&o.x=q&o.y=1`},
+		{"exclude", []CanonicalOption{WithExclude("o", "n")}, `a=1&b=2`},
+		{"secretKey", []CanonicalOption{WithExclude("o", "n"), WithSecretKey("key")}, `a=1&b=2&key=secret`},
+		{"secretSuffix", []CanonicalOption{WithExclude("o", "n"), WithSecretSuffix(true)}, `a=1&b=2secret`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewCanonical(tt.opts...).Build(params, "secret"); got != tt.want {
+				t.Errorf("Build() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalRepeat(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		opts   []CanonicalOption
+		want   string
+	}{
+		{"pairs", map[string]interface{}{"a": []string{"2", "1"}}, nil, `a=1&a=2`},
+		{"pairsComma", map[string]interface{}{"a": []string{"1,2"}}, nil, `a=1,2`},
+		{"join", map[string]interface{}{"a": []string{"2", "1"}}, []CanonicalOption{WithRepeat(RepeatJoin)}, `a=2,1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewCanonical(tt.opts...).Build(tt.params, ""); got != tt.want {
+				t.Errorf("Build() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestKnownAnswer(t *testing.T) {
+	sign, err := NewDigest(sm3.New, EncodingHex).Sign([]byte("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0"; sign != want {
+		t.Errorf("SM3 = %s, want %s", sign, want)
+	}
+}
+
+func TestHMACKnownAnswer(t *testing.T) {
+	// RFC 4231 test case 2
+	sign, err := NewHMAC(sha256.New, []byte("Jefe"), EncodingHex).Sign([]byte("what do ya want for nothing?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"; sign != want {
+		t.Errorf("HMAC-SHA256 = %s, want %s", sign, want)
+	}
+}
+
+func TestParamSignerKnownAnswer(t *testing.T) {
+	params := map[string]interface{}{"b": "2", "a": "1"}
+	tests := []struct {
+		name   string
+		signer *ParamSigner
+		want   string
+	}{
+		{"md5", NewMD5Signer("secret"), "9F565CCD686CFA5DC3B06B3A89E4E3AD"},
+		{"hmac", NewHMACSHA256Signer("secret"), "604fe97c66c6393ff22e3cae366eee1131e351ebc736bf12f5d62e1755b7a233"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sign, err := tt.signer.Sign(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sign != tt.want {
+				t.Errorf("Sign() = %s, want %s", sign, tt.want)
+			}
+			if err := tt.signer.Verify(map[string]interface{}{"a": "1", "b": "2", "sign": tt.want}); err != nil {
+				t.Errorf("Verify() = %v", err)
+			}
+			if err := tt.signer.Verify(map[string]interface{}{"a": "1", "b": "3", "sign": tt.want}); err != ErrorInvalidSign {
+				t.Errorf("Verify(tampered) = %v, want %v", err, ErrorInvalidSign)
+			}
+			if err := tt.signer.Verify(params); err != ErrorMissingSign {
+				t.Errorf("Verify(unsigned) = %v, want %v", err, ErrorMissingSign)
+			}
+		})
+	}
+}
+
+func TestEmptySecretPanics(t *testing.T) {
+	for name, f := range map[string]func(){
+		"md5":    func() { NewMD5Signer("") },
+		"sm3":    func() { NewSM3Signer("") },
+		"hmac":   func() { NewHMACSHA256Signer("") },
+		"digest": func() { NewDigestSigner(NewDigest(md5.New, EncodingHex), "") },
+		//Digest不含密钥, 未设置WithSecretKey/WithSecretSuffix时拒绝
+		"unkeyed": func() { NewSigner(NewDigest(md5.New, EncodingHex)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			f()
+		})
+	}
+}
+
+func TestDigestSignerSecret(t *testing.T) {
+	params := map[string]interface{}{"b": "2", "a": "1"}
+	sign, err := NewDigestSigner(NewDigest(md5.New, EncodingHexUpper), "secret").Sign(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "9F565CCD686CFA5DC3B06B3A89E4E3AD"; sign != want {
+		t.Errorf("Sign() = %s, want %s", sign, want)
+	}
+
+	//设置了WithSecretKey但未设置Secret时不以空密钥签名
+	s := NewSigner(NewDigest(md5.New, EncodingHexUpper), WithSecretKey("key"))
+	if _, err := s.Sign(params); err != ErrorNoSecret {
+		t.Errorf("Sign() = %v, want %v", err, ErrorNoSecret)
+	}
+	if err := s.Verify(map[string]interface{}{"a": "1", "b": "2", "sign": sign}); err != ErrorNoSecret {
+		t.Errorf("Verify() = %v, want %v", err, ErrorNoSecret)
+	}
+}
+
+func TestAsymmetricSigners(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm2Key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		signer *ParamSigner
+		verify *ParamSigner
+	}{
+		{"rsa", NewRSASHA256Signer(nil, rsaKey), NewRSASHA256Signer(&rsaKey.PublicKey, nil)},
+		{"sm2", NewSM2SM3Signer(nil, sm2Key), NewSM2SM3Signer(&sm2Key.PublicKey, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]interface{}{"a": "1", "b": "2"}
+			sign, err := tt.signer.Sign(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params["sign"] = sign
+			if err := tt.verify.Verify(params); err != nil {
+				t.Errorf("Verify() = %v", err)
+			}
+			params["b"] = "3"
+			if err := tt.verify.Verify(params); err != ErrorInvalidSign {
+				t.Errorf("Verify(tampered) = %v, want %v", err, ErrorInvalidSign)
+			}
+			if _, err := tt.verify.Sign(params); err == nil {
+				t.Error("Sign() without private key should fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package signature
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorMissingTimestamp   = stderrors.New("missing timestamp")
+	ErrorMalformedTimestamp = stderrors.New("malformed timestamp")
+)
+
+// ParseTimestamp 支持数字和RFC3339, unit为0时按位数识别秒/毫秒/微秒/纳秒
+func ParseTimestamp(value interface{}, unit time.Duration) (time.Time, error) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, ErrorMissingTimestamp
+	case string:
+		s = strings.TrimSpace(v)
+	case json.Number:
+		s = v.String()
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) || v != math.Trunc(v) {
+			return time.Time{}, ErrorMalformedTimestamp
+		}
+		s = strconv.FormatFloat(v, 'f', 0, 64)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case int:
+		s = strconv.Itoa(v)
+	default:
+		return time.Time{}, ErrorMalformedTimestamp
+	}
+	if s == "" {
+		return time.Time{}, ErrorMissingTimestamp
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return time.Time{}, ErrorMalformedTimestamp
+		}
+		return t, nil
+	}
+	if n <= 0 {
+		return time.Time{}, ErrorMalformedTimestamp
+	}
+	if unit == 0 {
+		unit = detectUnit(n)
+	}
+	if n > math.MaxInt64/int64(unit) {
+		return time.Time{}, ErrorMalformedTimestamp
+	}
+	return time.Unix(0, n*int64(unit)), nil
+}
+
+// detectUnit 按数量级识别单位, 秒级时间戳在5138年前小于1e11, 毫秒级在1973年后不小于1e11
+func detectUnit(n int64) time.Duration {
+	switch {
+	case n >= 1e17:
+		return time.Nanosecond
+	case n >= 1e14:
+		return time.Microsecond
+	case n >= 1e11:
+		return time.Millisecond
+	default:
+		return time.Second
+	}
+}
@@ -0,0 +1,247 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorTimestampTolerance = stderrors.New("timestamp outside tolerance")
+	ErrorTimestampExpired   = fmt.Errorf("%w: expired", ErrorTimestampTolerance)
+	ErrorTimestampFuture    = fmt.Errorf("%w: in the future", ErrorTimestampTolerance)
+)
+
+type WebhookOption func(*WebhookConfig)
+
+func defaultWebhookConfig() *WebhookConfig {
+	return &WebhookConfig{
+		Tolerance: 5 * time.Minute,
+		Separator: ".",
+		Clock:     time.Now,
+	}
+}
+
+// WithWebhookTolerance timestamp与当前时间允许的偏差, 默认5分钟
+func WithWebhookTolerance(val time.Duration) WebhookOption {
+	return func(opts *WebhookConfig) {
+		if val <= 0 {
+			panic("tolerance 必须大于0")
+		}
+		opts.Tolerance = val
+	}
+}
+
+// WithWebhookSkipTolerance 只校验timestamp格式不校验偏差, 用于重放测试数据, 生产环境不应开启
+func WithWebhookSkipTolerance(val bool) WebhookOption {
+	return func(opts *WebhookConfig) {
+		opts.SkipTolerance = val
+	}
+}
+
+// WithWebhookPrefix 签名值的前缀, 如"sha256="
+func WithWebhookPrefix(val string) WebhookOption {
+	return func(opts *WebhookConfig) {
+		opts.Prefix = val
+	}
+}
+
+// WithWebhookTimestampHeader 从header读取timestamp, 待签名数据为 timestamp+Separator+body
+func WithWebhookTimestampHeader(val string) WebhookOption {
+	return func(opts *WebhookConfig) {
+		opts.TimestampHeader = val
+	}
+}
+func WithWebhookSeparator(val string) WebhookOption {
+	return func(opts *WebhookConfig) {
+		opts.Separator = val
+	}
+}
+func WithWebhookClock(val func() time.Time) WebhookOption {
+	return func(opts *WebhookConfig) {
+		opts.Clock = val
+	}
+}
+
+type WebhookConfig struct {
+	Tolerance       time.Duration
+	SkipTolerance   bool
+	Prefix          string
+	TimestampHeader string
+	Separator       string
+	Clock           func() time.Time
+}
+
+// checkTolerance 超前和过期使用同一个偏差, 返回的错误都满足errors.Is(err, ErrorTimestampTolerance)
+func (c *WebhookConfig) checkTolerance(timestamp string) error {
+	tm, err := ParseTimestamp(timestamp, 0)
+	if err != nil {
+		return err
+	}
+	if c.SkipTolerance {
+		return nil
+	}
+	d := c.Clock().Sub(tm)
+	if d > c.Tolerance {
+		return ErrorTimestampExpired
+	}
+	if -d > c.Tolerance {
+		return ErrorTimestampFuture
+	}
+	return nil
+}
+
+// verifyAny 任一key和任一签名匹配即通过, 用于轮换期间多个key同时有效
+func verifyAny(algorithms []Algorithm, data []byte, signs []string) error {
+	for _, sign := range signs {
+		for _, algorithm := range algorithms {
+			if algorithm.Verify(data, sign) == nil {
+				return nil
+			}
+		}
+	}
+	return ErrorInvalidSign
+}
+
+// HeaderWebhook 签名在header中, 待签名数据为原始body, 设置TimestampHeader时带上timestamp
+// 未设置TimestampHeader时(如GitHub/Shopify)签名不含时间, 截获的请求可被无限重放;
+// 需要防重放时按发送方的投递id(如X-GitHub-Delivery/X-Shopify-Webhook-Id)在业务中去重
+type HeaderWebhook struct {
+	Header     string
+	Algorithms []Algorithm
+	*WebhookConfig
+}
+
+func NewHeaderWebhook(header string, algorithms []Algorithm, opts ...WebhookOption) *HeaderWebhook {
+	if header == "" {
+		panic("header 必须设置")
+	}
+	if len(algorithms) == 0 {
+		panic("algorithms 必须设置")
+	}
+	config := defaultWebhookConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	return &HeaderWebhook{
+		Header:        header,
+		Algorithms:    algorithms,
+		WebhookConfig: config,
+	}
+}
+
+// NewHMACWebhook HMAC-SHA256, 如Shopify(base64)或GitHub(hex, 前缀sha256=)
+func NewHMACWebhook(header string, encoding Encoding, secrets []string, opts ...WebhookOption) *HeaderWebhook {
+	algorithms := make([]Algorithm, 0, len(secrets))
+	for _, secret := range secrets {
+		algorithms = append(algorithms, NewHMAC(sha256.New, []byte(secret), encoding))
+	}
+	return NewHeaderWebhook(header, algorithms, opts...)
+}
+
+// NewRSAWebhook RSASSA-PKCS1-v1_5, 签名为base64
+func NewRSAWebhook(header string, h crypto.Hash, publicKeys []*rsa.PublicKey, opts ...WebhookOption) *HeaderWebhook {
+	algorithms := make([]Algorithm, 0, len(publicKeys))
+	for _, key := range publicKeys {
+		algorithms = append(algorithms, NewRSA(h, key, nil))
+	}
+	return NewHeaderWebhook(header, algorithms, opts...)
+}
+
+func (w *HeaderWebhook) VerifyRaw(header http.Header, body []byte) error {
+	sign := strings.TrimSpace(header.Get(w.Header))
+	if sign == "" {
+		return ErrorMissingSign
+	}
+	if w.Prefix != "" {
+		if !strings.HasPrefix(sign, w.Prefix) {
+			return ErrorInvalidSign
+		}
+		sign = strings.TrimPrefix(sign, w.Prefix)
+	}
+	data := body
+	if w.TimestampHeader != "" {
+		timestamp := strings.TrimSpace(header.Get(w.TimestampHeader))
+		if err := w.checkTolerance(timestamp); err != nil {
+			return err
+		}
+		data = append([]byte(timestamp+w.Separator), body...)
+	}
+	return verifyAny(w.Algorithms, data, []string{sign})
+}
+
+// TimestampedWebhook header格式 t=timestamp,v1=sign[,v1=sign], 待签名数据为 timestamp.body
+// 如Stripe, 发送方轮换secret时可同时带多个v1
+type TimestampedWebhook struct {
+	Header       string
+	TimestampKey string
+	SignKey      string
+	Algorithms   []Algorithm
+	*WebhookConfig
+}
+
+// NewTimestampedHMACWebhook HMAC-SHA256 hex, secrets为当前有效的所有secret
+func NewTimestampedHMACWebhook(header string, secrets []string, opts ...WebhookOption) *TimestampedWebhook {
+	if header == "" {
+		panic("header 必须设置")
+	}
+	if len(secrets) == 0 {
+		panic("secrets 必须设置")
+	}
+	config := defaultWebhookConfig()
+	for _, apply := range opts {
+		apply(config)
+	}
+	algorithms := make([]Algorithm, 0, len(secrets))
+	for _, secret := range secrets {
+		algorithms = append(algorithms, NewHMAC(sha256.New, []byte(secret), EncodingHex))
+	}
+	return &TimestampedWebhook{
+		Header:        header,
+		TimestampKey:  "t",
+		SignKey:       "v1",
+		Algorithms:    algorithms,
+		WebhookConfig: config,
+	}
+}
+
+func (w *TimestampedWebhook) VerifyRaw(header http.Header, body []byte) error {
+	value := header.Get(w.Header)
+	if strings.TrimSpace(value) == "" {
+		return ErrorMissingSign
+	}
+	var timestamp string
+	var signs []string
+	for _, part := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case w.TimestampKey:
+			timestamp = val
+		case w.SignKey:
+			signs = append(signs, val)
+		}
+	}
+	if len(signs) == 0 {
+		return ErrorMissingSign
+	}
+	if err := w.checkTolerance(timestamp); err != nil {
+		return err
+	}
+	return verifyAny(w.Algorithms, []byte(timestamp+w.Separator+string(body)), signs)
+}
+
+// Sign 使用第一个secret生成header值, 用于发送webhook或测试
+func (w *TimestampedWebhook) Sign(body []byte) (string, error) {
+	timestamp := strconv.FormatInt(w.Clock().Unix(), 10)
+	sign, err := w.Algorithms[0].Sign([]byte(timestamp + w.Separator + string(body)))
+	if err != nil {
+		return "", err
+	}
+	return w.TimestampKey + "=" + timestamp + "," + w.SignKey + "=" + sign, nil
+}
@@ -0,0 +1,196 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	stderrors "errors"
+	"github.com/go-estar/iris/baseContext"
+	"github.com/go-estar/iris/response"
+	"github.com/kataras/iris/v12"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitHubWebhook(t *testing.T) {
+	// https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries
+	w := NewHMACWebhook("X-Hub-Signature-256", EncodingHex, []string{"old", "It's a Secret to Everybody"}, WithWebhookPrefix("sha256="))
+	header := http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17")
+	if err := w.VerifyRaw(header, []byte("Hello, World!")); err != nil {
+		t.Errorf("VerifyRaw() = %v", err)
+	}
+	if err := w.VerifyRaw(header, []byte("Hello, World?")); err != ErrorInvalidSign {
+		t.Errorf("VerifyRaw(tampered) = %v, want %v", err, ErrorInvalidSign)
+	}
+	header.Set("X-Hub-Signature-256", "757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17")
+	if err := w.VerifyRaw(header, []byte("Hello, World!")); err != ErrorInvalidSign {
+		t.Errorf("VerifyRaw(no prefix) = %v, want %v", err, ErrorInvalidSign)
+	}
+	if err := w.VerifyRaw(http.Header{}, []byte("Hello, World!")); err != ErrorMissingSign {
+		t.Errorf("VerifyRaw(unsigned) = %v, want %v", err, ErrorMissingSign)
+	}
+}
+
+func TestShopifyWebhook(t *testing.T) {
+	w := NewHMACWebhook("X-Shopify-Hmac-Sha256", EncodingBase64, []string{"shpss_secret"})
+	body := []byte(`{"id":820982911946154508,"email":"jon@doe.ca"}`)
+	header := http.Header{}
+	header.Set("X-Shopify-Hmac-Sha256", "Py5rRrvmrqKGlfxC3SZLuEhx+L9Ad7OBHIVcWvJqO8A=")
+	if err := w.VerifyRaw(header, body); err != nil {
+		t.Errorf("VerifyRaw() = %v", err)
+	}
+	if err := w.VerifyRaw(header, append(body, ' ')); err != ErrorInvalidSign {
+		t.Errorf("VerifyRaw(tampered) = %v, want %v", err, ErrorInvalidSign)
+	}
+}
+
+func TestStripeWebhook(t *testing.T) {
+	body := []byte(`{"id":"evt_test","object":"event"}`)
+	const sign = "8042376f6ca064adbe037642a718227dfd59047137eb49497a54c49eb0cfb724"
+	newWebhook := func(now time.Time, opts ...WebhookOption) *TimestampedWebhook {
+		return NewTimestampedHMACWebhook("Stripe-Signature", []string{"whsec_test_secret", "whsec_old"},
+			append([]WebhookOption{WithWebhookClock(func() time.Time { return now })}, opts...)...)
+	}
+	tests := []struct {
+		name  string
+		now   time.Time
+		value string
+		opts  []WebhookOption
+		want  error
+	}{
+		{"valid", testNow, "t=1700000000,v1=" + sign, nil, nil},
+		{"rotated", testNow, "t=1700000000,v1=deadbeef,v1=" + sign + ",v0=ignored", nil, nil},
+		{"withinTolerance", testNow.Add(4 * time.Minute), "t=1700000000,v1=" + sign, nil, nil},
+		{"expired", testNow.Add(6 * time.Minute), "t=1700000000,v1=" + sign, nil, ErrorTimestampExpired},
+		{"future", testNow.Add(-6 * time.Minute), "t=1700000000,v1=" + sign, nil, ErrorTimestampFuture},
+		{"tolerance", testNow.Add(time.Minute), "t=1700000000,v1=" + sign, []WebhookOption{WithWebhookTolerance(30 * time.Second)}, ErrorTimestampExpired},
+		{"skipTolerance", testNow.Add(time.Hour), "t=1700000000,v1=" + sign, []WebhookOption{WithWebhookSkipTolerance(true)}, nil},
+		{"tampered", testNow, "t=1700000001,v1=" + sign, nil, ErrorInvalidSign},
+		{"missingTimestamp", testNow, "v1=" + sign, nil, ErrorMissingTimestamp},
+		{"missingSign", testNow, "t=1700000000", nil, ErrorMissingSign},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Stripe-Signature", tt.value)
+			if err := newWebhook(tt.now, tt.opts...).VerifyRaw(header, body); !stderrors.Is(err, tt.want) {
+				t.Errorf("VerifyRaw() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	value, err := newWebhook(testNow).Sign(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "t=1700000000,v1=" + sign; value != want {
+		t.Errorf("Sign() = %s, want %s", value, want)
+	}
+}
+
+func TestRSAWebhook(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"id":"evt_test"}`)
+	sign := func(key *rsa.PrivateKey, data []byte) string {
+		digest := sha256.Sum256(data)
+		b, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	w := NewRSAWebhook("X-Signature", crypto.SHA256, []*rsa.PublicKey{&rotated.PublicKey, &key.PublicKey})
+	header := http.Header{}
+	header.Set("X-Signature", sign(key, body))
+	if err := w.VerifyRaw(header, body); err != nil {
+		t.Errorf("VerifyRaw() = %v", err)
+	}
+	if err := w.VerifyRaw(header, append(body, ' ')); err != ErrorInvalidSign {
+		t.Errorf("VerifyRaw(tampered) = %v, want %v", err, ErrorInvalidSign)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Set("X-Signature", sign(other, body))
+	if err := w.VerifyRaw(header, body); err != ErrorInvalidSign {
+		t.Errorf("VerifyRaw(unknown key) = %v, want %v", err, ErrorInvalidSign)
+	}
+
+	//带timestamp时待签名数据为 timestamp.body
+	w = NewRSAWebhook("X-Signature", crypto.SHA256, []*rsa.PublicKey{&key.PublicKey},
+		WithWebhookTimestampHeader("X-Timestamp"), WithWebhookClock(func() time.Time { return testNow }))
+	header.Set("X-Timestamp", "1700000000")
+	header.Set("X-Signature", sign(key, append([]byte("1700000000."), body...)))
+	if err := w.VerifyRaw(header, body); err != nil {
+		t.Errorf("VerifyRaw(timestamp) = %v", err)
+	}
+	header.Set("X-Timestamp", "1700000001")
+	if err := w.VerifyRaw(header, body); err != ErrorInvalidSign {
+		t.Errorf("VerifyRaw(timestamp tampered) = %v, want %v", err, ErrorInvalidSign)
+	}
+}
+
+// TestWebhookErrorCode webhook拒绝时返回对应的错误码而不是系统错误
+func TestWebhookErrorCode(t *testing.T) {
+	body := `{"id":"evt_test","object":"event"}`
+	const sign = "8042376f6ca064adbe037642a718227dfd59047137eb49497a54c49eb0cfb724"
+	baseContext.New("test", nil, baseContext.WithResponse(response.New))
+	tests := []struct {
+		name  string
+		now   time.Time
+		value string
+		want  string
+	}{
+		{"valid", testNow, "t=1700000000,v1=" + sign, "ok"},
+		{"expired", testNow.Add(6 * time.Minute), "t=1700000000,v1=" + sign, baseContext.ErrorTimestampExpired},
+		{"future", testNow.Add(-6 * time.Minute), "t=1700000000,v1=" + sign, baseContext.ErrorTimestampFuture},
+		{"malformed", testNow, "t=abc,v1=" + sign, baseContext.ErrorTimestampMalformed},
+		{"missingTimestamp", testNow, "v1=" + sign, baseContext.ErrorTimestampMissing},
+		{"tampered", testNow, "t=1700000001,v1=" + sign, baseContext.ErrorUnauthorized},
+		{"missingSign", testNow, "", baseContext.ErrorUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			w := NewTimestampedHMACWebhook("Stripe-Signature", []string{"whsec_test_secret"}, WithWebhookClock(func() time.Time { return now }))
+			app := iris.New()
+			app.Post("/", NewRaw(w).Handler(), func(ctx iris.Context) {
+				ctx.WriteString("ok")
+			})
+			if err := app.Build(); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			req.Header.Set("Stripe-Signature", tt.value)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			if got := responseCode(rec); got != tt.want {
+				t.Errorf("code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookTolerancePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	NewTimestampedHMACWebhook("Stripe-Signature", []string{"secret"}, WithWebhookTolerance(0))
+}